@@ -0,0 +1,255 @@
+package acl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"nc-rag-worker/models"
+	"nc-rag-worker/qdrant"
+	"nc-rag-worker/storage"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// OwnerPrincipal returns the ACL principal of a file owner
+func OwnerPrincipal(ownerUID string) string {
+	return "u:" + ownerUID
+}
+
+const (
+	// lockWait bounds how long an ACL update waits for another update of the same file
+	lockWait = 15 * time.Second
+	// lockPoll is how often a held file lock is retried
+	lockPoll = 100 * time.Millisecond
+)
+
+// ErrLocked is returned when the principals of a file stay locked by another worker
+var ErrLocked = errors.New("file ACL is locked")
+
+// Manager maintains the principals payload of indexed files in Qdrant.
+// ACL changes only rewrite payloads; vectors are never recomputed.
+// Share events are also stored per file, so files that are not indexed yet get them at ingest.
+type Manager struct {
+	qdrant  *qdrant.Client
+	storage *storage.RedisStorage
+}
+
+// NewManager creates a new ACL manager
+func NewManager(qdrantClient *qdrant.Client, storage *storage.RedisStorage) *Manager {
+	return &Manager{
+		qdrant:  qdrantClient,
+		storage: storage,
+	}
+}
+
+// Lock serializes reads and writes of a file's principals across workers. It waits while
+// another worker holds the lock and returns ErrLocked if it is not released in time.
+// The returned function releases the lock.
+func (m *Manager) Lock(ctx context.Context, tenant string, fileID int64) (func(), error) {
+	token := models.NewTraceID()
+	deadline := time.Now().Add(lockWait)
+	for {
+		ok, err := m.storage.LockFileACL(ctx, tenant, fileID, token)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrLocked
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPoll):
+		}
+	}
+
+	return func() {
+		// Release even if the caller's context was cancelled meanwhile
+		if err := m.storage.UnlockFileACL(context.WithoutCancel(ctx), tenant, fileID, token); err != nil {
+			log.WithError(err).WithField("file_id", fileID).Warn("Failed to unlock file ACL")
+		}
+	}, nil
+}
+
+// ApplyStoredShares applies the stored share events of a file to principals.
+// The caller must hold the file's lock.
+func (m *Manager) ApplyStoredShares(ctx context.Context, tenant string, fileID int64, principals []string) ([]string, error) {
+	shares, err := m.storage.FileShares(ctx, tenant, fileID)
+	if err != nil {
+		return nil, err
+	}
+	for principal, granted := range shares {
+		if granted {
+			principals = Union(principals, principal)
+		} else {
+			principals = Difference(principals, principal)
+		}
+	}
+	return principals, nil
+}
+
+// Forget drops the stored share events of a deleted file
+func (m *Manager) Forget(ctx context.Context, tenant string, fileID int64) error {
+	return m.storage.ClearFileShares(ctx, tenant, fileID)
+}
+
+// Principals returns the current principals of a file and whether it has any indexed points
+func (m *Manager) Principals(ctx context.Context, tenant string, fileID int64) ([]string, bool, error) {
+	principals, _, found, err := m.read(ctx, tenant, fileID)
+	return principals, found, err
+}
+
+// read loads principals and owner from one point of the file; all points of a file share them
+func (m *Manager) read(ctx context.Context, tenant string, fileID int64) ([]string, string, bool, error) {
+	records, err := m.qdrant.Scroll(ctx, qdrant.FileFilter(tenant, fileID), 1, []string{"principals", "owner_uid"})
+	if err != nil {
+		return nil, "", false, err
+	}
+	if len(records) == 0 {
+		return nil, "", false, nil
+	}
+
+	payload := records[0].Payload
+	principals := stringSlice(payload["principals"])
+	owner, _ := payload["owner_uid"].(string)
+	if owner != "" {
+		principals = Union(principals, OwnerPrincipal(owner))
+	}
+	return principals, owner, true, nil
+}
+
+// Grant adds a principal to every point of a file
+func (m *Manager) Grant(ctx context.Context, tenant string, fileID int64, principal string) error {
+	return m.update(ctx, tenant, fileID, principal, true)
+}
+
+// Revoke removes a principal from every point of a file
+func (m *Manager) Revoke(ctx context.Context, tenant string, fileID int64, principal string) error {
+	return m.update(ctx, tenant, fileID, principal, false)
+}
+
+// update stores the share event, then reads the current principals under the file's lock,
+// applies it and writes the result back to all points of the file
+func (m *Manager) update(ctx context.Context, tenant string, fileID int64, principal string, granted bool) error {
+	logger := log.WithFields(log.Fields{
+		"tenant":    tenant,
+		"file_id":   fileID,
+		"principal": principal,
+	})
+
+	unlock, err := m.Lock(ctx, tenant, fileID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := m.storage.RecordShare(ctx, tenant, fileID, principal, granted); err != nil {
+		return err
+	}
+
+	current, owner, found, err := m.read(ctx, tenant, fileID)
+	if err != nil {
+		return fmt.Errorf("failed to read principals: %w", err)
+	}
+	if !found {
+		logger.Info("File has no indexed points yet, share stored for ingest")
+		return nil
+	}
+
+	op := Difference
+	if granted {
+		op = Union
+	}
+
+	updated := op(current, principal)
+	if owner != "" {
+		// The owner always keeps access to their own file
+		updated = Union(updated, OwnerPrincipal(owner))
+	}
+	if equal(current, updated) {
+		logger.Debug("Principals unchanged, skipping ACL update")
+		return nil
+	}
+
+	payload := map[string]interface{}{
+		"principals": updated,
+	}
+	if err := m.qdrant.SetPayload(ctx, qdrant.FileFilter(tenant, fileID), payload); err != nil {
+		return err
+	}
+
+	logger.WithField("principals", updated).Info("Updated file principals")
+	return nil
+}
+
+// Union returns the sorted set of principals with p added
+func Union(principals []string, p string) []string {
+	set := make(map[string]bool, len(principals)+1)
+	for _, existing := range principals {
+		set[existing] = true
+	}
+	set[p] = true
+	return sortedKeys(set)
+}
+
+// Difference returns the sorted set of principals with p removed
+func Difference(principals []string, p string) []string {
+	set := make(map[string]bool, len(principals))
+	for _, existing := range principals {
+		if existing != p {
+			set[existing] = true
+		}
+	}
+	return sortedKeys(set)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func equal(a, b []string) bool {
+	a = sortedKeys(toSet(a))
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+// stringSlice converts a decoded JSON array into a string slice
+func stringSlice(value interface{}) []string {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,104 @@
+// Package admin serves operator lookups on the worker's HTTP server.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"nc-rag-worker/models"
+	"nc-rag-worker/storage"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FilesPath is the prefix of the file lookup endpoint: GET /admin/files/{file_id}
+const FilesPath = "/admin/files/"
+
+// FileHandler reports what the worker knows about a file: its record and its latest job.
+// The record outlives archived jobs, so it tells which version and parser version are indexed.
+type FileHandler struct {
+	token atomic.Value
+	jobs  storage.JobStore
+}
+
+// FileLookup is the response of the file lookup endpoint
+type FileLookup struct {
+	FileID int64              `json:"file_id"`
+	Record *models.FileRecord `json:"record"`
+	Job    *models.JobState   `json:"job"`
+}
+
+// NewFileHandler creates a file lookup handler authenticated with token as bearer token
+func NewFileHandler(token string, jobs storage.JobStore) *FileHandler {
+	h := &FileHandler{jobs: jobs}
+	h.token.Store(token)
+	return h
+}
+
+// SetToken switches to a rotated admin token for all following requests
+func (h *FileHandler) SetToken(token string) {
+	h.token.Store(token)
+}
+
+// ServeHTTP handles GET /admin/files/{file_id}
+func (h *FileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if !h.authorized(r) {
+		log.WithField("remote_addr", r.RemoteAddr).Warn("Rejected admin request with invalid token")
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+
+	fileID, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, FilesPath), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid file ID")
+		return
+	}
+
+	lookup := FileLookup{FileID: fileID}
+	lookup.Record, err = h.jobs.GetFileRecord(r.Context(), fileID)
+	if err != nil && !errors.Is(err, storage.ErrFileRecordNotFound) {
+		log.WithError(err).WithField("file_id", fileID).Error("Failed to get file record")
+		writeError(w, http.StatusInternalServerError, "failed to get file record")
+		return
+	}
+	lookup.Job, err = h.jobs.GetJobByFileID(r.Context(), fileID)
+	if err != nil && !errors.Is(err, storage.ErrJobNotFound) {
+		log.WithError(err).WithField("file_id", fileID).Error("Failed to get job of file")
+		writeError(w, http.StatusInternalServerError, "failed to get job of file")
+		return
+	}
+
+	if lookup.Record == nil && lookup.Job == nil {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, lookup)
+}
+
+// authorized checks the bearer token; an empty token rejects every request
+func (h *FileHandler) authorized(r *http.Request) bool {
+	token := h.token.Load().(string)
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
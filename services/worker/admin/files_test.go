@@ -0,0 +1,96 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"nc-rag-worker/models"
+	"nc-rag-worker/storage"
+)
+
+func lookup(t *testing.T, h *FileHandler, path, token string) (*httptest.ResponseRecorder, FileLookup) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var body FileLookup
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+	}
+	return rec, body
+}
+
+func TestFileLookup(t *testing.T) {
+	ctx := context.Background()
+	jobs := storage.NewMemoryJobStore()
+	h := NewFileHandler("admin-token", jobs)
+
+	job := &models.JobState{JobID: "job-1", FileID: 42, Tenant: "default", Status: models.JobStatusCompleted, SubmittedAt: time.Now(), FileVersion: "etag:1"}
+	if err := jobs.SaveJob(ctx, job); err != nil {
+		t.Fatalf("SaveJob: %v", err)
+	}
+
+	// Before archival only the job is known
+	rec, body := lookup(t, h, "/admin/files/42", "admin-token")
+	if rec.Code != http.StatusOK || body.Job == nil || body.Job.JobID != "job-1" || body.Record != nil {
+		t.Fatalf("lookup = %d %+v", rec.Code, body)
+	}
+
+	// After archival the record still tells what is indexed
+	err := jobs.UpdateFileRecord(ctx, 42, func(record *models.FileRecord) bool {
+		record.RecordIndexed(job, "parser-2", "hash", time.Now())
+		return true
+	})
+	if err != nil {
+		t.Fatalf("UpdateFileRecord: %v", err)
+	}
+	if err := jobs.DeleteJob(ctx, "job-1"); err != nil {
+		t.Fatalf("DeleteJob: %v", err)
+	}
+	rec, body = lookup(t, h, "/admin/files/42", "admin-token")
+	if rec.Code != http.StatusOK || body.Job != nil || body.Record == nil {
+		t.Fatalf("lookup = %d %+v", rec.Code, body)
+	}
+	if body.Record.IndexedJobID != "job-1" || body.Record.ParserVersion != "parser-2" || body.Record.FileVersion != "etag:1" {
+		t.Fatalf("record = %+v", body.Record)
+	}
+}
+
+func TestFileLookupErrors(t *testing.T) {
+	h := NewFileHandler("admin-token", storage.NewMemoryJobStore())
+
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		want  int
+	}{
+		{"missing token", "/admin/files/42", "", http.StatusUnauthorized},
+		{"wrong token", "/admin/files/42", "other", http.StatusUnauthorized},
+		{"invalid file ID", "/admin/files/abc", "admin-token", http.StatusBadRequest},
+		{"unknown file", "/admin/files/42", "admin-token", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec, _ := lookup(t, h, tt.path, tt.token); rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+
+	// An empty token disables the endpoint
+	h.SetToken("")
+	if rec, _ := lookup(t, h, "/admin/files/42", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status with empty token = %d, want 401", rec.Code)
+	}
+}
@@ -0,0 +1,129 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"nc-rag-worker/config"
+	"nc-rag-worker/models"
+	"nc-rag-worker/storage"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Sweeper compacts jobs whose retention expired into their file's index record and deletes them
+type Sweeper struct {
+	jobs      storage.JobStore
+	retention map[models.JobStatus]time.Duration
+	interval  time.Duration
+}
+
+// NewSweeper creates a new job archival sweeper
+func NewSweeper(cfg config.RetentionConfig, jobs storage.JobStore) *Sweeper {
+	return &Sweeper{
+		jobs: jobs,
+		retention: map[models.JobStatus]time.Duration{
+			models.JobStatusSubmitted:  cfg.Active,
+			models.JobStatusProcessing: cfg.Active,
+			models.JobStatusCompleted:  cfg.Completed,
+			models.JobStatusFailed:     cfg.Failed,
+			models.JobStatusSuperseded: cfg.Superseded,
+		},
+		interval: cfg.SweepInterval,
+	}
+}
+
+// Start runs a sweep every interval until the context is cancelled
+func (s *Sweeper) Start(ctx context.Context) error {
+	log.WithField("interval", s.interval.String()).Info("Starting job archival sweeper")
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.Sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Info("Job archival sweeper stopped")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep archives every job whose status has been unchanged for longer than its retention
+func (s *Sweeper) Sweep(ctx context.Context) {
+	now := time.Now()
+	archived := 0
+
+	for status, retention := range s.retention {
+		if retention <= 0 {
+			continue
+		}
+		n, err := s.sweepStatus(ctx, status, now.Add(-retention))
+		archived += n
+		if err != nil {
+			log.WithError(err).WithField("status", status).Warn("Job archival sweep failed")
+		}
+	}
+
+	if archived > 0 {
+		log.WithField("jobs", archived).Info("Archived expired jobs")
+	}
+}
+
+// sweepStatus archives jobs in status last updated before cutoff
+func (s *Sweeper) sweepStatus(ctx context.Context, status models.JobStatus, cutoff time.Time) (int, error) {
+	archived := 0
+	cursor := ""
+	for {
+		page, err := s.jobs.ListJobsByStatus(ctx, status, cursor, storage.DefaultPageSize)
+		if err != nil {
+			return archived, err
+		}
+		for _, job := range page.Jobs {
+			if ctx.Err() != nil {
+				return archived, ctx.Err()
+			}
+			// Pages are ordered by submission and a job cannot change before it was submitted
+			if job.SubmittedAt.After(cutoff) {
+				return archived, nil
+			}
+			if job.UpdatedAt().After(cutoff) {
+				continue
+			}
+			if err := s.archive(ctx, job); err != nil {
+				log.WithError(err).WithField("job_id", job.JobID).Warn("Failed to archive job")
+				continue
+			}
+			archived++
+		}
+		if page.NextCursor == "" {
+			return archived, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// archive records the job in its file's record, then deletes it
+func (s *Sweeper) archive(ctx context.Context, job *models.JobState) error {
+	if err := s.jobs.UpdateFileRecord(ctx, job.FileID, func(record *models.FileRecord) bool {
+		return record.RecordJob(job)
+	}); err != nil {
+		return err
+	}
+
+	if err := s.jobs.DeleteJob(ctx, job.JobID); err != nil && !errors.Is(err, storage.ErrJobNotFound) {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"trace_id": job.TraceID,
+		"job_id":   job.JobID,
+		"file_id":  job.FileID,
+		"status":   job.Status,
+	}).Debug("Archived job into file record")
+	return nil
+}
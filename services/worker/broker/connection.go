@@ -0,0 +1,254 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	minRetryDelay = 1 * time.Second
+	maxRetryDelay = 30 * time.Second
+)
+
+// ErrNotConnected is returned when a channel is requested while the connection is down
+var ErrNotConnected = errors.New("not connected to RabbitMQ")
+
+// ConnectionState describes the broker connection
+type ConnectionState string
+
+const (
+	StateDisconnected ConnectionState = "disconnected"
+	StateConnected    ConnectionState = "connected"
+	StateReconnecting ConnectionState = "reconnecting"
+	StateClosed       ConnectionState = "closed"
+)
+
+// ConnectionStatus is a snapshot of the connection health
+type ConnectionStatus struct {
+	State      ConnectionState `json:"state"`
+	Reconnects int64           `json:"reconnects"`
+	LastError  string          `json:"last_error,omitempty"`
+}
+
+// Connection is the RabbitMQ connection shared by the consumers and the publisher.
+// Start redials it after the broker closes it; users open their channels with Channel
+// and reopen them on the new connection after Wait.
+type Connection struct {
+	mu         sync.RWMutex
+	amqpURL    string
+	conn       *amqp091.Connection
+	state      ConnectionState
+	lastError  string
+	reconnects int64
+	// ready is closed and replaced each time a connection is established
+	ready chan struct{}
+}
+
+// NewConnection dials RabbitMQ; failing here fails startup, later losses are recovered by Start
+func NewConnection(amqpURL string) (*Connection, error) {
+	c := &Connection{
+		amqpURL: amqpURL,
+		state:   StateDisconnected,
+		ready:   make(chan struct{}),
+	}
+	if err := c.dial(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// dial opens a new connection with the current URL
+func (c *Connection) dial() error {
+	c.mu.RLock()
+	amqpURL := c.amqpURL
+	c.mu.RUnlock()
+
+	conn, err := amqp091.Dial(amqpURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == StateClosed {
+		// Closed while redialing
+		conn.Close()
+		return nil
+	}
+	c.conn = conn
+	c.state = StateConnected
+	close(c.ready)
+	c.ready = make(chan struct{})
+	return nil
+}
+
+// Start watches the connection and redials with backoff whenever the broker closes it,
+// until ctx is cancelled or the connection is closed with Close
+func (c *Connection) Start(ctx context.Context) {
+	for {
+		c.mu.RLock()
+		conn, state := c.conn, c.state
+		c.mu.RUnlock()
+		if state == StateClosed {
+			return
+		}
+
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case amqpErr, ok := <-conn.NotifyClose(make(chan *amqp091.Error, 1)):
+			if !ok {
+				// Closed without an error: by Close, or before we started watching
+				err = errors.New("connection closed")
+			} else {
+				err = fmt.Errorf("connection closed: %v", amqpErr)
+			}
+		}
+
+		if !c.setState(StateReconnecting, err) {
+			return
+		}
+		log.WithError(err).Warn("RabbitMQ connection lost, reconnecting")
+
+		if err := Retry(ctx, "RabbitMQ reconnect", c.dial); err != nil {
+			return
+		}
+		reconnects := atomic.AddInt64(&c.reconnects, 1)
+		log.WithField("reconnects", reconnects).Info("Reconnected to RabbitMQ")
+	}
+}
+
+// setState records the connection state and the error that caused it.
+// It reports false once the connection was closed, which is final.
+func (c *Connection) setState(state ConnectionState, err error) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == StateClosed {
+		return false
+	}
+	c.state = state
+	if err != nil {
+		c.lastError = err.Error()
+	}
+	return true
+}
+
+// Channel opens a channel on the current connection
+func (c *Connection) Channel() (*amqp091.Channel, error) {
+	c.mu.RLock()
+	conn, state := c.conn, c.state
+	c.mu.RUnlock()
+
+	if state != StateConnected || conn.IsClosed() {
+		return nil, ErrNotConnected
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create RabbitMQ channel: %w", err)
+	}
+	return channel, nil
+}
+
+// Wait blocks until the connection is up or ctx is cancelled
+func (c *Connection) Wait(ctx context.Context) error {
+	for {
+		c.mu.RLock()
+		state, ready := c.state, c.ready
+		c.mu.RUnlock()
+
+		switch state {
+		case StateConnected:
+			return nil
+		case StateClosed:
+			return ErrNotConnected
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ready:
+		}
+	}
+}
+
+// SetURL switches to rotated credentials; the current connection is kept and the URL is used on the next reconnect
+func (c *Connection) SetURL(amqpURL string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.amqpURL = amqpURL
+}
+
+// Status returns the connection state and reconnect count
+func (c *Connection) Status() ConnectionStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return ConnectionStatus{
+		State:      c.state,
+		Reconnects: atomic.LoadInt64(&c.reconnects),
+		LastError:  c.lastError,
+	}
+}
+
+// Health checks RabbitMQ connection health
+func (c *Connection) Health(ctx context.Context) error {
+	status := c.Status()
+	if status.State != StateConnected {
+		return fmt.Errorf("RabbitMQ connection is %s (reconnects: %d, last error: %s)", status.State, status.Reconnects, status.LastError)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.conn.IsClosed() {
+		return fmt.Errorf("RabbitMQ connection is closed")
+	}
+	return nil
+}
+
+// Close closes the connection and all channels on it; it is not reopened afterwards
+func (c *Connection) Close() error {
+	c.mu.Lock()
+	conn := c.conn
+	c.state = StateClosed
+	close(c.ready)
+	c.ready = make(chan struct{})
+	c.mu.Unlock()
+
+	if conn != nil && !conn.IsClosed() {
+		return conn.Close()
+	}
+	return nil
+}
+
+// Retry calls fn with exponential backoff and jitter until it succeeds or ctx is cancelled
+func Retry(ctx context.Context, what string, fn func() error) error {
+	delay := minRetryDelay
+	for attempt := 1; ; attempt++ {
+		jitter := time.Duration(rand.Int63n(int64(delay) / 2))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay + jitter):
+		}
+
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		log.WithError(err).WithField("attempt", attempt).Warn(what + " failed")
+
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
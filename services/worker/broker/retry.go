@@ -0,0 +1,239 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"nc-rag-worker/metrics"
+	"nc-rag-worker/tracing"
+
+	"github.com/rabbitmq/amqp091-go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// retryCountHeader carries how many times a message has been retried
+	retryCountHeader = "x-retry-count"
+	// lastErrorHeader carries the error of the last failed attempt
+	lastErrorHeader = "x-last-error"
+	// failedAtHeader carries when the message was dead-lettered
+	failedAtHeader = "x-failed-at"
+)
+
+// PermanentError marks a failure that retrying cannot fix
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent wraps err as a permanent failure
+func Permanent(err error) error {
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent checks if err was marked with Permanent
+func IsPermanent(err error) bool {
+	var permanentErr *PermanentError
+	return errors.As(err, &permanentErr)
+}
+
+// Retrier sends failed deliveries of a queue to delay queues, and permanent or
+// exhausted ones to the queue's dead-letter queue
+type Retrier struct {
+	queue      string
+	maxRetries int
+	delays     []time.Duration
+}
+
+// NewRetrier creates a retrier for queue; delays are the retry tiers, the last one repeats
+func NewRetrier(queue string, maxRetries int, delays []time.Duration) *Retrier {
+	return &Retrier{
+		queue:      queue,
+		maxRetries: maxRetries,
+		delays:     delays,
+	}
+}
+
+// Declare declares the dead-letter exchange/queue and one TTL'd retry queue per delay.
+// Retry queues dead-letter expired messages back to the queue through the default exchange.
+// Using one queue per delay avoids head-of-line blocking of per-message TTLs.
+func (r *Retrier) Declare(channel *amqp091.Channel) error {
+	if err := channel.ExchangeDeclare(r.DeadLetterExchange(), "direct", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare dead-letter exchange: %w", err)
+	}
+	if _, err := channel.QueueDeclare(r.DeadLetterQueue(), true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare dead-letter queue: %w", err)
+	}
+	if err := channel.QueueBind(r.DeadLetterQueue(), r.queue, r.DeadLetterExchange(), false, nil); err != nil {
+		return fmt.Errorf("failed to bind dead-letter queue: %w", err)
+	}
+
+	for _, delay := range r.delays {
+		args := amqp091.Table{
+			"x-message-ttl":             delay.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": r.queue,
+		}
+		if _, err := channel.QueueDeclare(r.RetryQueueName(delay), true, false, false, false, args); err != nil {
+			return fmt.Errorf("failed to declare retry queue: %w", err)
+		}
+	}
+	return nil
+}
+
+// RetryQueueName returns the name of the delay queue for the given tier
+func (r *Retrier) RetryQueueName(delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", r.queue, delay)
+}
+
+// DeadLetterExchange returns the name of the dead-letter exchange
+func (r *Retrier) DeadLetterExchange() string {
+	return r.queue + ".dlx"
+}
+
+// DeadLetterQueue returns the name of the dead-letter queue
+func (r *Retrier) DeadLetterQueue() string {
+	return r.queue + ".dlq"
+}
+
+// Handle retries a failed delivery with delay or dead-letters it, then acks the original.
+// publishChannel must be in confirm mode and not be used concurrently.
+// If republishing fails the delivery is requeued so it is never lost.
+// It returns the outcome for the message metrics.
+func (r *Retrier) Handle(ctx context.Context, publishChannel *amqp091.Channel, msg amqp091.Delivery, procErr error, permanent bool, logger *log.Entry) string {
+	retryCount := RetryCount(msg.Headers)
+	logger = logger.WithFields(log.Fields{
+		"retry_count": retryCount,
+		"permanent":   permanent,
+	})
+
+	var err error
+	outcome := metrics.OutcomeRetried
+	if r.shouldDeadLetter(retryCount, permanent) {
+		outcome = metrics.OutcomeDeadLettered
+		err = r.deadLetter(ctx, publishChannel, msg, procErr, retryCount)
+		if err == nil {
+			logger.WithError(procErr).Error("Message dead-lettered")
+		}
+	} else {
+		var delay time.Duration
+		delay, err = r.retry(ctx, publishChannel, msg, procErr, retryCount+1)
+		if err == nil {
+			logger.WithError(procErr).WithField("retry_delay", delay.String()).Warn("Message scheduled for retry")
+		}
+	}
+
+	if err != nil {
+		logger.WithError(err).Error("Failed to republish failed message, requeueing")
+		msg.Nack(false, true)
+		return metrics.OutcomeRequeued
+	}
+	msg.Ack(false)
+	return outcome
+}
+
+// shouldDeadLetter reports whether a failed delivery goes to the dead-letter queue instead of a delay queue
+func (r *Retrier) shouldDeadLetter(retryCount int, permanent bool) bool {
+	return permanent || retryCount >= r.maxRetries
+}
+
+// retryDelay returns the delay tier of an attempt; attempts beyond the tiers use the last one
+func (r *Retrier) retryDelay(attempt int) time.Duration {
+	tier := attempt - 1
+	if tier >= len(r.delays) {
+		tier = len(r.delays) - 1
+	}
+	return r.delays[tier]
+}
+
+// retry publishes the message to the delay queue for its attempt number
+func (r *Retrier) retry(ctx context.Context, publishChannel *amqp091.Channel, msg amqp091.Delivery, procErr error, attempt int) (time.Duration, error) {
+	delay := r.retryDelay(attempt)
+
+	headers := CopyHeaders(msg.Headers)
+	headers[retryCountHeader] = int32(attempt)
+	headers[lastErrorHeader] = procErr.Error()
+
+	return delay, Republish(ctx, publishChannel, "", r.RetryQueueName(delay), msg, headers)
+}
+
+// deadLetter publishes the message to the dead-letter queue with the last error attached
+func (r *Retrier) deadLetter(ctx context.Context, publishChannel *amqp091.Channel, msg amqp091.Delivery, procErr error, retryCount int) error {
+	headers := CopyHeaders(msg.Headers)
+	headers[retryCountHeader] = int32(retryCount)
+	headers[lastErrorHeader] = procErr.Error()
+	headers[failedAtHeader] = time.Now().UTC().Format(time.RFC3339)
+
+	return Republish(ctx, publishChannel, r.DeadLetterExchange(), r.queue, msg, headers)
+}
+
+// Republish publishes a delivery body with new headers and waits for the broker confirm
+func Republish(ctx context.Context, publishChannel *amqp091.Channel, exchange, routingKey string, msg amqp091.Delivery, headers amqp091.Table) error {
+	// Link the retried or dead-lettered copy to the span of the failed attempt
+	tracing.InjectAMQP(ctx, headers)
+
+	confirm, err := publishChannel.PublishWithDeferredConfirmWithContext(
+		ctx,
+		exchange,
+		routingKey,
+		false, // mandatory
+		false, // immediate
+		amqp091.Publishing{
+			Headers:       headers,
+			ContentType:   msg.ContentType,
+			DeliveryMode:  amqp091.Persistent,
+			CorrelationId: msg.CorrelationId,
+			MessageId:     msg.MessageId,
+			Timestamp:     msg.Timestamp,
+			Body:          msg.Body,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to wait for publish confirm: %w", err)
+	}
+	if !acked {
+		return fmt.Errorf("broker rejected republished message")
+	}
+	return nil
+}
+
+// RetryCount reads the retry count; AMQP integer types vary by publisher
+func RetryCount(headers amqp091.Table) int {
+	switch value := headers[retryCountHeader].(type) {
+	case int:
+		return value
+	case int16:
+		return int(value)
+	case int32:
+		return int(value)
+	case int64:
+		return int(value)
+	case uint8:
+		return int(value)
+	default:
+		return 0
+	}
+}
+
+// CopyHeaders returns a copy of headers with room for the headers added on republish
+func CopyHeaders(headers amqp091.Table) amqp091.Table {
+	out := make(amqp091.Table, len(headers)+3)
+	for key, value := range headers {
+		out[key] = value
+	}
+	return out
+}
@@ -0,0 +1,131 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+func TestIsPermanent(t *testing.T) {
+	base := errors.New("bad payload")
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "plain", err: base, want: false},
+		{name: "permanent", err: Permanent(base), want: true},
+		{name: "wrapped permanent", err: fmt.Errorf("ingest: %w", Permanent(base)), want: true},
+		{name: "nil", err: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPermanent(tt.err); got != tt.want {
+				t.Fatalf("IsPermanent = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if err := Permanent(base); !errors.Is(err, base) || err.Error() != base.Error() {
+		t.Fatalf("Permanent(%v) = %v, want it to wrap the error", base, err)
+	}
+}
+
+func TestRetryCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers amqp091.Table
+		want    int
+	}{
+		{name: "missing", headers: amqp091.Table{}, want: 0},
+		{name: "nil headers", headers: nil, want: 0},
+		{name: "int32", headers: amqp091.Table{retryCountHeader: int32(3)}, want: 3},
+		{name: "int64", headers: amqp091.Table{retryCountHeader: int64(4)}, want: 4},
+		{name: "int16", headers: amqp091.Table{retryCountHeader: int16(2)}, want: 2},
+		{name: "uint8", headers: amqp091.Table{retryCountHeader: uint8(1)}, want: 1},
+		{name: "int", headers: amqp091.Table{retryCountHeader: 5}, want: 5},
+		{name: "string", headers: amqp091.Table{retryCountHeader: "3"}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RetryCount(tt.headers); got != tt.want {
+				t.Fatalf("RetryCount = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShouldDeadLetter(t *testing.T) {
+	r := NewRetrier("events.files", 3, []time.Duration{time.Second})
+
+	tests := []struct {
+		retryCount int
+		permanent  bool
+		want       bool
+	}{
+		{retryCount: 0, permanent: false, want: false},
+		{retryCount: 2, permanent: false, want: false},
+		{retryCount: 3, permanent: false, want: true},
+		{retryCount: 7, permanent: false, want: true},
+		{retryCount: 0, permanent: true, want: true},
+	}
+
+	for _, tt := range tests {
+		if got := r.shouldDeadLetter(tt.retryCount, tt.permanent); got != tt.want {
+			t.Fatalf("shouldDeadLetter(%d, %v) = %v, want %v", tt.retryCount, tt.permanent, got, tt.want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	r := NewRetrier("events.files", 10, []time.Duration{5 * time.Second, 30 * time.Second, 5 * time.Minute})
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 5 * time.Second},
+		{attempt: 2, want: 30 * time.Second},
+		{attempt: 3, want: 5 * time.Minute},
+		{attempt: 9, want: 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := r.retryDelay(tt.attempt); got != tt.want {
+			t.Fatalf("retryDelay(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestQueueNames(t *testing.T) {
+	r := NewRetrier("events.files", 3, nil)
+
+	if got := r.RetryQueueName(30 * time.Second); got != "events.files.retry.30s" {
+		t.Fatalf("RetryQueueName = %s", got)
+	}
+	if got := r.DeadLetterExchange(); got != "events.files.dlx" {
+		t.Fatalf("DeadLetterExchange = %s", got)
+	}
+	if got := r.DeadLetterQueue(); got != "events.files.dlq" {
+		t.Fatalf("DeadLetterQueue = %s", got)
+	}
+}
+
+func TestCopyHeaders(t *testing.T) {
+	headers := amqp091.Table{"x-debounce-seq": int64(4)}
+	copied := CopyHeaders(headers)
+	copied[retryCountHeader] = int32(1)
+
+	if _, ok := headers[retryCountHeader]; ok {
+		t.Fatal("CopyHeaders returned the original table")
+	}
+	if copied["x-debounce-seq"] != int64(4) {
+		t.Fatalf("copied headers = %v, want the original headers", copied)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"nc-rag-worker/config"
+	"nc-rag-worker/embeddings"
+	"nc-rag-worker/health"
+	"nc-rag-worker/llm"
+	"nc-rag-worker/nextcloud"
+	"nc-rag-worker/qdrant"
+	"nc-rag-worker/query"
+	"nc-rag-worker/server"
+	"nc-rag-worker/talk"
+	"nc-rag-worker/tracing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML config file; environment variables take precedence")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	flag.Parse()
+
+	// Initialize logging
+	log.SetFormatter(&log.JSONFormatter{})
+	log.SetLevel(log.InfoLevel)
+
+	log.Info("Starting NC-RAG query service...")
+
+	// Load configuration
+	cfg, err := config.LoadFile(*configFile)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to load configuration")
+	}
+	// Mask secrets in every log line from here on
+	redactHook := config.NewRedactHook(cfg)
+	log.AddHook(redactHook)
+	if *printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.WithError(err).Fatal("Failed to print configuration")
+		}
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"http_addr":       cfg.Query.Addr,
+		"nextcloud_url":   config.RedactURL(cfg.Nextcloud.URL),
+		"qdrant_url":      config.RedactURL(cfg.Qdrant.URL),
+		"score_threshold": cfg.Query.ScoreThreshold,
+		"llm_provider":    cfg.LLM.Provider,
+	}).Info("Configuration loaded")
+
+	// Initialize tracing
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing, "nc-rag-query")
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize tracing")
+	}
+
+	// Initialize clients
+	ncClient := nextcloud.NewClient(cfg.Nextcloud.URL, cfg.Nextcloud.User, cfg.Nextcloud.Password)
+	qdrantClient := qdrant.NewClient(cfg.Qdrant.URL, cfg.Qdrant.APIKey, cfg.Qdrant.Collection)
+
+	embedder, err := embeddings.New(cfg.Embedding)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize embedding provider")
+	}
+
+	generator, err := llm.New(cfg.LLM)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize LLM provider")
+	}
+
+	// Initialize HTTP server with the query endpoint
+	service := query.NewService(cfg.Query, cfg.LLM, ncClient, embedder, qdrantClient, generator)
+	httpServer := server.New(cfg.Query.Addr)
+	httpServer.Handle("/query", tracing.Handler(query.NewHandler(service), "query"))
+
+	// Qdrant is required to answer queries; Nextcloud is only needed for group lookups
+	healthRegistry := health.NewRegistry(5 * time.Second)
+	healthRegistry.Register("qdrant", qdrantClient, true)
+	healthRegistry.Register("nextcloud", ncClient, false)
+	httpServer.Handle("/healthz", health.LivenessHandler())
+	httpServer.Handle("/readyz", healthRegistry.ReadinessHandler())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// botDone is closed once the Talk bot has finished its answers
+	botDone := make(chan struct{})
+	var bot *talk.Bot
+	if cfg.Talk.Enabled {
+		bot = talk.NewBot(cfg.Talk, cfg.Nextcloud.URL, ncClient, service)
+		httpServer.Handle("/webhooks/talk", tracing.Handler(bot, "talk.webhook"))
+		go func() {
+			bot.Start(ctx)
+			close(botDone)
+		}()
+		log.WithFields(log.Fields{
+			"bot_name":    cfg.Talk.BotName,
+			"concurrency": cfg.Talk.Concurrency,
+		}).Info("Talk bot enabled")
+	} else {
+		close(botDone)
+	}
+
+	go func() {
+		if err := httpServer.Start(); err != nil {
+			log.WithError(err).Error("HTTP server error")
+			cancel()
+		}
+	}()
+
+	// Reload rotated secrets on SIGHUP or when a secret file changes
+	targets := &reloadTargets{
+		redactHook:   redactHook,
+		ncClient:     ncClient,
+		qdrantClient: qdrantClient,
+		embedder:     embedder,
+		generator:    generator,
+		bot:          bot,
+	}
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	secretChanged := config.WatchSecretFiles(ctx, cfg.SecretFiles(), cfg.Worker.SecretPollInterval)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hupChan:
+			case <-secretChanged:
+			}
+			reloadConfig(*configFile, cfg, targets)
+		}
+	}()
+
+	// Wait for shutdown signal
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case sig := <-sigChan:
+		log.WithField("signal", sig).Info("Received shutdown signal")
+	case <-ctx.Done():
+		log.Info("Context cancelled")
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shutdownCancel()
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.WithError(err).Warn("HTTP server shutdown failed")
+	}
+	cancel()
+	select {
+	case <-botDone:
+	case <-shutdownCtx.Done():
+		log.Warn("Talk bot did not stop in time")
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.WithError(err).Warn("Tracing shutdown failed")
+	}
+	log.Info("Query service stopped")
+}
+
+// reloadTargets are the running components that apply reloaded settings
+type reloadTargets struct {
+	redactHook   *config.RedactHook
+	ncClient     *nextcloud.Client
+	qdrantClient *qdrant.Client
+	embedder     embeddings.Embedder
+	generator    llm.Generator
+	bot          *talk.Bot
+}
+
+// reloadConfig applies the rotated secrets that changed since cfg was loaded.
+// An invalid configuration is rejected as a whole and the running settings are kept.
+func reloadConfig(path string, cfg *config.Config, targets *reloadTargets) {
+	next, err := config.LoadFile(path)
+	if err != nil {
+		log.WithError(err).Error("Configuration reload failed, keeping the running configuration")
+		return
+	}
+
+	// Mask rotated secrets before anything can log them
+	targets.redactHook.Add(next)
+
+	applied, restart := cfg.Reload(next)
+	for _, key := range applied {
+		switch key {
+		case "NEXTCLOUD_PASS":
+			targets.ncClient.SetPassword(cfg.Nextcloud.Password)
+		case "QDRANT_API_KEY":
+			targets.qdrantClient.SetAPIKey(cfg.Qdrant.APIKey)
+		case "OPENAI_API_KEY":
+			for _, client := range []interface{}{targets.embedder, targets.generator} {
+				if setter, ok := client.(interface{ SetAPIKey(string) }); ok {
+					setter.SetAPIKey(cfg.Embedding.OpenAIAPIKey)
+				}
+			}
+		case "OLLAMA_BASIC_AUTH":
+			for _, client := range []interface{}{targets.embedder, targets.generator} {
+				if setter, ok := client.(interface{ SetBasicAuth(string) }); ok {
+					setter.SetBasicAuth(cfg.Embedding.OllamaBasicAuth)
+				}
+			}
+		case "TALK_BOT_SECRET":
+			if targets.bot == nil {
+				// The bot is only created at startup
+				restart = append(restart, key)
+			} else {
+				targets.bot.SetSecret(cfg.Talk.Secret)
+			}
+		}
+	}
+
+	if len(restart) > 0 {
+		log.WithField("keys", restart).Warn("Configuration changes need a restart to take effect")
+	}
+	log.WithField("applied", applied).Info("Configuration reloaded")
+}
@@ -0,0 +1,132 @@
+package completion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"nc-rag-worker/models"
+	"nc-rag-worker/publisher"
+	"nc-rag-worker/storage"
+	"nc-rag-worker/tracing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Completer finalizes parser jobs and hands completed ones to ingest.
+// Both the webhook receiver and the status poller go through it so that
+// ingest.ready is published exactly once per job.
+type Completer struct {
+	jobs      storage.JobStore
+	storage   *storage.RedisStorage
+	publisher *publisher.RabbitMQPublisher
+}
+
+// NewCompleter creates a new job completer
+func NewCompleter(jobs storage.JobStore, storage *storage.RedisStorage, publisher *publisher.RabbitMQPublisher) *Completer {
+	return &Completer{
+		jobs:      jobs,
+		storage:   storage,
+		publisher: publisher,
+	}
+}
+
+// Complete marks a job completed and publishes it to ingest.ready once
+func (c *Completer) Complete(ctx context.Context, job *models.JobState) (err error) {
+	ctx, span := tracing.Start(ctx, "job.complete", job.TraceID)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	logger := log.WithFields(log.Fields{
+		"trace_id": job.TraceID,
+		"job_id":   job.JobID,
+		"file_id":  job.FileID,
+	})
+
+	if job.Status == models.JobStatusSuperseded {
+		logger.WithField("superseded_by", job.SupersededBy).Info("Ignoring completion of superseded job")
+		return nil
+	}
+
+	if job.Status != models.JobStatusCompleted {
+		if err := c.jobs.UpdateJobStatus(ctx, job.JobID, models.JobStatusCompleted, ""); err != nil {
+			if supersededMeanwhile(err) {
+				logger.Info("Ignoring completion of job superseded meanwhile")
+				return nil
+			}
+			return fmt.Errorf("failed to mark job completed: %w", err)
+		}
+		job.Status = models.JobStatusCompleted
+	}
+
+	// Guard against duplicate webhooks and webhook/poller races
+	first, err := c.storage.MarkIngestPublished(ctx, job.JobID)
+	if err != nil {
+		return err
+	}
+	if !first {
+		logger.Info("ingest.ready already published for job, skipping")
+		return nil
+	}
+
+	msg := &models.IngestReadyMessage{
+		JobID:   job.JobID,
+		TraceID: job.TraceID,
+	}
+	if err := c.publisher.PublishIngestReady(ctx, msg); err != nil {
+		// Release the marker so the next delivery can retry the publish
+		if clearErr := c.storage.ClearIngestPublished(ctx, job.JobID); clearErr != nil {
+			logger.WithError(clearErr).Error("Failed to clear ingest marker after publish failure")
+		}
+		return fmt.Errorf("failed to publish ingest.ready: %w", err)
+	}
+
+	logger.Info("Job completed and queued for ingest")
+	return nil
+}
+
+// Fail marks a job failed with the given error message
+func (c *Completer) Fail(ctx context.Context, job *models.JobState, errorMessage string) error {
+	ctx, span := tracing.Start(ctx, "job.fail", job.TraceID)
+	defer span.End()
+
+	if job.Status == models.JobStatusSuperseded {
+		return nil
+	}
+	if errorMessage == "" {
+		errorMessage = "parser reported failure"
+	}
+	if err := c.jobs.UpdateJobStatus(ctx, job.JobID, models.JobStatusFailed, errorMessage); err != nil {
+		if supersededMeanwhile(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to mark job failed: %w", err)
+	}
+	job.Status = models.JobStatusFailed
+	job.ErrorMessage = errorMessage
+
+	logger := log.WithFields(log.Fields{
+		"trace_id": job.TraceID,
+		"job_id":   job.JobID,
+		"file_id":  job.FileID,
+		"error":    errorMessage,
+	})
+	logger.Warn("Parser job failed")
+
+	// The version was committed at submit time; forget it so the next event for the file retries it
+	if job.FileVersion != "" {
+		if err := c.storage.ForgetFileVersion(ctx, job.Tenant, job.FileID, job.FileVersion); err != nil {
+			logger.WithError(err).Error("Failed to forget version of failed job")
+		}
+	}
+
+	return nil
+}
+
+// supersededMeanwhile checks if a status update was rejected because a newer job replaced this one
+func supersededMeanwhile(err error) bool {
+	var transitionErr *models.TransitionError
+	return errors.As(err, &transitionErr) && transitionErr.From == models.JobStatusSuperseded
+}
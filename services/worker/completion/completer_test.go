@@ -0,0 +1,100 @@
+package completion
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"nc-rag-worker/config"
+	"nc-rag-worker/models"
+	"nc-rag-worker/storage"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestCompleter(t *testing.T) (*Completer, storage.JobStore, *storage.RedisStorage) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	redisStorage, err := storage.NewRedisStorage("redis://"+server.Addr(), config.RetentionConfig{})
+	if err != nil {
+		t.Fatalf("NewRedisStorage: %v", err)
+	}
+	t.Cleanup(func() { redisStorage.Close() })
+
+	jobs := storage.NewMemoryJobStore()
+	return NewCompleter(jobs, redisStorage, nil), jobs, redisStorage
+}
+
+// submitJob records a submitted job for version the way the consumer does
+func submitJob(t *testing.T, jobs storage.JobStore, redisStorage *storage.RedisStorage, jobID, version string) *models.JobState {
+	t.Helper()
+	ctx := context.Background()
+
+	res, err := redisStorage.ClaimFileVersion(ctx, "tenant", 42, version, jobID)
+	if err != nil || res != storage.ClaimAcquired {
+		t.Fatalf("ClaimFileVersion(%s) = %d, %v", version, res, err)
+	}
+	job := &models.JobState{
+		JobID:       jobID,
+		FileID:      42,
+		Tenant:      "tenant",
+		Status:      models.JobStatusSubmitted,
+		SubmittedAt: time.Now(),
+		FileVersion: version,
+	}
+	job.StartHistory(job.SubmittedAt)
+	if err := jobs.SaveJob(ctx, job); err != nil {
+		t.Fatalf("SaveJob: %v", err)
+	}
+	if err := redisStorage.CommitFileVersion(ctx, "tenant", 42, version, jobID); err != nil {
+		t.Fatalf("CommitFileVersion: %v", err)
+	}
+	return job
+}
+
+func TestFailForgetsFileVersion(t *testing.T) {
+	ctx := context.Background()
+	completer, jobs, redisStorage := newTestCompleter(t)
+	job := submitJob(t, jobs, redisStorage, "job-1", "v1")
+
+	if err := completer.Fail(ctx, job, "parser crashed"); err != nil {
+		t.Fatalf("Fail: %v", err)
+	}
+
+	stored, err := jobs.GetJob(ctx, "job-1")
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if stored.Status != models.JobStatusFailed || stored.ErrorMessage != "parser crashed" {
+		t.Fatalf("job = %s (%q), want failed (parser crashed)", stored.Status, stored.ErrorMessage)
+	}
+
+	// The same version must be submitted again on the next event
+	res, err := redisStorage.ClaimFileVersion(ctx, "tenant", 42, "v1", "retry")
+	if err != nil {
+		t.Fatalf("ClaimFileVersion: %v", err)
+	}
+	if res != storage.ClaimAcquired {
+		t.Fatalf("claim after failure = %d, want ClaimAcquired", res)
+	}
+}
+
+func TestFailKeepsNewerFileVersion(t *testing.T) {
+	ctx := context.Background()
+	completer, jobs, redisStorage := newTestCompleter(t)
+	job := submitJob(t, jobs, redisStorage, "job-1", "v1")
+	submitJob(t, jobs, redisStorage, "job-2", "v2")
+
+	// job-1 fails late, after v2 was committed
+	if err := completer.Fail(ctx, job, ""); err != nil {
+		t.Fatalf("Fail: %v", err)
+	}
+
+	res, err := redisStorage.ClaimFileVersion(ctx, "tenant", 42, "v2", "retry")
+	if err != nil {
+		t.Fatalf("ClaimFileVersion: %v", err)
+	}
+	if res != storage.ClaimDuplicate {
+		t.Fatalf("claim of v2 after v1 failed = %d, want ClaimDuplicate", res)
+	}
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEmbedBatchSizeBounds(t *testing.T) {
+	tests := []struct {
+		batchSize int
+		valid     bool
+	}{
+		{15, false},
+		{16, true},
+		{64, true},
+		{65, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.batchSize), func(t *testing.T) {
+			t.Setenv("NEXTCLOUD_PASS", "secret")
+			t.Setenv("OLLAMA_EMBED_MODEL", "nomic-embed-text")
+			t.Setenv("EMBED_BATCH_SIZE", strconv.Itoa(tt.batchSize))
+
+			cfg, err := Load()
+			if !tt.valid {
+				if err == nil || !strings.Contains(err.Error(), "EMBED_BATCH_SIZE") {
+					t.Fatalf("Load() error = %v, want an EMBED_BATCH_SIZE error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Embedding.BatchSize != tt.batchSize {
+				t.Fatalf("BatchSize = %d, want %d", cfg.Embedding.BatchSize, tt.batchSize)
+			}
+		})
+	}
+}
+
+func TestReloadSharedCredentials(t *testing.T) {
+	t.Setenv("NEXTCLOUD_PASS", "secret")
+	t.Setenv("OLLAMA_EMBED_MODEL", "nomic-embed-text")
+	t.Setenv("OPENAI_API_KEY", "sk-old")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	t.Setenv("OPENAI_API_KEY", "sk-new")
+	t.Setenv("TALK_BOT_SECRET", "bot-secret")
+	t.Setenv("QDRANT_COLLECTION", "other")
+	next, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	applied, restart := cfg.Reload(next)
+	if got := strings.Join(applied, ","); got != "OPENAI_API_KEY,TALK_BOT_SECRET" {
+		t.Fatalf("applied = %s", got)
+	}
+	if got := strings.Join(restart, ","); got != "QDRANT_COLLECTION" {
+		t.Fatalf("restart = %s", got)
+	}
+	if cfg.Embedding.OpenAIAPIKey != "sk-new" || cfg.LLM.OpenAIAPIKey != "sk-new" {
+		t.Fatalf("API keys = %q and %q, want both rotated", cfg.Embedding.OpenAIAPIKey, cfg.LLM.OpenAIAPIKey)
+	}
+	if cfg.Talk.Secret != "bot-secret" {
+		t.Fatalf("Talk secret was not reloaded")
+	}
+}
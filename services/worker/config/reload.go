@@ -0,0 +1,72 @@
+package config
+
+import "net/url"
+
+// reloadable are the keys a running worker or query service applies on reload, with how to copy them over.
+// Changes to any other key only take effect after a restart.
+var reloadable = map[string]func(dst, src *Config){
+	"WORKER_CONCURRENCY":     func(dst, src *Config) { dst.Worker.Concurrency = src.Worker.Concurrency },
+	"WORKER_PREFETCH":        func(dst, src *Config) { dst.Worker.Prefetch = src.Worker.Prefetch },
+	"WORKER_MIME_TYPES":      func(dst, src *Config) { dst.Worker.MimeTypes = src.Worker.MimeTypes },
+	"POLLER_RPS":             func(dst, src *Config) { dst.Poller.RPS = src.Poller.RPS },
+	"NEXTCLOUD_PASS":         func(dst, src *Config) { dst.Nextcloud.Password = src.Nextcloud.Password },
+	"PARSER_SECRET":          func(dst, src *Config) { dst.Parser.Secret = src.Parser.Secret },
+	"QDRANT_API_KEY":         func(dst, src *Config) { dst.Qdrant.APIKey = src.Qdrant.APIKey },
+	"TALK_BOT_SECRET":        func(dst, src *Config) { dst.Talk.Secret = src.Talk.Secret },
+	"ADMIN_TOKEN":            func(dst, src *Config) { dst.Server.AdminToken = src.Server.AdminToken },
+	"RABBITMQ_URL":           func(dst, src *Config) { dst.RabbitMQ.URL = src.RabbitMQ.URL },
+	"REDIS_URL":              func(dst, src *Config) { dst.Redis.URL = src.Redis.URL },
+	"JOB_STORE_POSTGRES_URL": func(dst, src *Config) { dst.JobStore.PostgresURL = src.JobStore.PostgresURL },
+	// The embedder and the LLM share these credentials
+	"OPENAI_API_KEY": func(dst, src *Config) {
+		dst.Embedding.OpenAIAPIKey = src.Embedding.OpenAIAPIKey
+		dst.LLM.OpenAIAPIKey = src.LLM.OpenAIAPIKey
+	},
+	"OLLAMA_BASIC_AUTH": func(dst, src *Config) {
+		dst.Embedding.OllamaBasicAuth = src.Embedding.OllamaBasicAuth
+		dst.LLM.OllamaBasicAuth = src.LLM.OllamaBasicAuth
+	},
+}
+
+// Reload copies the reloadable settings that changed in next into c.
+// URLs are only reloaded when just their credentials changed.
+// It returns the keys it applied and the changed keys that need a restart.
+func (c *Config) Reload(next *Config) (applied, restart []string) {
+	for _, setting := range next.settings {
+		current, ok := c.setting(setting.Key)
+		if ok && current.Value == setting.Value {
+			continue
+		}
+		apply, ok := reloadable[setting.Key]
+		if !ok || (credentialURLKeys[setting.Key] && !sameExceptCredentials(current.Value, setting.Value)) {
+			restart = append(restart, setting.Key)
+			continue
+		}
+		apply(c, next)
+		c.replaceSetting(setting)
+		applied = append(applied, setting.Key)
+	}
+	return applied, restart
+}
+
+// replaceSetting records a reloaded setting
+func (c *Config) replaceSetting(setting Setting) {
+	for i := range c.settings {
+		if c.settings[i].Key == setting.Key {
+			c.settings[i] = setting
+			return
+		}
+	}
+	c.settings = append(c.settings, setting)
+}
+
+// sameExceptCredentials checks if two URLs differ at most in their username and password
+func sameExceptCredentials(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	ua.User, ub.User = nil, nil
+	return ua.String() == ub.String()
+}
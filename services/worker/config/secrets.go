@@ -0,0 +1,148 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// minRedactLength is the shortest secret masked in logs; shorter values would mask unrelated text
+const minRedactLength = 4
+
+// WatchSecretFiles checks paths every interval and signals when one of them changed, e.g. because
+// Kubernetes rotated a mounted secret. It returns a nil channel when there is nothing to watch.
+func WatchSecretFiles(ctx context.Context, paths []string, interval time.Duration) <-chan struct{} {
+	if len(paths) == 0 || interval <= 0 {
+		return nil
+	}
+
+	stamp := func(path string) string {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "missing"
+		}
+		return fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size())
+	}
+	stamps := make(map[string]string, len(paths))
+	for _, path := range paths {
+		stamps[path] = stamp(path)
+	}
+
+	changed := make(chan struct{}, 1)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for _, path := range paths {
+				if current := stamp(path); current != stamps[path] {
+					stamps[path] = current
+					log.WithField("path", path).Info("Secret file changed")
+					select {
+					case changed <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}
+	}()
+	return changed
+}
+
+// RedactHook is a logrus hook that masks secret values in log messages and fields.
+// It masks the secrets of every configuration it was given, so rotated-out secrets stay masked.
+type RedactHook struct {
+	mu       sync.RWMutex
+	secrets  map[string]bool
+	replacer *strings.Replacer
+}
+
+// NewRedactHook creates a hook masking the secrets of cfg
+func NewRedactHook(cfg *Config) *RedactHook {
+	h := &RedactHook{secrets: make(map[string]bool)}
+	h.Add(cfg)
+	return h
+}
+
+// Add masks the secrets of cfg in addition to the ones already masked
+func (h *RedactHook) Add(cfg *Config) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, setting := range cfg.settings {
+		for _, secret := range secretValues(setting) {
+			if len(secret) >= minRedactLength {
+				h.secrets[secret] = true
+				h.secrets[url.QueryEscape(secret)] = true
+			}
+		}
+	}
+
+	// Longer secrets first, so a secret containing another one is masked as a whole
+	secrets := make([]string, 0, len(h.secrets))
+	for secret := range h.secrets {
+		secrets = append(secrets, secret)
+	}
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	pairs := make([]string, 0, 2*len(secrets))
+	for _, secret := range secrets {
+		pairs = append(pairs, secret, redacted)
+	}
+	h.replacer = strings.NewReplacer(pairs...)
+}
+
+// secretValues returns the secret parts of a setting: the whole value of a secret key or a URL password
+func secretValues(setting Setting) []string {
+	if setting.Value == "" {
+		return nil
+	}
+	if secretKeys[setting.Key] {
+		values := []string{setting.Value}
+		// Basic auth is configured as user:password; the password alone must not leak either
+		if _, password, ok := strings.Cut(setting.Value, ":"); ok && password != "" {
+			values = append(values, password)
+		}
+		return values
+	}
+	if u, err := url.Parse(setting.Value); err == nil && u.User != nil {
+		if password, ok := u.User.Password(); ok && password != "" {
+			return []string{password}
+		}
+	}
+	return nil
+}
+
+// Levels returns all levels
+func (h *RedactHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire masks secrets in the message and in every field, including errors
+func (h *RedactHook) Fire(entry *log.Entry) error {
+	h.mu.RLock()
+	replacer := h.replacer
+	h.mu.RUnlock()
+
+	entry.Message = replacer.Replace(entry.Message)
+	for key, value := range entry.Data {
+		text, ok := value.(string)
+		if !ok {
+			text = fmt.Sprint(value)
+		}
+		if masked := replacer.Replace(text); masked != text {
+			entry.Data[key] = masked
+		}
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Origins of a configuration value
+const (
+	OriginEnv     = "env"
+	OriginFile    = "file"
+	OriginDefault = "default"
+)
+
+// redacted replaces secret values in printed configuration
+const redacted = "REDACTED"
+
+// secretKeys are the configuration keys whose values are never printed or logged
+var secretKeys = map[string]bool{
+	"NEXTCLOUD_PASS":    true,
+	"PARSER_SECRET":     true,
+	"QDRANT_API_KEY":    true,
+	"OLLAMA_BASIC_AUTH": true,
+	"OPENAI_API_KEY":    true,
+	"TALK_BOT_SECRET":   true,
+	"ADMIN_TOKEN":       true,
+}
+
+// credentialURLKeys are the URLs that may embed a username and password
+var credentialURLKeys = map[string]bool{
+	"RABBITMQ_URL":           true,
+	"REDIS_URL":              true,
+	"JOB_STORE_POSTGRES_URL": true,
+}
+
+// hasFileVariant checks if key can be read from the file named by <key>_FILE, like Docker and Kubernetes secrets
+func hasFileVariant(key string) bool {
+	return secretKeys[key] || credentialURLKeys[key]
+}
+
+// Setting is a resolved configuration key and where its value came from
+type Setting struct {
+	Key    string
+	Value  string
+	Origin string
+	// File is the secret file the value was read from, if it was set with <key>_FILE
+	File string
+}
+
+// Redacted returns the value with secrets and URL passwords masked
+func (s Setting) Redacted() string {
+	if s.Value == "" {
+		return ""
+	}
+	if secretKeys[s.Key] {
+		return redacted
+	}
+	return RedactURL(s.Value)
+}
+
+// RedactURL masks the password of a URL; other values are returned unchanged
+func RedactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); !ok {
+		return value
+	}
+	u.User = url.UserPassword(u.User.Username(), redacted)
+	return u.String()
+}
+
+// source resolves configuration keys from the environment, then the config file, then defaults
+type source struct {
+	path     string
+	file     map[string]string
+	settings []Setting
+	// err is the first secret file that could not be used
+	err error
+}
+
+// newSource reads the config file at path; an empty path uses only the environment
+func newSource(path string) (*source, error) {
+	s := &source{path: path, file: map[string]string{}}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if err := flattenInto(s.file, "", doc); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// flattenInto turns nested sections into env-style keys: worker: {concurrency: 4} is WORKER_CONCURRENCY
+func flattenInto(dst map[string]string, prefix string, doc map[string]interface{}) error {
+	for name, value := range doc {
+		key := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+
+		var flat string
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if err := flattenInto(dst, key, v); err != nil {
+				return err
+			}
+			continue
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				s, err := scalarString(key, item)
+				if err != nil {
+					return err
+				}
+				items = append(items, s)
+			}
+			flat = strings.Join(items, ",")
+		default:
+			s, err := scalarString(key, v)
+			if err != nil {
+				return err
+			}
+			flat = s
+		}
+
+		if _, exists := dst[key]; exists {
+			return fmt.Errorf("%s is set more than once", key)
+		}
+		dst[key] = flat
+	}
+	return nil
+}
+
+// scalarString formats a YAML scalar the way it would be written in the environment
+func scalarString(key string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("%s must be a scalar or a list of scalars", key)
+	}
+}
+
+// getOrDefault returns the environment value of key, else the file value, else defaultValue.
+// Within each layer a secret may instead be read from the file named by <key>_FILE.
+func (s *source) getOrDefault(key, defaultValue string) string {
+	setting := Setting{Key: key, Value: defaultValue, Origin: OriginDefault}
+	layers := []struct {
+		origin string
+		lookup func(string) string
+	}{
+		{OriginEnv, os.Getenv},
+		{OriginFile, func(key string) string { return s.file[key] }},
+	}
+	for _, layer := range layers {
+		value, path := layer.lookup(key), ""
+		if hasFileVariant(key) {
+			path = layer.lookup(key + "_FILE")
+		}
+		if path != "" {
+			if value != "" {
+				s.fail(fmt.Errorf("%s and %s_FILE are both set in the %s", key, key, layerName(layer.origin)))
+			}
+			secret, err := readSecretFile(path)
+			if err != nil {
+				s.fail(fmt.Errorf("failed to read %s_FILE: %w", key, err))
+			}
+			setting.Value, setting.Origin, setting.File = secret, layer.origin, path
+			break
+		}
+		if value != "" {
+			setting.Value, setting.Origin = value, layer.origin
+			break
+		}
+	}
+	s.settings = append(s.settings, setting)
+	return setting.Value
+}
+
+// fail records the first error of the source
+func (s *source) fail(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// layerName describes where a value of origin was set
+func layerName(origin string) string {
+	if origin == OriginEnv {
+		return "environment"
+	}
+	return "config file"
+}
+
+// readSecretFile reads a secret without the trailing newline most secret files end with
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// get returns the value of key, or empty if it is not set
+func (s *source) get(key string) string {
+	return s.getOrDefault(key, "")
+}
+
+// checkUnknown rejects config file keys that were never looked up, which are most likely typos
+func (s *source) checkUnknown() error {
+	known := make(map[string]bool, len(s.settings))
+	for _, setting := range s.settings {
+		known[setting.Key] = true
+		if hasFileVariant(setting.Key) {
+			known[setting.Key+"_FILE"] = true
+		}
+	}
+	var unknown []string
+	for key := range s.file {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown keys in config file %s: %s", s.path, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// Settings returns every configuration key with its resolved value and origin, in load order
+func (c *Config) Settings() []Setting {
+	return append([]Setting(nil), c.settings...)
+}
+
+// setting returns the resolved setting of key
+func (c *Config) setting(key string) (Setting, bool) {
+	for _, setting := range c.settings {
+		if setting.Key == key {
+			return setting, true
+		}
+	}
+	return Setting{}, false
+}
+
+// SecretFiles returns the files secrets were read from
+func (c *Config) SecretFiles() []string {
+	var paths []string
+	for _, setting := range c.settings {
+		if setting.File != "" {
+			paths = append(paths, setting.File)
+		}
+	}
+	return paths
+}
+
+// Print writes the effective configuration as a YAML config file with secrets redacted.
+// Secrets read from files are printed as their <key>_FILE. Each value is commented with its origin.
+func (c *Config) Print(w io.Writer) error {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, setting := range c.settings {
+		key, value := setting.Key, setting.Redacted()
+		if setting.File != "" {
+			key, value = setting.Key+"_FILE", setting.File
+		}
+		doc.Content = append(doc.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, LineComment: setting.Origin},
+		)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to print configuration: %w", err)
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// validate checks URL schemes, value ranges and the secrets each enabled feature needs
+func (c *Config) validate() error {
+	type urlSetting struct {
+		key      string
+		value    string
+		schemes  []string
+		optional bool
+	}
+	httpSchemes := []string{"http", "https"}
+	urls := []urlSetting{
+		{"RABBITMQ_URL", c.RabbitMQ.URL, []string{"amqp", "amqps"}, false},
+		{"NEXTCLOUD_URL", c.Nextcloud.URL, httpSchemes, false},
+		{"PARSER_URL", c.Parser.URL, httpSchemes, true},
+		{"REDIS_URL", c.Redis.URL, []string{"redis", "rediss"}, false},
+		{"QDRANT_URL", c.Qdrant.URL, httpSchemes, false},
+		{"OLLAMA_URL", c.Embedding.OllamaURL, httpSchemes, false},
+		{"OPENAI_URL", c.Embedding.OpenAIURL, httpSchemes, false},
+	}
+	// lib/pq also accepts key=value connection strings, which are not URLs
+	if strings.Contains(c.JobStore.PostgresURL, "://") {
+		urls = append(urls, urlSetting{"JOB_STORE_POSTGRES_URL", c.JobStore.PostgresURL, []string{"postgres", "postgresql"}, false})
+	}
+	for _, item := range urls {
+		if item.optional && item.value == "" {
+			continue
+		}
+		if err := validateURL(item.key, item.value, item.schemes); err != nil {
+			return err
+		}
+	}
+
+	positiveDurations := []struct {
+		key   string
+		value time.Duration
+	}{
+		{"WORKER_ADAPTIVE_TARGET_LATENCY", c.Worker.AdaptiveTargetLatency},
+		{"WORKER_SHUTDOWN_TIMEOUT", c.Worker.ShutdownTimeout},
+		{"POLLER_SCAN_INTERVAL", c.Poller.ScanInterval},
+		{"POLLER_MIN_BACKOFF", c.Poller.MinBackoff},
+		{"POLLER_MAX_BACKOFF", c.Poller.MaxBackoff},
+	}
+	for _, item := range positiveDurations {
+		if item.value <= 0 {
+			return fmt.Errorf("invalid %s: %v (must be positive)", item.key, item.value)
+		}
+	}
+	for _, delay := range c.Worker.RetryDelays {
+		if delay <= 0 {
+			return fmt.Errorf("invalid WORKER_RETRY_DELAYS: %v (must be positive)", delay)
+		}
+	}
+	if c.Poller.MaxBackoff < c.Poller.MinBackoff {
+		return fmt.Errorf("invalid POLLER_MAX_BACKOFF: %v (must not be below POLLER_MIN_BACKOFF)", c.Poller.MaxBackoff)
+	}
+
+	positiveInts := []struct {
+		key   string
+		value int
+	}{
+		{"INGEST_MAX_TEXT_CHARS", c.Ingest.MaxTextChars},
+		{"QUERY_CHUNK_LIMIT", c.Query.ChunkLimit},
+		{"QUERY_QA_LIMIT", c.Query.QALimit},
+		{"QUERY_MAX_SNIPPETS", c.Query.MaxSnippets},
+		{"LLM_MAX_CONTEXT_TOKENS", c.LLM.MaxContextTokens},
+		{"LLM_MAX_ANSWER_TOKENS", c.LLM.MaxAnswerTokens},
+		{"TALK_BOT_CONCURRENCY", c.Talk.Concurrency},
+	}
+	for _, item := range positiveInts {
+		if item.value < 1 {
+			return fmt.Errorf("invalid %s: %d (must be at least 1)", item.key, item.value)
+		}
+	}
+	if c.Worker.MaxRetries < 0 {
+		return fmt.Errorf("invalid WORKER_MAX_RETRIES: %d (must not be negative)", c.Worker.MaxRetries)
+	}
+	if c.Embedding.Dimension < 0 {
+		return fmt.Errorf("invalid EMBED_DIMENSION: %d (must not be negative)", c.Embedding.Dimension)
+	}
+	if c.Query.ScoreThreshold < 0 || c.Query.ScoreThreshold > 1 {
+		return fmt.Errorf("invalid QUERY_SCORE_THRESHOLD: %v (must be between 0 and 1)", c.Query.ScoreThreshold)
+	}
+	for _, mimeType := range c.Worker.MimeTypes {
+		if !strings.Contains(mimeType, "/") {
+			return fmt.Errorf("invalid WORKER_MIME_TYPES: %s is not a MIME type", mimeType)
+		}
+	}
+
+	// The hosted OpenAI API rejects unauthenticated requests; compatible self-hosted servers may not need a key
+	usesOpenAI := (c.Ingest.Enabled && c.Embedding.Provider == "openai") || c.LLM.Provider == "openai"
+	if usesOpenAI && c.Embedding.OpenAIAPIKey == "" && isOpenAIHosted(c.Embedding.OpenAIURL) {
+		return fmt.Errorf("OPENAI_API_KEY is required for the openai provider at %s", c.Embedding.OpenAIURL)
+	}
+
+	return nil
+}
+
+// ValidateWorker checks the settings only the worker needs
+func (c *Config) ValidateWorker() error {
+	if c.Parser.URL == "" {
+		return fmt.Errorf("PARSER_URL is required")
+	}
+	// The secret authenticates parser calls and signs the parser webhook, which completes jobs
+	if c.Parser.Secret == "" {
+		return fmt.Errorf("PARSER_SECRET or PARSER_SECRET_FILE is required")
+	}
+	return nil
+}
+
+// validateURL checks that value is an absolute URL with a host and one of schemes
+func validateURL(key, value string, schemes []string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		// The parse error quotes the URL, which may contain a password
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid %s: %s (must be an absolute URL)", key, Setting{Key: key, Value: value}.Redacted())
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid %s: scheme %q (must be %s)", key, u.Scheme, strings.Join(schemes, " or "))
+}
+
+// isOpenAIHosted checks if rawURL points at the hosted OpenAI API
+func isOpenAIHosted(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && strings.HasSuffix(u.Hostname(), "openai.com")
+}
@@ -0,0 +1,131 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// adaptiveWindow is the number of parser calls observed before the limit is adjusted
+const adaptiveWindow = 10
+
+// adaptiveLimiter bounds how many deliveries are processed at once.
+// The limit grows by one while parser calls are fast and healthy, and halves
+// when the average latency or the error rate of a window exceeds the targets (AIMD).
+type adaptiveLimiter struct {
+	mu       sync.Mutex
+	changed  chan struct{}
+	limit    int
+	maxLimit int
+	inFlight int
+	// onChange is called with the new limit after it was adjusted, without holding mu
+	onChange func(limit int)
+
+	targetLatency time.Duration
+	maxErrorRate  float64
+
+	samples      int
+	errors       int
+	totalLatency time.Duration
+}
+
+// newAdaptiveLimiter creates a limiter that starts at maxLimit; onChange may be nil
+func newAdaptiveLimiter(maxLimit int, targetLatency time.Duration, maxErrorRate float64, onChange func(limit int)) *adaptiveLimiter {
+	return &adaptiveLimiter{
+		changed:       make(chan struct{}),
+		limit:         maxLimit,
+		maxLimit:      maxLimit,
+		onChange:      onChange,
+		targetLatency: targetLatency,
+		maxErrorRate:  maxErrorRate,
+	}
+}
+
+// Acquire blocks until a processing slot is free or ctx is cancelled
+func (l *adaptiveLimiter) Acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inFlight < l.limit {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Release frees a processing slot
+func (l *adaptiveLimiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	l.notify()
+}
+
+// Observe records the latency and outcome of a parser call and adjusts the limit per window
+func (l *adaptiveLimiter) Observe(latency time.Duration, failed bool) {
+	if limit, changed := l.observe(latency, failed); changed && l.onChange != nil {
+		l.onChange(limit)
+	}
+}
+
+// observe records a sample and reports the limit and whether it changed
+func (l *adaptiveLimiter) observe(latency time.Duration, failed bool) (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.samples++
+	l.totalLatency += latency
+	if failed {
+		l.errors++
+	}
+	if l.samples < adaptiveWindow {
+		return l.limit, false
+	}
+
+	avgLatency := l.totalLatency / time.Duration(l.samples)
+	errorRate := float64(l.errors) / float64(l.samples)
+	l.samples, l.errors, l.totalLatency = 0, 0, 0
+
+	previous := l.limit
+	if avgLatency > l.targetLatency || errorRate > l.maxErrorRate {
+		l.limit = max(1, l.limit/2)
+	} else if l.limit < l.maxLimit {
+		l.limit++
+	}
+	if l.limit == previous {
+		return l.limit, false
+	}
+
+	log.WithFields(log.Fields{
+		"previous_limit": previous,
+		"limit":          l.limit,
+		"avg_latency":    avgLatency.String(),
+		"error_rate":     errorRate,
+	}).Info("Adjusted in-flight limit")
+	l.notify()
+	return l.limit, true
+}
+
+// Limit returns the current in-flight limit
+func (l *adaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// notify wakes up waiting workers; callers must hold mu
+func (l *adaptiveLimiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
@@ -0,0 +1,120 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// feedWindow observes one full window of samples, the first failures of which failed
+func feedWindow(l *adaptiveLimiter, latency time.Duration, failures int) {
+	for i := 0; i < adaptiveWindow; i++ {
+		l.Observe(latency, i < failures)
+	}
+}
+
+func TestAdaptiveLimiterWindow(t *testing.T) {
+	var changes []int
+	l := newAdaptiveLimiter(8, 100*time.Millisecond, 0.2, func(limit int) { changes = append(changes, limit) })
+
+	// A slow window only takes effect once it is complete
+	for i := 0; i < adaptiveWindow-1; i++ {
+		if limit, changed := l.observe(time.Second, false); changed || limit != 8 {
+			t.Fatalf("sample %d: observe = (%d, %v), want (8, false)", i, limit, changed)
+		}
+	}
+	l.Observe(time.Second, false)
+
+	if got := l.Limit(); got != 4 {
+		t.Fatalf("Limit after slow window = %d, want 4", got)
+	}
+	if len(changes) != 1 || changes[0] != 4 {
+		t.Fatalf("onChange calls = %v, want [4]", changes)
+	}
+}
+
+func TestAdaptiveLimiterAdjust(t *testing.T) {
+	const target = 100 * time.Millisecond
+
+	tests := []struct {
+		name     string
+		start    int
+		latency  time.Duration
+		failures int
+		want     int
+	}{
+		{name: "slow halves", start: 8, latency: 2 * target, want: 4},
+		{name: "errors halve", start: 8, latency: target / 2, failures: 3, want: 4},
+		{name: "error rate at the maximum increases", start: 4, latency: target / 2, failures: 2, want: 5},
+		{name: "latency at the target increases", start: 4, latency: target, want: 5},
+		{name: "healthy increases", start: 4, latency: target / 2, want: 5},
+		{name: "increase stops at max", start: 8, latency: target / 2, want: 8},
+		{name: "decrease stops at one", start: 1, latency: 2 * target, want: 1},
+		{name: "odd limit rounds down", start: 3, latency: 2 * target, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newAdaptiveLimiter(8, target, 0.2, nil)
+			l.limit = tt.start
+
+			feedWindow(l, tt.latency, tt.failures)
+
+			if got := l.Limit(); got != tt.want {
+				t.Fatalf("Limit = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdaptiveLimiterRecovers(t *testing.T) {
+	var changes []int
+	l := newAdaptiveLimiter(4, 100*time.Millisecond, 0.1, func(limit int) { changes = append(changes, limit) })
+
+	feedWindow(l, time.Second, 0)
+	feedWindow(l, 10*time.Millisecond, adaptiveWindow)
+	for i := 0; i < 5; i++ {
+		feedWindow(l, 10*time.Millisecond, 0)
+	}
+
+	want := []int{2, 1, 2, 3, 4}
+	if len(changes) != len(want) {
+		t.Fatalf("onChange calls = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("onChange calls = %v, want %v", changes, want)
+		}
+	}
+}
+
+func TestAdaptiveLimiterAcquire(t *testing.T) {
+	l := newAdaptiveLimiter(2, 100*time.Millisecond, 0.1, nil)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := l.Acquire(ctx); err != nil {
+			t.Fatalf("Acquire %d: %v", i, err)
+		}
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := l.Acquire(cancelled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Acquire at the limit = %v, want context.Canceled", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- l.Acquire(ctx) }()
+	l.Release()
+
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("Acquire after Release: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Acquire did not wake up after Release")
+	}
+}
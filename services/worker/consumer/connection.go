@@ -0,0 +1,188 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+
+	"nc-rag-worker/broker"
+
+	"github.com/rabbitmq/amqp091-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// connect opens the consume and publish channels on the shared connection and declares the topology
+func (c *RabbitMQConsumer) connect() error {
+	var opened []*amqp091.Channel
+	fail := func(err error) error {
+		for _, channel := range opened {
+			channel.Close()
+		}
+		return err
+	}
+
+	// Create channel
+	channel, err := c.amqp.Channel()
+	if err != nil {
+		return err
+	}
+	opened = append(opened, channel)
+
+	// Consume on the shared channel, or on one channel per worker
+	consumeChans := []*amqp091.Channel{channel}
+	if c.perWorker {
+		consumeChans = make([]*amqp091.Channel, 0, c.concurrency)
+		for i := 0; i < c.concurrency; i++ {
+			workerChannel, err := c.amqp.Channel()
+			if err != nil {
+				return fail(fmt.Errorf("failed to create RabbitMQ worker channel: %w", err))
+			}
+			opened = append(opened, workerChannel)
+			consumeChans = append(consumeChans, workerChannel)
+		}
+	}
+
+	// Set QoS (prefetch count)
+	for i, consumeChannel := range consumeChans {
+		if err := setQos(consumeChannel, c.channelPrefetch(i)); err != nil {
+			return fail(err)
+		}
+	}
+
+	// Separate channel in confirm mode for retries and dead-lettering
+	publishChannel, err := c.amqp.Channel()
+	if err != nil {
+		return fail(fmt.Errorf("failed to create RabbitMQ publish channel: %w", err))
+	}
+	opened = append(opened, publishChannel)
+	if err := publishChannel.Confirm(false); err != nil {
+		return fail(fmt.Errorf("failed to enable publisher confirms: %w", err))
+	}
+
+	// Declare queue (ensure it exists); a restarted broker may have lost non-durable state
+	_, err = channel.QueueDeclare(
+		c.queueName, // name
+		true,        // durable
+		false,       // delete when unused
+		false,       // exclusive
+		false,       // no-wait
+		nil,         // arguments
+	)
+	if err != nil {
+		return fail(fmt.Errorf("failed to declare queue: %w", err))
+	}
+
+	// Declare retry and dead-letter queues
+	if err := c.retrier.Declare(channel); err != nil {
+		return fail(err)
+	}
+
+	// Declare the debounce delay queue
+	if err := c.declareDebounceTopology(channel); err != nil {
+		return fail(err)
+	}
+
+	c.connMu.Lock()
+	c.publishMu.Lock()
+	c.channel = channel
+	c.consumeChans = consumeChans
+	c.publishChannel = publishChannel
+	c.publishMu.Unlock()
+	c.connMu.Unlock()
+	return nil
+}
+
+// channelPrefetch returns the prefetch of the i-th consume channel for the current in-flight limit.
+// WORKER_PREFETCH is per worker, so the shared channel gets prefetch*limit. Per-worker channels
+// beyond the limit keep a prefetch of 1, because 0 would mean unlimited.
+func (c *RabbitMQConsumer) channelPrefetch(i int) int {
+	limit := c.concurrency
+	if c.limiter != nil {
+		limit = c.limiter.Limit()
+	}
+	if !c.perWorker {
+		return c.prefetch * limit
+	}
+	if i < limit {
+		return c.prefetch
+	}
+	return 1
+}
+
+// setQos sets the prefetch of a consume channel. The limit is set for the whole channel,
+// which RabbitMQ applies to running consumers as well; each channel has a single consumer.
+func setQos(channel *amqp091.Channel, prefetch int) error {
+	if err := channel.Qos(prefetch, 0, true); err != nil {
+		return fmt.Errorf("failed to set QoS: %w", err)
+	}
+	return nil
+}
+
+// adjustQos updates the prefetch of the consume channels after the adaptive limit changed,
+// so workers waiting for a slot do not hold on to deliveries other consumers could take
+func (c *RabbitMQConsumer) adjustQos(limit int) {
+	c.connMu.RLock()
+	consumeChans := c.consumeChans
+	c.connMu.RUnlock()
+
+	for i, channel := range consumeChans {
+		if err := setQos(channel, c.channelPrefetch(i)); err != nil {
+			// A closed channel ends the session; the next one starts with the current limit
+			log.WithError(err).WithField("limit", limit).Warn("Failed to adjust consumer prefetch")
+			return
+		}
+	}
+}
+
+// reopen waits for the shared connection and reopens the channels with backoff,
+// until it succeeds or ctx is cancelled
+func (c *RabbitMQConsumer) reopen(ctx context.Context) error {
+	return broker.Retry(ctx, "Reopening RabbitMQ consumer channels", func() error {
+		if err := c.amqp.Wait(ctx); err != nil {
+			return err
+		}
+		return c.connect()
+	})
+}
+
+// closeChannels closes the consumer's channels, ignoring errors from already closed ones.
+// The shared connection stays open for the other components.
+func (c *RabbitMQConsumer) closeChannels() {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+
+	if c.publishChannel != nil {
+		c.publishChannel.Close()
+	}
+	for _, consumeChannel := range c.consumeChans {
+		consumeChannel.Close()
+	}
+	if c.channel != nil {
+		c.channel.Close()
+	}
+}
+
+// Close closes the consumer's channels
+func (c *RabbitMQConsumer) Close() error {
+	c.closeChannels()
+	return nil
+}
+
+// Health checks the shared connection and the consumer's channels
+func (c *RabbitMQConsumer) Health(ctx context.Context) error {
+	if err := c.amqp.Health(ctx); err != nil {
+		return err
+	}
+
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+
+	if c.channel == nil || c.channel.IsClosed() {
+		return fmt.Errorf("RabbitMQ channel is closed")
+	}
+	for _, consumeChannel := range c.consumeChans {
+		if consumeChannel.IsClosed() {
+			return fmt.Errorf("RabbitMQ worker channel is closed")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+
+	"nc-rag-worker/broker"
+	"nc-rag-worker/metrics"
+	"nc-rag-worker/models"
+
+	"github.com/rabbitmq/amqp091-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// debounceSeqHeader carries the file event sequence number of a delayed event
+const debounceSeqHeader = "x-debounce-seq"
+
+// debounceQueueName returns the name of the delay queue that holds events for the quiet window.
+// The window is part of the name because queue arguments cannot change after declaration.
+func (c *RabbitMQConsumer) debounceQueueName() string {
+	return fmt.Sprintf("%s.debounce.%s", c.queueName, c.debounceWindow)
+}
+
+// declareDebounceTopology declares the TTL'd debounce queue, which dead-letters
+// expired events back to the main queue through the default exchange
+func (c *RabbitMQConsumer) declareDebounceTopology(channel *amqp091.Channel) error {
+	if c.debounceWindow <= 0 {
+		return nil
+	}
+	args := amqp091.Table{
+		"x-message-ttl":             c.debounceWindow.Milliseconds(),
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": c.queueName,
+	}
+	if _, err := channel.QueueDeclare(c.debounceQueueName(), true, false, false, false, args); err != nil {
+		return fmt.Errorf("failed to declare debounce queue: %w", err)
+	}
+	return nil
+}
+
+// shouldDebounce reports whether a fresh create/update event must wait out the quiet window
+func (c *RabbitMQConsumer) shouldDebounce(event *models.FileEvent, msg amqp091.Delivery) bool {
+	if c.debounceWindow <= 0 || !event.IsCreateOrUpdateEvent() || !c.ncClient.IsProcessableFile(event.File.MimeType) {
+		return false
+	}
+	_, delayed := debounceSeqFromHeaders(msg.Headers)
+	return !delayed
+}
+
+// debounce registers the event as the file's latest update and parks a copy in the
+// debounce queue. Each new update restarts the window, because only the copy holding
+// the latest sequence number is processed when it comes back.
+func (c *RabbitMQConsumer) debounce(ctx context.Context, event *models.FileEvent, msg amqp091.Delivery, logger *log.Entry) error {
+	seq, err := c.storage.RegisterFileEvent(ctx, event.Tenant, event.File.ID)
+	if err != nil {
+		return err
+	}
+
+	headers := broker.CopyHeaders(msg.Headers)
+	headers[debounceSeqHeader] = seq
+	if err := c.publish(ctx, "", c.debounceQueueName(), msg, headers); err != nil {
+		return fmt.Errorf("failed to delay event: %w", err)
+	}
+
+	metrics.DebounceTotal.WithLabelValues("delayed").Inc()
+	logger.WithFields(log.Fields{
+		"debounce_seq":    seq,
+		"debounce_window": c.debounceWindow.String(),
+	}).Debug("Delayed file event for quiet window")
+	return nil
+}
+
+// isCoalesced reports whether a delayed event was superseded by a later update of the same file
+func (c *RabbitMQConsumer) isCoalesced(ctx context.Context, event *models.FileEvent, msg amqp091.Delivery) (bool, error) {
+	seq, delayed := debounceSeqFromHeaders(msg.Headers)
+	if !delayed {
+		return false, nil
+	}
+	latest, err := c.storage.LatestFileEventSeq(ctx, event.Tenant, event.File.ID)
+	if err != nil {
+		return false, err
+	}
+	return seq < latest, nil
+}
+
+// supersedeDebounced advances the file's sequence number, so updates still parked in the
+// debounce queue are coalesced away instead of failing on a file that no longer exists
+func (c *RabbitMQConsumer) supersedeDebounced(ctx context.Context, event *models.FileEvent) error {
+	if _, err := c.storage.RegisterFileEvent(ctx, event.Tenant, event.File.ID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// debounceSeqFromHeaders reads the debounce sequence number of a delayed event
+func debounceSeqFromHeaders(headers amqp091.Table) (int64, bool) {
+	switch v := headers[debounceSeqHeader].(type) {
+	case int64:
+		return v, true
+	case int32:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,50 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+
+	"nc-rag-worker/config"
+	"nc-rag-worker/models"
+	"nc-rag-worker/storage"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+func TestDeleteSupersedesParkedUpdate(t *testing.T) {
+	ctx := context.Background()
+	redisServer := miniredis.RunT(t)
+	redisStorage, err := storage.NewRedisStorage("redis://"+redisServer.Addr(), config.RetentionConfig{})
+	if err != nil {
+		t.Fatalf("NewRedisStorage: %v", err)
+	}
+	c := &RabbitMQConsumer{storage: redisStorage}
+
+	event := &models.FileEvent{Tenant: "acme", File: models.FileInfo{ID: 42}}
+	seq, err := redisStorage.RegisterFileEvent(ctx, event.Tenant, event.File.ID)
+	if err != nil {
+		t.Fatalf("RegisterFileEvent: %v", err)
+	}
+	parked := amqp091.Delivery{Headers: amqp091.Table{debounceSeqHeader: seq}}
+
+	coalesced, err := c.isCoalesced(ctx, event, parked)
+	if err != nil || coalesced {
+		t.Fatalf("isCoalesced before delete = (%v, %v), want (false, nil)", coalesced, err)
+	}
+
+	if err := c.supersedeDebounced(ctx, event); err != nil {
+		t.Fatalf("supersedeDebounced: %v", err)
+	}
+
+	coalesced, err = c.isCoalesced(ctx, event, parked)
+	if err != nil || !coalesced {
+		t.Fatalf("isCoalesced after delete = (%v, %v), want (true, nil)", coalesced, err)
+	}
+
+	// Events that never went through the debounce queue are not affected
+	coalesced, err = c.isCoalesced(ctx, event, amqp091.Delivery{})
+	if err != nil || coalesced {
+		t.Fatalf("isCoalesced of undelayed event = (%v, %v), want (false, nil)", coalesced, err)
+	}
+}
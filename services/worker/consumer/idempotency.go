@@ -0,0 +1,110 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"nc-rag-worker/models"
+	"nc-rag-worker/storage"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// errClaimBusy is returned when another worker is processing the same event or file.
+// It is transient, so the message goes through the retry queues and is re-checked later.
+var errClaimBusy = errors.New("being processed by another worker")
+
+// claimEvent claims the event ID so redeliveries are processed once.
+// It returns skip=true for events that were already processed. Otherwise the caller
+// must call finish with the processing error to record or release the claim.
+func (c *RabbitMQConsumer) claimEvent(ctx context.Context, event *models.FileEvent, logger *log.Entry) (finish func(error), skip bool, err error) {
+	if event.EventID == "" {
+		return func(error) {}, false, nil
+	}
+
+	token := models.NewTraceID()
+	claim, err := c.storage.ClaimEvent(ctx, event.EventID, token)
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch claim {
+	case storage.ClaimDuplicate:
+		logger.Info("Event already processed, skipping redelivery")
+		return nil, true, nil
+	case storage.ClaimBusy:
+		return nil, false, fmt.Errorf("event %s is %w", event.EventID, errClaimBusy)
+	}
+
+	finish = func(procErr error) {
+		if procErr != nil {
+			// Let the retried copy claim the event again
+			if err := c.storage.ReleaseEvent(ctx, event.EventID, token); err != nil {
+				logger.WithError(err).Warn("Failed to release event claim")
+			}
+			return
+		}
+		if err := c.storage.CompleteEvent(ctx, event.EventID, token); err != nil {
+			logger.WithError(err).Warn("Failed to record processed event")
+		}
+	}
+	return finish, false, nil
+}
+
+// supersedePreviousJob marks the file's previous job as replaced by newJobID,
+// so its late completion is neither ingested nor overwrites the new version's points.
+// record is the file's record, if it has one; it names the previous job once that was archived.
+func (c *RabbitMQConsumer) supersedePreviousJob(ctx context.Context, fileID int64, newJobID string, record *models.FileRecord, logger *log.Entry) error {
+	previous, err := c.jobs.GetJobByFileID(ctx, fileID)
+	if err != nil {
+		if errors.Is(err, storage.ErrJobNotFound) {
+			c.cancelArchivedJob(ctx, record, logger)
+			return nil
+		}
+		return fmt.Errorf("failed to get previous job: %w", err)
+	}
+	if previous.JobID == newJobID || previous.Status == models.JobStatusSuperseded {
+		return nil
+	}
+
+	// Stop the parser working on a version nobody will ingest; not every parser supports it
+	if !previous.IsFinal() {
+		c.cancelParserJob(ctx, previous.JobID, logger)
+	}
+
+	if err := c.jobs.SupersedeJob(ctx, previous.JobID, newJobID); err != nil {
+		return fmt.Errorf("failed to supersede previous job: %w", err)
+	}
+
+	logger.WithFields(log.Fields{
+		"previous_job_id": previous.JobID,
+		"job_id":          newJobID,
+	}).Info("Superseded previous job of file")
+	return nil
+}
+
+// cancelArchivedJob cancels the file's last job at the parser if it was archived before it finished.
+// Its completion is ignored because the job no longer exists, so the parser's work would be wasted.
+func (c *RabbitMQConsumer) cancelArchivedJob(ctx context.Context, record *models.FileRecord, logger *log.Entry) {
+	if record == nil || record.LastJobID == "" {
+		return
+	}
+	if record.LastStatus == models.JobStatusSubmitted || record.LastStatus == models.JobStatusProcessing {
+		c.cancelParserJob(ctx, record.LastJobID, logger)
+	}
+}
+
+// cancelParserJob asks the parser to cancel a job, logging instead of failing
+func (c *RabbitMQConsumer) cancelParserJob(ctx context.Context, jobID string, logger *log.Entry) {
+	logger = logger.WithField("previous_job_id", jobID)
+	cancelled, err := c.parserClient.CancelJob(ctx, jobID)
+	switch {
+	case err != nil:
+		logger.WithError(err).Warn("Failed to cancel superseded parser job")
+	case cancelled:
+		logger.Info("Cancelled superseded parser job")
+	default:
+		logger.Debug("Parser did not cancel superseded job")
+	}
+}
@@ -3,153 +3,328 @@ package consumer
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"nc-rag-worker/acl"
+	"nc-rag-worker/broker"
+	"nc-rag-worker/config"
+	"nc-rag-worker/metrics"
 	"nc-rag-worker/models"
 	"nc-rag-worker/nextcloud"
 	"nc-rag-worker/parser"
+	"nc-rag-worker/qdrant"
 	"nc-rag-worker/storage"
+	"nc-rag-worker/tracing"
 
 	"github.com/rabbitmq/amqp091-go"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // RabbitMQConsumer handles consuming messages from RabbitMQ
 type RabbitMQConsumer struct {
-	conn         *amqp091.Connection
-	channel      *amqp091.Channel
-	queueName    string
-	ncClient     *nextcloud.Client
-	parserClient *parser.Client
-	storage      *storage.RedisStorage
-	concurrency  int
-	wg           sync.WaitGroup
+	amqp            *broker.Connection
+	channel         *amqp091.Channel
+	consumeChans    []*amqp091.Channel
+	publishChannel  *amqp091.Channel
+	connMu          sync.RWMutex
+	publishMu       sync.Mutex
+	queueName       string
+	ncClient        *nextcloud.Client
+	parserClient    *parser.Client
+	storage         *storage.RedisStorage
+	jobs            storage.JobStore
+	qdrant          *qdrant.Client
+	acl             *acl.Manager
+	concurrency     int
+	prefetch        int
+	perWorker       bool
+	limiter         *adaptiveLimiter
+	retrier         *broker.Retrier
+	shutdownTimeout time.Duration
+	debounceWindow  time.Duration
+	draining        atomic.Bool
+	resize          chan workerSettings
+	wg              sync.WaitGroup
 }
 
-// NewRabbitMQConsumer creates a new RabbitMQ consumer
+// NewRabbitMQConsumer creates a new RabbitMQ consumer on the shared connection
 func NewRabbitMQConsumer(
-	amqpURL, queueName string,
+	amqp *broker.Connection,
+	queueName string,
 	ncClient *nextcloud.Client,
 	parserClient *parser.Client,
 	storage *storage.RedisStorage,
-	concurrency int,
+	jobs storage.JobStore,
+	qdrantClient *qdrant.Client,
+	workerCfg config.WorkerConfig,
 ) (*RabbitMQConsumer, error) {
-	// Connect to RabbitMQ
-	conn, err := amqp091.Dial(amqpURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	c := &RabbitMQConsumer{
+		amqp:            amqp,
+		queueName:       queueName,
+		ncClient:        ncClient,
+		parserClient:    parserClient,
+		storage:         storage,
+		jobs:            jobs,
+		qdrant:          qdrantClient,
+		acl:             acl.NewManager(qdrantClient, storage),
+		concurrency:     workerCfg.Concurrency,
+		prefetch:        workerCfg.Prefetch,
+		perWorker:       workerCfg.ChannelPerWorker,
+		retrier:         broker.NewRetrier(queueName, workerCfg.MaxRetries, workerCfg.RetryDelays),
+		shutdownTimeout: workerCfg.ShutdownTimeout,
+		debounceWindow:  workerCfg.DebounceWindow,
+		resize:          make(chan workerSettings, 1),
+	}
+	if workerCfg.Adaptive {
+		c.limiter = newAdaptiveLimiter(workerCfg.Concurrency, workerCfg.AdaptiveTargetLatency, workerCfg.AdaptiveMaxErrorRate, c.adjustQos)
 	}
 
-	// Create channel
-	channel, err := conn.Channel()
-	if err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to create RabbitMQ channel: %w", err)
-	}
-
-	// Set QoS (prefetch count)
-	if err := channel.Qos(1, 0, false); err != nil {
-		channel.Close()
-		conn.Close()
-		return nil, fmt.Errorf("failed to set QoS: %w", err)
-	}
-
-	return &RabbitMQConsumer{
-		conn:         conn,
-		channel:      channel,
-		queueName:    queueName,
-		ncClient:     ncClient,
-		parserClient: parserClient,
-		storage:      storage,
-		concurrency:  concurrency,
-	}, nil
+	// Fail fast on startup; later channel and connection losses are recovered by Start
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
 }
 
-// Start starts consuming messages
+// ErrDrainTimeout is returned by Start when in-flight messages did not finish before the shutdown timeout
+var ErrDrainTimeout = errors.New("shutdown timeout exceeded while draining in-flight messages")
+
+// Start starts consuming messages and keeps consuming across broker restarts.
+// When ctx is cancelled it stops consuming, lets in-flight messages finish up to
+// the shutdown timeout and requeues everything else before returning.
 func (c *RabbitMQConsumer) Start(ctx context.Context) error {
 	log.WithFields(log.Fields{
-		"queue":       c.queueName,
-		"concurrency": c.concurrency,
+		"queue":              c.queueName,
+		"concurrency":        c.concurrency,
+		"prefetch":           c.prefetch,
+		"channel_per_worker": c.perWorker,
+		"adaptive":           c.limiter != nil,
 	}).Info("Starting RabbitMQ consumer")
 
-	// Declare queue (ensure it exists)
-	_, err := c.channel.QueueDeclare(
-		c.queueName, // name
-		true,        // durable
-		false,       // delete when unused
-		false,       // exclusive
-		false,       // no-wait
-		nil,         // arguments
-	)
-	if err != nil {
-		return fmt.Errorf("failed to declare queue: %w", err)
-	}
-
-	// Start consuming
-	msgs, err := c.channel.Consume(
-		c.queueName, // queue
-		"",          // consumer
-		false,       // auto-ack (we'll ack manually)
-		false,       // exclusive
-		false,       // no-local
-		false,       // no-wait
-		nil,         // args
-	)
-	if err != nil {
-		return fmt.Errorf("failed to register consumer: %w", err)
+	// In-flight work must not be cancelled by the shutdown signal, only by the drain deadline
+	procCtx, abort := context.WithCancel(context.WithoutCancel(ctx))
+	defer abort()
+
+	drained := make(chan struct{})
+	defer close(drained)
+	go func() {
+		select {
+		case <-drained:
+			return
+		case <-ctx.Done():
+		}
+		select {
+		case <-drained:
+		case <-time.After(c.shutdownTimeout):
+			log.WithField("shutdown_timeout", c.shutdownTimeout.String()).Warn("Drain deadline reached, aborting in-flight messages")
+			abort()
+		}
+	}()
+
+	for {
+		err := c.consume(ctx, procCtx)
+		if ctx.Err() != nil {
+			if procCtx.Err() != nil {
+				return ErrDrainTimeout
+			}
+			log.Info("All workers stopped")
+			return nil
+		}
+
+		if errors.Is(err, errReconfigured) {
+			// Reopen the channels right away with the new settings; fall back to backoff if that fails
+			if err := c.connect(); err == nil {
+				continue
+			}
+		}
+
+		log.WithError(err).Warn("RabbitMQ consumer session ended, reopening channels")
+		if err := c.reopen(ctx); err != nil {
+			// Only returns when the context is cancelled
+			return nil
+		}
+	}
+}
+
+// consume runs one consumer session on the current channels until the context
+// is cancelled or a channel closes, and waits for all workers to exit.
+// Messages are processed with procCtx, which outlives ctx until the drain deadline.
+func (c *RabbitMQConsumer) consume(ctx, procCtx context.Context) error {
+	c.connMu.RLock()
+	consumeChans, publishChannel := c.consumeChans, c.publishChannel
+	c.connMu.RUnlock()
+
+	// Any closed channel ends the session, including when the shared connection is lost;
+	// graceful closes during shutdown are ignored
+	closed := make(chan error, len(consumeChans)+1)
+	watch := func(notify chan *amqp091.Error, what string) {
+		go func() {
+			if amqpErr, ok := <-notify; ok {
+				closed <- fmt.Errorf("%s closed: %v", what, amqpErr)
+			}
+		}()
+	}
+	watch(publishChannel.NotifyClose(make(chan *amqp091.Error, 1)), "publish channel")
+	for _, channel := range consumeChans {
+		watch(channel.NotifyClose(make(chan *amqp091.Error, 1)), "channel")
+	}
+
+	// Start consuming, one consumer per channel
+	deliveries := make([]<-chan amqp091.Delivery, 0, len(consumeChans))
+	for i, channel := range consumeChans {
+		msgs, err := channel.Consume(
+			c.queueName,    // queue
+			consumerTag(i), // consumer
+			false,          // auto-ack (we'll ack manually)
+			false,          // exclusive
+			false,          // no-local
+			false,          // no-wait
+			nil,            // args
+		)
+		if err != nil {
+			c.closeChannels()
+			return fmt.Errorf("failed to register consumer: %w", err)
+		}
+		deliveries = append(deliveries, msgs)
 	}
 
-	// Start worker goroutines
+	// Start worker goroutines; with a shared channel all workers read the same deliveries
+	c.draining.Store(false)
 	for i := 0; i < c.concurrency; i++ {
 		c.wg.Add(1)
-		go c.worker(ctx, msgs, i)
+		go c.worker(procCtx, deliveries[i%len(deliveries)], i)
 	}
 
 	log.Info("RabbitMQ consumer started successfully")
 
-	// Wait for context cancellation
-	<-ctx.Done()
-	log.Info("Shutting down RabbitMQ consumer")
+	var sessionErr error
+	var resized *workerSettings
+	select {
+	case <-ctx.Done():
+		log.Info("Shutting down RabbitMQ consumer, draining in-flight messages")
+		c.stopConsuming(consumeChans)
+	case settings := <-c.resize:
+		log.Info("Restarting RabbitMQ consumer with new worker settings, draining in-flight messages")
+		c.stopConsuming(consumeChans)
+		resized = &settings
+	case sessionErr = <-closed:
+	}
+
+	if sessionErr != nil {
+		// Tear down what is left so the delivery channels close and workers exit
+		c.closeChannels()
+	}
 
 	// Wait for workers to finish
 	c.wg.Wait()
-	log.Info("All workers stopped")
 
-	return nil
+	if resized != nil && ctx.Err() == nil {
+		c.applyWorkerSettings(*resized)
+		c.closeChannels()
+		return errReconfigured
+	}
+	return sessionErr
+}
+
+// stopConsuming sends basic.cancel for every consumer so the broker stops delivering.
+// Deliveries already prefetched are requeued by the workers; the delivery channels
+// close once the cancels are confirmed, which lets the workers exit.
+func (c *RabbitMQConsumer) stopConsuming(consumeChans []*amqp091.Channel) {
+	c.draining.Store(true)
+	for i, channel := range consumeChans {
+		if err := channel.Cancel(consumerTag(i), false); err != nil {
+			log.WithError(err).Warn("Failed to cancel consumer")
+		}
+	}
+}
+
+// consumerTag returns the consumer tag of the i-th consume channel
+func consumerTag(i int) string {
+	return fmt.Sprintf("nc-rag-worker-%d", i)
 }
 
-// worker processes messages from the queue
+// worker processes messages from the queue until the delivery channel closes
 func (c *RabbitMQConsumer) worker(ctx context.Context, msgs <-chan amqp091.Delivery, workerID int) {
 	defer c.wg.Done()
 
 	logger := log.WithField("worker_id", workerID)
 	logger.Info("Worker started")
 
-	for {
-		select {
-		case <-ctx.Done():
-			logger.Info("Worker stopping due to context cancellation")
-			return
+	for msg := range msgs {
+		eventType, traceID := peekEvent(msg.Body)
+		metrics.MessagesTotal.WithLabelValues(eventType, metrics.OutcomeConsumed).Inc()
 
-		case msg, ok := <-msgs:
-			if !ok {
-				logger.Info("Message channel closed, worker stopping")
-				return
-			}
+		// Hand prefetched messages back instead of starting them while shutting down
+		if c.draining.Load() {
+			c.requeue(msg, eventType)
+			continue
+		}
 
-			// Process message
-			if err := c.processMessage(ctx, msg); err != nil {
-				logger.WithError(err).Error("Failed to process message")
-				// Reject message and requeue (with limit to prevent infinite loops)
-				msg.Nack(false, true)
-			} else {
-				// Acknowledge successful processing
-				msg.Ack(false)
+		// Wait for a slot when the adaptive limiter has lowered the in-flight limit
+		if c.limiter != nil {
+			if err := c.limiter.Acquire(ctx); err != nil {
+				c.requeue(msg, eventType)
+				continue
 			}
 		}
+
+		// Process message in a span continuing the publisher's traceparent or trace_id
+		msgCtx, span := tracing.StartMessageSpan(ctx, c.queueName+" process", msg.Headers, traceID)
+		span.SetAttributes(attribute.String("nc_rag.event_type", eventType))
+		metrics.InFlight.Inc()
+		err := c.processMessage(msgCtx, msg)
+		metrics.InFlight.Dec()
+		if c.limiter != nil {
+			c.limiter.Release()
+		}
+		switch {
+		case err != nil && ctx.Err() != nil:
+			// Aborted at the drain deadline; the next consumer starts it over
+			tracing.RecordError(span, err)
+			logger.WithError(err).Warn("Message aborted during shutdown, requeueing")
+			c.requeue(msg, eventType)
+		case err != nil:
+			tracing.RecordError(span, err)
+			logger.WithError(err).Error("Failed to process message")
+			// Retry with delay, or dead-letter permanent and exhausted failures
+			c.handleFailure(msgCtx, msg, eventType, err, logger)
+		default:
+			// Acknowledge successful processing
+			msg.Ack(false)
+			metrics.MessagesTotal.WithLabelValues(eventType, metrics.OutcomeAcked).Inc()
+		}
+		span.End()
 	}
+
+	logger.Info("Message channel closed, worker stopping")
+}
+
+// requeue returns an unprocessed message to the queue without counting a retry
+func (c *RabbitMQConsumer) requeue(msg amqp091.Delivery, eventType string) {
+	msg.Nack(false, true)
+	metrics.MessagesTotal.WithLabelValues(eventType, metrics.OutcomeRequeued).Inc()
+}
+
+// peekEvent returns the short event class name (for metric labels) and trace_id of a raw message
+func peekEvent(body []byte) (string, string) {
+	var event struct {
+		Type    string `json:"type"`
+		TraceID string `json:"trace_id"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil || event.Type == "" {
+		return "unknown", event.TraceID
+	}
+	if i := strings.LastIndex(event.Type, "\\"); i >= 0 {
+		return event.Type[i+1:], event.TraceID
+	}
+	return event.Type, event.TraceID
 }
 
 // processMessage processes a single message
@@ -157,7 +332,7 @@ func (c *RabbitMQConsumer) processMessage(ctx context.Context, msg amqp091.Deliv
 	// Parse message
 	var event models.FileEvent
 	if err := json.Unmarshal(msg.Body, &event); err != nil {
-		return fmt.Errorf("failed to parse message: %w", err)
+		return broker.Permanent(fmt.Errorf("failed to parse message: %w", err))
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -168,8 +343,44 @@ func (c *RabbitMQConsumer) processMessage(ctx context.Context, msg amqp091.Deliv
 		"file_path":  event.File.Path,
 	})
 
+	// Hold rapid updates of a file for the quiet window and process only the last one
+	if c.shouldDebounce(&event, msg) {
+		return c.debounce(ctx, &event, msg, logger)
+	}
+	coalesced, err := c.isCoalesced(ctx, &event, msg)
+	if err != nil {
+		return err
+	}
+	if coalesced {
+		metrics.DebounceTotal.WithLabelValues("coalesced").Inc()
+		logger.Info("Skipping file event superseded by a later update")
+		return nil
+	}
+
 	logger.Info("Processing file event")
 
+	// Skip redeliveries of events that were already processed
+	finish, skip, err := c.claimEvent(ctx, &event, logger)
+	if err != nil || skip {
+		return err
+	}
+	err = c.handleEvent(ctx, &event, logger)
+	finish(err)
+	return err
+}
+
+// handleEvent dispatches a claimed event by type
+func (c *RabbitMQConsumer) handleEvent(ctx context.Context, event *models.FileEvent, logger *log.Entry) error {
+	// Purge deleted files from the index
+	if event.IsDeleteEvent() {
+		return c.processDelete(ctx, event, logger)
+	}
+
+	// Apply share grants/revokes to the index payloads
+	if event.IsShareCreatedEvent() || event.IsShareDeletedEvent() {
+		return c.processShare(ctx, event, logger)
+	}
+
 	// Check if this is a create or update event
 	if !event.IsCreateOrUpdateEvent() {
 		logger.Debug("Skipping non-create/update event")
@@ -182,25 +393,55 @@ func (c *RabbitMQConsumer) processMessage(ctx context.Context, msg amqp091.Deliv
 		return nil
 	}
 
-	// Check if we already have a job for this file
-	existingJob, err := c.storage.GetJobByFileID(ctx, event.File.ID)
-	if err == nil && existingJob != nil {
-		logger.WithField("existing_job_id", existingJob.JobID).Info("File already has a processing job, skipping")
-		return nil
+	return c.processFile(ctx, event, logger)
+}
+
+// processFile submits a file to the parser if its content changed since the last processed version
+func (c *RabbitMQConsumer) processFile(ctx context.Context, event *models.FileEvent, logger *log.Entry) (err error) {
+	version, err := c.ncClient.FileVersion(ctx, event)
+	if err != nil {
+		return fmt.Errorf("failed to resolve file version: %w", err)
 	}
+	logger = logger.WithField("file_version", version)
 
-	// Fetch file content from Nextcloud
-	logger.Info("Fetching file content from Nextcloud")
-	content, err := c.ncClient.FetchFile(ctx, &event)
+	// Lock the file unless this version was already processed
+	token := models.NewTraceID()
+	claim, err := c.storage.ClaimFileVersion(ctx, event.Tenant, event.File.ID, version, token)
 	if err != nil {
-		return fmt.Errorf("failed to fetch file: %w", err)
+		return err
+	}
+	switch claim {
+	case storage.ClaimDuplicate:
+		logger.Info("File content unchanged since last processed version, skipping")
+		return nil
+	case storage.ClaimBusy:
+		return fmt.Errorf("file %d is %w", event.File.ID, errClaimBusy)
+	}
+	defer func() {
+		if err != nil {
+			if releaseErr := c.storage.ReleaseFileVersion(ctx, event.Tenant, event.File.ID, token); releaseErr != nil {
+				logger.WithError(releaseErr).Warn("Failed to release file lock")
+			}
+		}
+	}()
+
+	// The version key expires, but the file record keeps what is indexed after the jobs were archived
+	record, err := c.jobs.GetFileRecord(ctx, event.File.ID)
+	if err != nil && !errors.Is(err, storage.ErrFileRecordNotFound) {
+		return fmt.Errorf("failed to get file record: %w", err)
+	}
+	if record != nil && record.IndexedJobID != "" && record.FileVersion == version {
+		logger.WithFields(log.Fields{
+			"indexed_job_id": record.IndexedJobID,
+			"parser_version": record.ParserVersion,
+		}).Info("File version already indexed according to its file record, skipping")
+		return c.storage.CommitFileVersion(ctx, event.Tenant, event.File.ID, version, token)
 	}
 
-	// Submit to parser
-	logger.Info("Submitting file to parser")
-	parserResponse, err := c.parserClient.SubmitJob(ctx, &event, content)
+	// Fetch file from Nextcloud and submit to parser
+	parserResponse, err := c.submitFile(ctx, event, logger)
 	if err != nil {
-		return fmt.Errorf("failed to submit to parser: %w", err)
+		return err
 	}
 
 	// Create job state
@@ -217,14 +458,26 @@ func (c *RabbitMQConsumer) processMessage(ctx context.Context, msg amqp091.Deliv
 			"initial_status": parserResponse.Status,
 			"message":        parserResponse.Message,
 		},
-		RetryCount: 0,
+		RetryCount:  0,
+		FileVersion: version,
+	}
+
+	jobState.StartHistory(jobState.SubmittedAt)
+
+	// Replace the previous version's job before the file mapping points at the new one
+	if err := c.supersedePreviousJob(ctx, event.File.ID, jobState.JobID, record, logger); err != nil {
+		return err
 	}
 
 	// Save job state
-	if err := c.storage.SaveJob(ctx, jobState); err != nil {
+	if err := c.jobs.SaveJob(ctx, jobState); err != nil {
 		return fmt.Errorf("failed to save job state: %w", err)
 	}
 
+	if err := c.storage.CommitFileVersion(ctx, event.Tenant, event.File.ID, version, token); err != nil {
+		return err
+	}
+
 	logger.WithFields(log.Fields{
 		"job_id":        jobState.JobID,
 		"parser_status": parserResponse.Status,
@@ -233,24 +486,138 @@ func (c *RabbitMQConsumer) processMessage(ctx context.Context, msg amqp091.Deliv
 	return nil
 }
 
-// Close closes the RabbitMQ connection
-func (c *RabbitMQConsumer) Close() error {
-	if c.channel != nil {
-		c.channel.Close()
+// submitFile hands the file to the parser using the configured protocol
+func (c *RabbitMQConsumer) submitFile(ctx context.Context, event *models.FileEvent, logger *log.Entry) (*models.ParserJobResponse, error) {
+	start := time.Now()
+	parserResponse, err := c.submitFileWithProtocol(ctx, event, logger)
+	if c.limiter != nil {
+		// Permanent failures say nothing about parser load
+		c.limiter.Observe(time.Since(start), err != nil && !isPermanent(err))
 	}
-	if c.conn != nil {
-		c.conn.Close()
+	return parserResponse, err
+}
+
+// submitFileWithProtocol fetches the file and submits it with the parser client's protocol
+func (c *RabbitMQConsumer) submitFileWithProtocol(ctx context.Context, event *models.FileEvent, logger *log.Entry) (*models.ParserJobResponse, error) {
+	protocol := c.parserClient.Protocol()
+	metrics.FileSize.WithLabelValues(event.Tenant).Observe(float64(event.File.Size))
+
+	if protocol == parser.ProtocolJSON {
+		// Legacy protocol: buffer and base64-encode the whole file
+		logger.Info("Fetching file content from Nextcloud")
+		fetchCtx, fetchSpan := tracing.Start(ctx, "nextcloud.fetch", event.TraceID)
+		fetchStart := time.Now()
+		content, err := c.ncClient.FetchFile(fetchCtx, event)
+		metrics.Since(metrics.FetchDuration.WithLabelValues(event.Tenant), fetchStart)
+		tracing.RecordError(fetchSpan, err)
+		fetchSpan.End()
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch file: %w", err)
+		}
+
+		logger.Info("Submitting file to parser")
+		submitCtx, submitSpan := tracing.Start(ctx, "parser.submit", event.TraceID)
+		submitStart := time.Now()
+		parserResponse, err := c.parserClient.SubmitJob(submitCtx, event, content)
+		metrics.Since(metrics.SubmitDuration.WithLabelValues(event.Tenant, protocol), submitStart)
+		tracing.RecordError(submitSpan, err)
+		submitSpan.End()
+		if err != nil {
+			return nil, fmt.Errorf("failed to submit to parser: %w", err)
+		}
+		return parserResponse, nil
 	}
-	return nil
+
+	// Stream straight from WebDAV into the multipart request body.
+	// Fetch time covers opening the stream; the transfer itself is part of the submit time.
+	fetchCtx, fetchSpan := tracing.Start(ctx, "nextcloud.fetch", event.TraceID)
+	fetchStart := time.Now()
+	reader, err := c.ncClient.OpenFile(fetchCtx, event)
+	metrics.Since(metrics.FetchDuration.WithLabelValues(event.Tenant), fetchStart)
+	tracing.RecordError(fetchSpan, err)
+	fetchSpan.End()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch file: %w", err)
+	}
+	defer reader.Close()
+
+	logger.Info("Streaming file to parser")
+	submitCtx, submitSpan := tracing.Start(ctx, "parser.submit", event.TraceID)
+	submitStart := time.Now()
+	parserResponse, err := c.parserClient.SubmitJobStream(submitCtx, event, reader)
+	metrics.Since(metrics.SubmitDuration.WithLabelValues(event.Tenant, protocol), submitStart)
+	tracing.RecordError(submitSpan, err)
+	submitSpan.End()
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit to parser: %w", err)
+	}
+	return parserResponse, nil
 }
 
-// Health checks RabbitMQ connection health
-func (c *RabbitMQConsumer) Health(ctx context.Context) error {
-	if c.conn == nil || c.conn.IsClosed() {
-		return fmt.Errorf("RabbitMQ connection is closed")
+// processDelete removes all vectors and job state of a deleted file
+func (c *RabbitMQConsumer) processDelete(ctx context.Context, event *models.FileEvent, logger *log.Entry) error {
+	// Folder deletes are followed by per-file events, so there is nothing to purge here
+	if event.IsFolder() {
+		logger.Info("Folder deleted, relying on per-file delete events")
+		return nil
+	}
+
+	// Drop updates of the file that are still waiting out the quiet window
+	if err := c.supersedeDebounced(ctx, event); err != nil {
+		return err
 	}
-	if c.channel == nil || c.channel.IsClosed() {
-		return fmt.Errorf("RabbitMQ channel is closed")
+
+	if err := c.qdrant.DeletePoints(ctx, qdrant.FileFilter(event.Tenant, event.File.ID)); err != nil {
+		return fmt.Errorf("failed to delete file points: %w", err)
+	}
+
+	// A restored file with the same ETag must be processed again
+	if err := c.storage.ClearFileVersion(ctx, event.Tenant, event.File.ID); err != nil {
+		return err
+	}
+	if err := c.jobs.DeleteFileRecord(ctx, event.File.ID); err != nil {
+		return err
 	}
+	if err := c.acl.Forget(ctx, event.Tenant, event.File.ID); err != nil {
+		return err
+	}
+
+	job, err := c.jobs.GetJobByFileID(ctx, event.File.ID)
+	if err != nil {
+		if !errors.Is(err, storage.ErrJobNotFound) {
+			return fmt.Errorf("failed to get job for deleted file: %w", err)
+		}
+		logger.Info("Deleted file points, no job state to remove")
+		return nil
+	}
+
+	if err := c.jobs.DeleteJob(ctx, job.JobID); err != nil {
+		return fmt.Errorf("failed to delete job state: %w", err)
+	}
+
+	logger.WithField("job_id", job.JobID).Info("Deleted file points and job state")
 	return nil
-}
\ No newline at end of file
+}
+
+// processShare updates the principals of a file's points without re-parsing or re-embedding
+func (c *RabbitMQConsumer) processShare(ctx context.Context, event *models.FileEvent, logger *log.Entry) error {
+	principal := event.Share.Principal()
+	logger = logger.WithFields(log.Fields{
+		"share_id":   event.Share.ID,
+		"share_type": event.Share.ShareType,
+		"principal":  principal,
+	})
+
+	if principal == "" {
+		logger.Debug("Skipping share type without ACL principal")
+		return nil
+	}
+
+	if event.IsShareCreatedEvent() {
+		logger.Info("Granting file access to principal")
+		return c.acl.Grant(ctx, event.Tenant, event.File.ID, principal)
+	}
+
+	logger.Info("Revoking file access from principal")
+	return c.acl.Revoke(ctx, event.Tenant, event.File.ID, principal)
+}
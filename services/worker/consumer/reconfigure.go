@@ -0,0 +1,49 @@
+package consumer
+
+import (
+	"errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// errReconfigured ends a consumer session so the next one starts with new worker settings
+var errReconfigured = errors.New("consumer reconfigured")
+
+// workerSettings are the consumer settings that can change without a restart
+type workerSettings struct {
+	concurrency int
+	prefetch    int
+}
+
+// Reconfigure changes the number of workers and their prefetch.
+// The current session stops consuming, lets in-flight messages finish, requeues
+// prefetched ones and reopens its channels with the new settings.
+func (c *RabbitMQConsumer) Reconfigure(concurrency, prefetch int) {
+	settings := workerSettings{concurrency: concurrency, prefetch: prefetch}
+	// Only the latest settings matter if the session has not picked up earlier ones yet
+	for {
+		select {
+		case c.resize <- settings:
+			return
+		default:
+		}
+		select {
+		case <-c.resize:
+		default:
+		}
+	}
+}
+
+// applyWorkerSettings switches to new settings between sessions, while no worker is running
+func (c *RabbitMQConsumer) applyWorkerSettings(settings workerSettings) {
+	log.WithFields(log.Fields{
+		"concurrency": settings.concurrency,
+		"prefetch":    settings.prefetch,
+	}).Info("Applying new RabbitMQ consumer settings")
+
+	c.concurrency = settings.concurrency
+	c.prefetch = settings.prefetch
+	if c.limiter != nil {
+		c.limiter = newAdaptiveLimiter(settings.concurrency, c.limiter.targetLatency, c.limiter.maxErrorRate, c.adjustQos)
+	}
+}
@@ -0,0 +1,49 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+
+	"nc-rag-worker/broker"
+	"nc-rag-worker/metrics"
+	"nc-rag-worker/nextcloud"
+	"nc-rag-worker/parser"
+
+	"github.com/rabbitmq/amqp091-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// isPermanent classifies an error as permanent (dead-letter now) or transient (retry later)
+func isPermanent(err error) bool {
+	if broker.IsPermanent(err) {
+		return true
+	}
+
+	// The file is gone or will never fit; a later NodeDeletedEvent/NodeUpdatedEvent supersedes it
+	if errors.Is(err, nextcloud.ErrFileNotFound) || errors.Is(err, nextcloud.ErrFileTooLarge) {
+		return true
+	}
+
+	var statusErr *parser.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Permanent()
+	}
+
+	return false
+}
+
+// handleFailure retries a failed message with delay or dead-letters it, then acks the original
+func (c *RabbitMQConsumer) handleFailure(ctx context.Context, msg amqp091.Delivery, eventType string, procErr error, logger *log.Entry) {
+	c.publishMu.Lock()
+	outcome := c.retrier.Handle(ctx, c.publishChannel, msg, procErr, isPermanent(procErr), logger)
+	c.publishMu.Unlock()
+
+	metrics.MessagesTotal.WithLabelValues(eventType, outcome).Inc()
+}
+
+// publish republishes a delivery body with new headers on the publish channel and waits for the broker confirm
+func (c *RabbitMQConsumer) publish(ctx context.Context, exchange, routingKey string, msg amqp091.Delivery, headers amqp091.Table) error {
+	c.publishMu.Lock()
+	defer c.publishMu.Unlock()
+	return broker.Republish(ctx, c.publishChannel, exchange, routingKey, msg, headers)
+}
@@ -0,0 +1,35 @@
+package consumer
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"nc-rag-worker/broker"
+	"nc-rag-worker/nextcloud"
+	"nc-rag-worker/parser"
+)
+
+func TestIsPermanent(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "transient", err: errors.New("connection refused"), want: false},
+		{name: "marked permanent", err: broker.Permanent(errors.New("bad event")), want: true},
+		{name: "file not found", err: fmt.Errorf("failed to fetch file: %w", nextcloud.ErrFileNotFound), want: true},
+		{name: "file too large", err: fmt.Errorf("failed to fetch file: %w", nextcloud.ErrFileTooLarge), want: true},
+		{name: "parser rejected payload", err: fmt.Errorf("failed to submit: %w", &parser.StatusError{StatusCode: 415}), want: true},
+		{name: "parser unavailable", err: fmt.Errorf("failed to submit: %w", &parser.StatusError{StatusCode: 503}), want: false},
+		{name: "parser auth", err: &parser.StatusError{StatusCode: 401}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPermanent(tt.err); got != tt.want {
+				t.Fatalf("isPermanent(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package embeddings
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"nc-rag-worker/config"
+)
+
+// Embedder turns texts into vectors using a configured embedding model
+type Embedder interface {
+	// Embed returns one embedding per input text, batching requests internally
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Dimension returns the vector size produced by the model
+	Dimension(ctx context.Context) (int, error)
+	// Model returns the embedding model name stored alongside vectors
+	Model() string
+}
+
+// New creates the embedder selected by EMBED_PROVIDER
+func New(cfg config.EmbeddingConfig) (Embedder, error) {
+	switch cfg.Provider {
+	case "ollama":
+		if cfg.OllamaModel == "" {
+			return nil, fmt.Errorf("OLLAMA_EMBED_MODEL is required for the ollama embedding provider")
+		}
+		return NewOllamaClient(cfg.OllamaURL, cfg.OllamaBasicAuth, cfg.OllamaModel, cfg.BatchSize, cfg.Dimension), nil
+	case "openai":
+		if cfg.OpenAIModel == "" {
+			return nil, fmt.Errorf("OPENAI_EMBED_MODEL is required for the openai embedding provider")
+		}
+		return NewOpenAIClient(cfg.OpenAIURL, cfg.OpenAIAPIKey, cfg.OpenAIModel, cfg.BatchSize, cfg.Dimension), nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider: %s", cfg.Provider)
+	}
+}
+
+// embedFunc embeds a single batch of texts
+type embedFunc func(ctx context.Context, texts []string) ([][]float32, error)
+
+// embedInBatches splits texts into batches of at most batchSize and embeds them in order
+func embedInBatches(ctx context.Context, texts []string, batchSize int, embed embedFunc) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	if batchSize <= 0 {
+		batchSize = len(texts)
+	}
+
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += batchSize {
+		end := start + batchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+
+		batch, err := embed(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) != end-start {
+			return nil, fmt.Errorf("embedding provider returned %d embeddings for %d inputs", len(batch), end-start)
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+// dimensionCache remembers the vector size, probing the model once if it was not configured
+type dimensionCache struct {
+	mu        sync.Mutex
+	dimension int
+}
+
+// get returns the cached dimension or probes it with a single embedding
+func (d *dimensionCache) get(ctx context.Context, embed embedFunc) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.dimension > 0 {
+		return d.dimension, nil
+	}
+
+	vectors, err := embed(ctx, []string{"dimension probe"})
+	if err != nil {
+		return 0, fmt.Errorf("failed to probe embedding dimension: %w", err)
+	}
+	if len(vectors) != 1 || len(vectors[0]) == 0 {
+		return 0, fmt.Errorf("failed to probe embedding dimension: empty embedding")
+	}
+	d.dimension = len(vectors[0])
+	return d.dimension, nil
+}
@@ -0,0 +1,200 @@
+package embeddings
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"nc-rag-worker/embeddings/embeddingstest"
+)
+
+const testDimension = 8
+
+func texts(n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = fmt.Sprintf("text %d", i)
+	}
+	return out
+}
+
+// newTestEmbedders returns both providers pointed at the fake server
+func newTestEmbedders(server *embeddingstest.Server, batchSize int) map[string]Embedder {
+	return map[string]Embedder{
+		"ollama": NewOllamaClient(server.URL, "user:secret", "nomic-embed-text", batchSize, 0),
+		"openai": NewOpenAIClient(server.URL+"/v1", "sk-test", "text-embedding-3-small", batchSize, 0),
+	}
+}
+
+func TestEmbedBatching(t *testing.T) {
+	tests := []struct {
+		batchSize int
+		inputs    int
+		batches   []int
+	}{
+		{batchSize: 16, inputs: 16, batches: []int{16}},
+		{batchSize: 16, inputs: 17, batches: []int{16, 1}},
+		{batchSize: 16, inputs: 40, batches: []int{16, 16, 8}},
+		{batchSize: 64, inputs: 64, batches: []int{64}},
+		{batchSize: 64, inputs: 65, batches: []int{64, 1}},
+		{batchSize: 64, inputs: 3, batches: []int{3}},
+	}
+
+	for _, tt := range tests {
+		server := embeddingstest.NewServer(testDimension)
+		for provider, embedder := range newTestEmbedders(server, tt.batchSize) {
+			t.Run(fmt.Sprintf("%s/%d-of-%d", provider, tt.inputs, tt.batchSize), func(t *testing.T) {
+				before := len(server.Requests())
+				inputs := texts(tt.inputs)
+
+				vectors, err := embedder.Embed(context.Background(), inputs)
+				if err != nil {
+					t.Fatalf("Embed: %v", err)
+				}
+
+				var batches []int
+				for _, request := range server.Requests()[before:] {
+					batches = append(batches, len(request.Input))
+				}
+				if !reflect.DeepEqual(batches, tt.batches) {
+					t.Fatalf("batches = %v, want %v", batches, tt.batches)
+				}
+
+				// Vectors come back in input order across batches
+				if len(vectors) != len(inputs) {
+					t.Fatalf("got %d vectors for %d inputs", len(vectors), len(inputs))
+				}
+				for i, text := range inputs {
+					if !reflect.DeepEqual(vectors[i], embeddingstest.Vector(text, testDimension)) {
+						t.Fatalf("vector %d does not belong to %q", i, text)
+					}
+				}
+			})
+		}
+		server.Close()
+	}
+}
+
+func TestEmbedEmpty(t *testing.T) {
+	server := embeddingstest.NewServer(testDimension)
+	defer server.Close()
+
+	for provider, embedder := range newTestEmbedders(server, 16) {
+		vectors, err := embedder.Embed(context.Background(), nil)
+		if err != nil || len(vectors) != 0 {
+			t.Fatalf("%s: Embed(nil) = %d vectors, %v", provider, len(vectors), err)
+		}
+	}
+	if n := len(server.Requests()); n != 0 {
+		t.Fatalf("empty input sent %d requests", n)
+	}
+}
+
+func TestEmbedAuthorization(t *testing.T) {
+	server := embeddingstest.NewServer(testDimension)
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		embedder Embedder
+		path     string
+		want     string
+	}{
+		{
+			name:     "ollama basic auth",
+			embedder: NewOllamaClient(server.URL, "user:pa:ss", "model", 16, 0),
+			path:     "/api/embed",
+			want:     "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pa:ss")),
+		},
+		{
+			name:     "ollama without auth",
+			embedder: NewOllamaClient(server.URL, "", "model", 16, 0),
+			path:     "/api/embed",
+			want:     "",
+		},
+		{
+			name:     "openai api key",
+			embedder: NewOpenAIClient(server.URL, "sk-test", "model", 16, 0),
+			path:     "/v1/embeddings",
+			want:     "Bearer sk-test",
+		},
+		{
+			name:     "openai without key",
+			embedder: NewOpenAIClient(server.URL+"/v1/", "", "model", 16, 0),
+			path:     "/v1/embeddings",
+			want:     "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(server.Requests())
+			if _, err := tt.embedder.Embed(context.Background(), []string{"hello"}); err != nil {
+				t.Fatalf("Embed: %v", err)
+			}
+			requests := server.Requests()[before:]
+			if len(requests) != 1 {
+				t.Fatalf("sent %d requests, want 1", len(requests))
+			}
+			if requests[0].Path != tt.path {
+				t.Fatalf("path = %s, want %s", requests[0].Path, tt.path)
+			}
+			if requests[0].Authorization != tt.want {
+				t.Fatalf("Authorization = %q, want %q", requests[0].Authorization, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbedErrorStatus(t *testing.T) {
+	server := embeddingstest.NewServer(testDimension)
+	defer server.Close()
+	server.FailWith(http.StatusUnauthorized)
+
+	for provider, embedder := range newTestEmbedders(server, 16) {
+		_, err := embedder.Embed(context.Background(), texts(20))
+		if err == nil {
+			t.Fatalf("%s: Embed succeeded against a failing server", provider)
+		}
+		if !strings.Contains(err.Error(), "401") {
+			t.Fatalf("%s: error %q does not mention the status", provider, err)
+		}
+	}
+	// The first failed batch stops the embedding
+	if n := len(server.Requests()); n != 2 {
+		t.Fatalf("sent %d requests, want one per provider", n)
+	}
+}
+
+func TestDimensionProbe(t *testing.T) {
+	server := embeddingstest.NewServer(testDimension)
+	defer server.Close()
+
+	for provider, embedder := range newTestEmbedders(server, 16) {
+		for i := 0; i < 2; i++ {
+			dimension, err := embedder.Dimension(context.Background())
+			if err != nil {
+				t.Fatalf("%s: Dimension: %v", provider, err)
+			}
+			if dimension != testDimension {
+				t.Fatalf("%s: Dimension = %d, want %d", provider, dimension, testDimension)
+			}
+		}
+	}
+	// The dimension is probed once per client
+	if n := len(server.Requests()); n != 2 {
+		t.Fatalf("sent %d probe requests, want 2", n)
+	}
+
+	configured := NewOllamaClient(server.URL, "", "model", 16, 384)
+	if dimension, err := configured.Dimension(context.Background()); err != nil || dimension != 384 {
+		t.Fatalf("configured Dimension = %d, %v; want 384", dimension, err)
+	}
+	if n := len(server.Requests()); n != 2 {
+		t.Fatalf("configured dimension was probed")
+	}
+}
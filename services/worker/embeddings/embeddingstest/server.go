@@ -0,0 +1,146 @@
+// Package embeddingstest provides a fake embeddings server for tests.
+package embeddingstest
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// Request is an embeddings request received by the fake server
+type Request struct {
+	Path          string
+	Authorization string
+	Model         string
+	Input         []string
+}
+
+// Server is a fake embeddings server that records the requests it receives
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []Request
+	status   int
+}
+
+// NewServer starts a fake server speaking both the Ollama /api/embed and the
+// OpenAI-compatible /v1/embeddings protocols. Vectors are derived from a hash
+// of the input text, so equal texts always get equal embeddings.
+func NewServer(dimension int) *Server {
+	s := &Server{}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/embed", func(w http.ResponseWriter, r *http.Request) {
+		request, ok := s.record(w, r)
+		if !ok {
+			return
+		}
+
+		embeddings := make([][]float32, len(request.Input))
+		for i, text := range request.Input {
+			embeddings[i] = Vector(text, dimension)
+		}
+		writeJSON(w, map[string]interface{}{
+			"model":      request.Model,
+			"embeddings": embeddings,
+		})
+	})
+
+	mux.HandleFunc("/v1/embeddings", func(w http.ResponseWriter, r *http.Request) {
+		request, ok := s.record(w, r)
+		if !ok {
+			return
+		}
+
+		data := make([]map[string]interface{}, len(request.Input))
+		for i, text := range request.Input {
+			data[i] = map[string]interface{}{
+				"object":    "embedding",
+				"index":     i,
+				"embedding": Vector(text, dimension),
+			}
+		}
+		writeJSON(w, map[string]interface{}{
+			"object": "list",
+			"model":  request.Model,
+			"data":   data,
+		})
+	})
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// record decodes and records a request; it reports false if it already answered with an error
+func (s *Server) record(w http.ResponseWriter, r *http.Request) (Request, bool) {
+	request := Request{
+		Path:          r.URL.Path,
+		Authorization: r.Header.Get("Authorization"),
+	}
+	var body struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return request, false
+	}
+	request.Model, request.Input = body.Model, body.Input
+
+	s.mu.Lock()
+	s.requests = append(s.requests, request)
+	status := s.status
+	s.mu.Unlock()
+
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return request, false
+	}
+	return request, true
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// FailWith makes the server answer every request with status; 0 restores normal answers
+func (s *Server) FailWith(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// Vector returns the deterministic unit vector the fake server produces for text
+func Vector(text string, dimension int) []float32 {
+	vector := make([]float32, dimension)
+	seed := sha256.Sum256([]byte(text))
+
+	var norm float64
+	for i := range vector {
+		block := sha256.Sum256(append(seed[:], byte(i), byte(i>>8)))
+		value := float64(int32(binary.BigEndian.Uint32(block[:4]))) / math.MaxInt32
+		vector[i] = float32(value)
+		norm += value * value
+	}
+
+	norm = math.Sqrt(norm)
+	if norm > 0 {
+		for i := range vector {
+			vector[i] = float32(float64(vector[i]) / norm)
+		}
+	}
+	return vector
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,100 @@
+package embeddings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"nc-rag-worker/tracing"
+)
+
+// OllamaClient generates embeddings with an Ollama server
+type OllamaClient struct {
+	baseURL    string
+	basicAuth  atomic.Value
+	model      string
+	batchSize  int
+	dimension  dimensionCache
+	httpClient *http.Client
+}
+
+// NewOllamaClient creates a new Ollama embeddings client.
+// basicAuth is an optional "user:password" pair for Ollama behind a reverse proxy.
+func NewOllamaClient(baseURL, basicAuth, model string, batchSize, dimension int) *OllamaClient {
+	c := &OllamaClient{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		model:     model,
+		batchSize: batchSize,
+		dimension: dimensionCache{dimension: dimension},
+		httpClient: &http.Client{
+			Timeout:   120 * time.Second,
+			Transport: tracing.Transport(http.DefaultTransport),
+		},
+	}
+	c.basicAuth.Store(basicAuth)
+	return c
+}
+
+// SetBasicAuth switches to a rotated "user:password" pair for all following requests
+func (c *OllamaClient) SetBasicAuth(basicAuth string) {
+	c.basicAuth.Store(basicAuth)
+}
+
+// Model returns the embedding model name
+func (c *OllamaClient) Model() string {
+	return c.model
+}
+
+// Dimension returns the embedding vector size
+func (c *OllamaClient) Dimension(ctx context.Context) (int, error) {
+	return c.dimension.get(ctx, c.embedBatch)
+}
+
+// Embed returns one embedding per input text
+func (c *OllamaClient) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return embedInBatches(ctx, texts, c.batchSize, c.embedBatch)
+}
+
+// embedBatch sends a single /api/embed request
+func (c *OllamaClient) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	requestBody, err := json.Marshal(map[string]interface{}{
+		"model": c.model,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/embed", bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if username, password, _ := strings.Cut(c.basicAuth.Load().(string), ":"); username != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to ollama: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ollama returned error status: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return response.Embeddings, nil
+}
@@ -0,0 +1,112 @@
+package embeddings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"nc-rag-worker/tracing"
+)
+
+// OpenAIClient generates embeddings with an OpenAI-compatible /v1/embeddings API
+type OpenAIClient struct {
+	baseURL    string
+	apiKey     atomic.Value
+	model      string
+	batchSize  int
+	dimension  dimensionCache
+	httpClient *http.Client
+}
+
+// NewOpenAIClient creates a new OpenAI-compatible embeddings client
+func NewOpenAIClient(baseURL, apiKey, model string, batchSize, dimension int) *OpenAIClient {
+	c := &OpenAIClient{
+		baseURL:   strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v1"),
+		model:     model,
+		batchSize: batchSize,
+		dimension: dimensionCache{dimension: dimension},
+		httpClient: &http.Client{
+			Timeout:   60 * time.Second,
+			Transport: tracing.Transport(http.DefaultTransport),
+		},
+	}
+	c.apiKey.Store(apiKey)
+	return c
+}
+
+// SetAPIKey switches to a rotated API key for all following requests
+func (c *OpenAIClient) SetAPIKey(apiKey string) {
+	c.apiKey.Store(apiKey)
+}
+
+// Model returns the embedding model name
+func (c *OpenAIClient) Model() string {
+	return c.model
+}
+
+// Dimension returns the embedding vector size
+func (c *OpenAIClient) Dimension(ctx context.Context) (int, error) {
+	return c.dimension.get(ctx, c.embedBatch)
+}
+
+// Embed returns one embedding per input text
+func (c *OpenAIClient) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return embedInBatches(ctx, texts, c.batchSize, c.embedBatch)
+}
+
+// embedBatch sends a single /v1/embeddings request
+func (c *OpenAIClient) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	requestBody, err := json.Marshal(map[string]interface{}{
+		"model": c.model,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/v1/embeddings", bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey := c.apiKey.Load().(string); apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to embeddings API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embeddings API returned error status: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// The API does not guarantee ordering, so restore input order by index
+	sort.Slice(response.Data, func(i, j int) bool {
+		return response.Data[i].Index < response.Data[j].Index
+	})
+
+	vectors := make([][]float32, len(response.Data))
+	for i, item := range response.Data {
+		vectors[i] = item.Embedding
+	}
+	return vectors, nil
+}
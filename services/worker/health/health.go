@@ -0,0 +1,146 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Status is the health of a component or of the whole service
+type Status string
+
+const (
+	StatusOK          Status = "ok"
+	StatusDegraded    Status = "degraded"
+	StatusUnavailable Status = "unavailable"
+)
+
+// Checker is implemented by every client with a health check
+type Checker interface {
+	Health(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to the Checker interface
+type CheckerFunc func(ctx context.Context) error
+
+// Health calls f(ctx)
+func (f CheckerFunc) Health(ctx context.Context) error {
+	return f(ctx)
+}
+
+// ComponentStatus is the result of a single dependency check
+type ComponentStatus struct {
+	Status    Status `json:"status"`
+	Critical  bool   `json:"critical"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Report is the aggregated readiness of all dependencies
+type Report struct {
+	Status     Status                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+type component struct {
+	name     string
+	checker  Checker
+	critical bool
+}
+
+// Registry aggregates dependency checks.
+// A failing critical dependency makes the service unavailable, a failing optional one degraded.
+type Registry struct {
+	timeout    time.Duration
+	components []component
+}
+
+// NewRegistry creates a registry that bounds each check by timeout
+func NewRegistry(timeout time.Duration) *Registry {
+	return &Registry{timeout: timeout}
+}
+
+// Register adds a dependency check; call it before serving requests
+func (r *Registry) Register(name string, checker Checker, critical bool) {
+	r.components = append(r.components, component{name: name, checker: checker, critical: critical})
+}
+
+// Check runs all dependency checks concurrently and aggregates the result
+func (r *Registry) Check(ctx context.Context) *Report {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	report := &Report{
+		Status:     StatusOK,
+		Components: make(map[string]ComponentStatus, len(r.components)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, comp := range r.components {
+		wg.Add(1)
+		go func(comp component) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := comp.checker.Health(ctx)
+			result := ComponentStatus{
+				Status:    StatusOK,
+				Critical:  comp.critical,
+				LatencyMs: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				result.Status = StatusUnavailable
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[comp.name] = result
+			if err == nil {
+				return
+			}
+			if comp.critical {
+				report.Status = StatusUnavailable
+			} else if report.Status == StatusOK {
+				report.Status = StatusDegraded
+			}
+		}(comp)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// LivenessHandler reports that the process is alive without checking dependencies
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]Status{"status": StatusOK})
+	})
+}
+
+// ReadinessHandler reports aggregated dependency health.
+// It returns 200 when ok or degraded and 503 when a critical dependency is down.
+func (r *Registry) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := r.Check(req.Context())
+
+		statusCode := http.StatusOK
+		if report.Status == StatusUnavailable {
+			statusCode = http.StatusServiceUnavailable
+			log.WithField("components", report.Components).Warn("Readiness check failed")
+		}
+		writeJSON(w, statusCode, report)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
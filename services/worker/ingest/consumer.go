@@ -0,0 +1,445 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"nc-rag-worker/acl"
+	"nc-rag-worker/broker"
+	"nc-rag-worker/embeddings"
+	"nc-rag-worker/models"
+	"nc-rag-worker/nextcloud"
+	"nc-rag-worker/parser"
+	"nc-rag-worker/qdrant"
+	"nc-rag-worker/storage"
+	"nc-rag-worker/tracing"
+
+	"github.com/rabbitmq/amqp091-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// consumerTag identifies the ingest consumer for basic.cancel on shutdown
+const consumerTag = "nc-rag-ingest"
+
+// Consumer consumes ingest.ready messages and upserts parser results into Qdrant
+type Consumer struct {
+	amqp           *broker.Connection
+	channel        *amqp091.Channel
+	publishChannel *amqp091.Channel
+	channelMu      sync.RWMutex
+	queueName      string
+	retrier        *broker.Retrier
+	ncClient       *nextcloud.Client
+	parserClient   *parser.Client
+	storage        storage.JobStore
+	qdrant         *qdrant.Client
+	acl            *acl.Manager
+	embedder       embeddings.Embedder
+	maxTextChars   int
+	ensureMu       sync.Mutex
+	ensured        bool
+}
+
+// NewConsumer creates a new ingest consumer on the shared connection
+func NewConsumer(
+	amqp *broker.Connection,
+	queueName string,
+	ncClient *nextcloud.Client,
+	parserClient *parser.Client,
+	storage storage.JobStore,
+	redisStorage *storage.RedisStorage,
+	qdrantClient *qdrant.Client,
+	embedder embeddings.Embedder,
+	maxTextChars int,
+	maxRetries int,
+	retryDelays []time.Duration,
+) (*Consumer, error) {
+	c := &Consumer{
+		amqp:         amqp,
+		queueName:    queueName,
+		retrier:      broker.NewRetrier(queueName, maxRetries, retryDelays),
+		ncClient:     ncClient,
+		parserClient: parserClient,
+		storage:      storage,
+		qdrant:       qdrantClient,
+		acl:          acl.NewManager(qdrantClient, redisStorage),
+		embedder:     embedder,
+		maxTextChars: maxTextChars,
+	}
+
+	// Fail fast on startup; later channel and connection losses are recovered by Start
+	if err := c.open(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// open opens the consume channel on the shared connection and declares the queue
+func (c *Consumer) open() error {
+	// Create channel
+	channel, err := c.amqp.Channel()
+	if err != nil {
+		return err
+	}
+
+	// Ingest is CPU-bound on embeddings, so take one message at a time
+	if err := channel.Qos(1, 0, false); err != nil {
+		channel.Close()
+		return fmt.Errorf("failed to set QoS: %w", err)
+	}
+
+	// Declare queue (ensure it exists); a restarted broker may have lost non-durable state
+	_, err = channel.QueueDeclare(
+		c.queueName, // name
+		true,        // durable
+		false,       // delete when unused
+		false,       // exclusive
+		false,       // no-wait
+		nil,         // arguments
+	)
+	if err != nil {
+		channel.Close()
+		return fmt.Errorf("failed to declare queue: %w", err)
+	}
+
+	// Declare retry and dead-letter queues
+	if err := c.retrier.Declare(channel); err != nil {
+		channel.Close()
+		return err
+	}
+
+	// Separate channel in confirm mode for retries and dead-lettering
+	publishChannel, err := c.amqp.Channel()
+	if err != nil {
+		channel.Close()
+		return fmt.Errorf("failed to create RabbitMQ publish channel: %w", err)
+	}
+	if err := publishChannel.Confirm(false); err != nil {
+		publishChannel.Close()
+		channel.Close()
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	c.channelMu.Lock()
+	c.channel = channel
+	c.publishChannel = publishChannel
+	c.channelMu.Unlock()
+	return nil
+}
+
+// Start starts consuming ingest.ready messages and keeps consuming across broker restarts
+// until ctx is cancelled
+func (c *Consumer) Start(ctx context.Context) error {
+	log.WithField("queue", c.queueName).Info("Starting ingest consumer")
+
+	// The message being ingested finishes on shutdown; the caller bounds how long it may take
+	procCtx := context.WithoutCancel(ctx)
+
+	for {
+		err := c.consume(ctx, procCtx)
+		if ctx.Err() != nil {
+			log.Info("Ingest consumer stopping due to context cancellation")
+			return nil
+		}
+
+		log.WithError(err).Warn("Ingest consumer session ended, reopening channel")
+		err = broker.Retry(ctx, "Reopening ingest consumer channel", func() error {
+			if err := c.amqp.Wait(ctx); err != nil {
+				return err
+			}
+			return c.open()
+		})
+		if err != nil {
+			// Only returns when the context is cancelled
+			return nil
+		}
+	}
+}
+
+// consume runs one consumer session on the current channel until ctx is cancelled or the channel closes
+func (c *Consumer) consume(ctx, procCtx context.Context) error {
+	c.channelMu.RLock()
+	channel, publishChannel := c.channel, c.publishChannel
+	c.channelMu.RUnlock()
+
+	msgs, err := channel.Consume(
+		c.queueName, // queue
+		consumerTag, // consumer
+		false,       // auto-ack
+		false,       // exclusive
+		false,       // no-local
+		false,       // no-wait
+		nil,         // args
+	)
+	if err != nil {
+		channel.Close()
+		publishChannel.Close()
+		return fmt.Errorf("failed to register consumer: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.stopConsuming(channel, msgs)
+			return nil
+
+		case msg, ok := <-msgs:
+			if !ok {
+				// Also close the publish channel so the next session starts on fresh channels
+				publishChannel.Close()
+				return fmt.Errorf("ingest message channel closed")
+			}
+
+			err := c.processDelivery(procCtx, msg)
+			if err == nil {
+				msg.Ack(false)
+				continue
+			}
+			logger := log.WithFields(log.Fields{
+				"trace_id": msg.CorrelationId,
+				"job_id":   msg.MessageId,
+			})
+			if errors.Is(err, storage.ErrJobNotFound) {
+				// The job expired or was deleted; retrying cannot help
+				logger.WithError(err).Warn("Dropping ingest.ready message for unknown job")
+				msg.Ack(false)
+				continue
+			}
+			logger.WithError(err).Error("Failed to ingest job")
+			// Retry with delay, or dead-letter permanent and exhausted failures
+			c.retrier.Handle(procCtx, publishChannel, msg, err, isPermanent(err), logger)
+		}
+	}
+}
+
+// stopConsuming cancels the consumer and requeues deliveries that were already prefetched
+func (c *Consumer) stopConsuming(channel *amqp091.Channel, msgs <-chan amqp091.Delivery) {
+	if err := channel.Cancel(consumerTag, false); err != nil {
+		log.WithError(err).Warn("Failed to cancel ingest consumer")
+		return
+	}
+	for msg := range msgs {
+		msg.Nack(false, true)
+	}
+}
+
+// processDelivery processes a message in a span continuing the completer's trace
+func (c *Consumer) processDelivery(ctx context.Context, msg amqp091.Delivery) error {
+	ctx, span := tracing.StartMessageSpan(ctx, c.queueName+" process", msg.Headers, msg.CorrelationId)
+	defer span.End()
+
+	err := c.processMessage(ctx, msg)
+	tracing.RecordError(span, err)
+	return err
+}
+
+// processMessage ingests the parser result of a single job
+func (c *Consumer) processMessage(ctx context.Context, msg amqp091.Delivery) error {
+	ready, err := models.IngestReadyFromJSON(msg.Body)
+	if err != nil {
+		return broker.Permanent(fmt.Errorf("failed to parse message: %w", err))
+	}
+
+	logger := log.WithFields(log.Fields{
+		"trace_id": ready.TraceID,
+		"job_id":   ready.JobID,
+	})
+
+	job, err := c.storage.GetJob(ctx, ready.JobID)
+	if err != nil {
+		return err
+	}
+	logger = logger.WithField("file_id", job.FileID)
+
+	// A newer version of the file is being processed; its job owns the file's points
+	if job.Status == models.JobStatusSuperseded {
+		logger.WithField("superseded_by", job.SupersededBy).Info("Skipping ingest of superseded job")
+		return nil
+	}
+
+	raw, err := c.parserClient.GetJobResult(ctx, job.JobID)
+	if err != nil {
+		return fmt.Errorf("failed to get parser result: %w", err)
+	}
+	result, err := models.ParserResultFromMap(raw)
+	if err != nil {
+		// The parser returns the same result every time
+		return broker.Permanent(err)
+	}
+
+	points, err := c.buildPoints(ctx, job, result)
+	if err != nil {
+		return err
+	}
+	if len(points) == 0 {
+		logger.Warn("Parser result has no paragraphs or Q&A, nothing to ingest")
+		return nil
+	}
+
+	if err := c.writePoints(ctx, job, points); err != nil {
+		return err
+	}
+
+	// Remember which parser version and content produced the file's vectors, beyond the job's retention
+	contentHash := result.ContentHash()
+	if err := c.storage.UpdateFileRecord(ctx, job.FileID, func(record *models.FileRecord) bool {
+		record.RecordIndexed(job, result.ParserVersion, contentHash, time.Now())
+		return true
+	}); err != nil {
+		logger.WithError(err).Warn("Failed to update file record")
+	}
+
+	logger.WithFields(log.Fields{
+		"points":         len(points),
+		"paragraphs":     len(result.Paragraphs),
+		"qa":             len(result.QA),
+		"parser_version": result.ParserVersion,
+		"embed_model":    c.embedder.Model(),
+	}).Info("Job ingested into Qdrant")
+
+	return nil
+}
+
+// buildPoints embeds paragraphs and Q&A pairs and turns them into Qdrant points
+func (c *Consumer) buildPoints(ctx context.Context, job *models.JobState, result *models.ParserResult) ([]qdrant.Point, error) {
+	chunkVectors, err := c.embedder.Embed(ctx, result.Paragraphs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed paragraphs: %w", err)
+	}
+
+	qaTexts := make([]string, len(result.QA))
+	for i, qa := range result.QA {
+		qaTexts[i] = qaText(qa)
+	}
+	qaVectors, err := c.embedder.Embed(ctx, qaTexts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed Q&A: %w", err)
+	}
+
+	if err := c.ensureCollection(ctx); err != nil {
+		return nil, err
+	}
+
+	points := buildChunkPoints(job, result, chunkVectors, nil, c.embedder.Model(), c.maxTextChars)
+	points = append(points, buildQAPoints(job, result, qaVectors, nil, c.embedder.Model(), c.maxTextChars)...)
+	return points, nil
+}
+
+// writePoints sets the file's principals on points, upserts them and drops stale points.
+// It holds the file's ACL lock so share events cannot interleave with the principals it writes.
+func (c *Consumer) writePoints(ctx context.Context, job *models.JobState, points []qdrant.Point) error {
+	unlock, err := c.acl.Lock(ctx, job.Tenant, job.FileID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	principals, err := c.principals(ctx, job)
+	if err != nil {
+		return err
+	}
+	for i := range points {
+		points[i].Payload["principals"] = principals
+	}
+
+	if err := c.qdrant.UpsertPoints(ctx, points); err != nil {
+		return err
+	}
+
+	// Drop points of previous versions, e.g. paragraphs that no longer exist
+	if err := c.qdrant.DeletePoints(ctx, qdrant.StaleFileFilter(job.Tenant, job.FileID, job.JobID)); err != nil {
+		return fmt.Errorf("failed to delete stale points: %w", err)
+	}
+	return nil
+}
+
+// principals returns the principals of a file: those of its indexed points and its current shares
+// in Nextcloud, including shares of its parent folders, with the stored share events applied,
+// e.g. shares created since they were read. The owner always has access.
+func (c *Consumer) principals(ctx context.Context, job *models.JobState) ([]string, error) {
+	principals, _, err := c.acl.Principals(ctx, job.Tenant, job.FileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read existing principals: %w", err)
+	}
+
+	shares, err := c.ncClient.GetFileShares(ctx, job.FilePath)
+	if err != nil && !errors.Is(err, nextcloud.ErrFileNotFound) {
+		return nil, fmt.Errorf("failed to read file shares: %w", err)
+	}
+	// A deleted file keeps the known principals until its delete event purges its points
+	for _, share := range shares {
+		if principal := share.Principal(); principal != "" {
+			principals = acl.Union(principals, principal)
+		}
+	}
+
+	principals, err = c.acl.ApplyStoredShares(ctx, job.Tenant, job.FileID, principals)
+	if err != nil {
+		return nil, err
+	}
+	return acl.Union(principals, acl.OwnerPrincipal(job.OwnerUID)), nil
+}
+
+// ensureCollection creates the collection on first use, sized from the embedding dimension
+func (c *Consumer) ensureCollection(ctx context.Context) error {
+	c.ensureMu.Lock()
+	defer c.ensureMu.Unlock()
+	if c.ensured {
+		return nil
+	}
+
+	dimension, err := c.embedder.Dimension(ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.qdrant.EnsureCollection(ctx, dimension); err != nil {
+		return fmt.Errorf("failed to ensure collection: %w", err)
+	}
+	c.ensured = true
+	return nil
+}
+
+// isPermanent classifies an ingest error as permanent (dead-letter now) or transient (retry later)
+func isPermanent(err error) bool {
+	if broker.IsPermanent(err) {
+		return true
+	}
+
+	var statusErr *parser.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Permanent()
+	}
+
+	return false
+}
+
+// Close closes the consume and publish channels
+func (c *Consumer) Close() error {
+	c.channelMu.RLock()
+	defer c.channelMu.RUnlock()
+
+	if c.publishChannel != nil {
+		c.publishChannel.Close()
+	}
+	if c.channel != nil {
+		c.channel.Close()
+	}
+	return nil
+}
+
+// Health checks the shared connection and the consume channel
+func (c *Consumer) Health(ctx context.Context) error {
+	if err := c.amqp.Health(ctx); err != nil {
+		return err
+	}
+
+	c.channelMu.RLock()
+	defer c.channelMu.RUnlock()
+	if c.channel == nil || c.channel.IsClosed() {
+		return fmt.Errorf("RabbitMQ channel is closed")
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package ingest
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strconv"
+
+	"nc-rag-worker/models"
+	"nc-rag-worker/qdrant"
+)
+
+const (
+	pointTypeChunk = "chunk"
+	pointTypeQA    = "qa"
+)
+
+// PointID derives a stable UUID for a point so re-ingesting a file overwrites its points
+func PointID(tenant string, fileID int64, pointType string, index int) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s:%d:%s:%d", tenant, fileID, pointType, index)))
+	// Format as an RFC 4122 version 5 UUID
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// basePayload returns the ACL and provenance fields shared by every point of a file
+func basePayload(job *models.JobState, result *models.ParserResult, principals []string, embedModel string) map[string]interface{} {
+	return map[string]interface{}{
+		"tenant":         job.Tenant,
+		"file_id":        strconv.FormatInt(job.FileID, 10),
+		"job_id":         job.JobID,
+		"owner_uid":      job.OwnerUID,
+		"principals":     principals,
+		"path":           job.FilePath,
+		"embed_model":    embedModel,
+		"parser_version": result.ParserVersion,
+	}
+}
+
+// buildChunkPoints builds chunk points filling only the chunk_vec named vector
+func buildChunkPoints(job *models.JobState, result *models.ParserResult, vectors [][]float32, principals []string, embedModel string, maxTextChars int) []qdrant.Point {
+	points := make([]qdrant.Point, 0, len(result.Paragraphs))
+	for i, text := range result.Paragraphs {
+		payload := basePayload(job, result, principals, embedModel)
+		payload["type"] = pointTypeChunk
+		payload["chunk_id"] = fmt.Sprintf("%d:%d", job.FileID, i)
+		payload["text"] = truncate(text, maxTextChars)
+
+		points = append(points, qdrant.Point{
+			ID:      PointID(job.Tenant, job.FileID, pointTypeChunk, i),
+			Vector:  map[string][]float32{qdrant.ChunkVector: vectors[i]},
+			Payload: payload,
+		})
+	}
+	return points
+}
+
+// buildQAPoints builds Q&A points filling only the qa_vec named vector
+func buildQAPoints(job *models.JobState, result *models.ParserResult, vectors [][]float32, principals []string, embedModel string, maxTextChars int) []qdrant.Point {
+	points := make([]qdrant.Point, 0, len(result.QA))
+	for i, qa := range result.QA {
+		payload := basePayload(job, result, principals, embedModel)
+		payload["type"] = pointTypeQA
+		payload["q"] = truncate(qa.Question, maxTextChars)
+		payload["a"] = truncate(qa.Answer, maxTextChars)
+		if qa.ParagraphIndex > 0 {
+			// Parser paragraph indexes are 1-based
+			payload["chunk_id"] = fmt.Sprintf("%d:%d", job.FileID, qa.ParagraphIndex-1)
+		}
+
+		points = append(points, qdrant.Point{
+			ID:      PointID(job.Tenant, job.FileID, pointTypeQA, i),
+			Vector:  map[string][]float32{qdrant.QAVector: vectors[i]},
+			Payload: payload,
+		})
+	}
+	return points
+}
+
+// qaText is the text embedded for a Q&A pair
+func qaText(qa models.QAResult) string {
+	return qa.Question + "\n" + qa.Answer
+}
+
+// truncate limits text to max runes to keep point payloads small
+func truncate(text string, max int) string {
+	if max <= 0 {
+		return text
+	}
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max])
+}
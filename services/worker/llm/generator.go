@@ -0,0 +1,36 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+
+	"nc-rag-worker/config"
+)
+
+// Message is a single chat message
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Generator produces answers from a chat prompt
+type Generator interface {
+	// Generate returns the assistant reply to the given messages
+	Generate(ctx context.Context, messages []Message, maxTokens int) (string, error)
+	// Model returns the model name used for generation
+	Model() string
+}
+
+// New creates the generator selected by LLM_PROVIDER, or nil if generation is disabled
+func New(cfg config.LLMConfig) (Generator, error) {
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case "ollama":
+		return NewOllamaClient(cfg.OllamaURL, cfg.OllamaBasicAuth, cfg.OllamaModel), nil
+	case "openai":
+		return NewOpenAIClient(cfg.OpenAIURL, cfg.OpenAIAPIKey, cfg.OpenAIModel), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider: %s", cfg.Provider)
+	}
+}
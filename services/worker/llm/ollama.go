@@ -0,0 +1,92 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"nc-rag-worker/tracing"
+)
+
+// OllamaClient generates answers with a self-hosted Ollama server
+type OllamaClient struct {
+	baseURL    string
+	basicAuth  atomic.Value
+	model      string
+	httpClient *http.Client
+}
+
+// NewOllamaClient creates a new Ollama chat client.
+// basicAuth is an optional "user:password" pair for Ollama behind a reverse proxy.
+func NewOllamaClient(baseURL, basicAuth, model string) *OllamaClient {
+	c := &OllamaClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		model:   model,
+		httpClient: &http.Client{
+			// CPU-only generation is slow
+			Timeout:   180 * time.Second,
+			Transport: tracing.Transport(http.DefaultTransport),
+		},
+	}
+	c.basicAuth.Store(basicAuth)
+	return c
+}
+
+// SetBasicAuth switches to a rotated "user:password" pair for all following requests
+func (c *OllamaClient) SetBasicAuth(basicAuth string) {
+	c.basicAuth.Store(basicAuth)
+}
+
+// Model returns the chat model name
+func (c *OllamaClient) Model() string {
+	return c.model
+}
+
+// Generate sends a non-streaming /api/chat request
+func (c *OllamaClient) Generate(ctx context.Context, messages []Message, maxTokens int) (string, error) {
+	requestBody, err := json.Marshal(map[string]interface{}{
+		"model":    c.model,
+		"messages": messages,
+		"stream":   false,
+		"options": map[string]interface{}{
+			"num_predict": maxTokens,
+			"temperature": 0.2,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/chat", bytes.NewReader(requestBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if username, password, _ := strings.Cut(c.basicAuth.Load().(string), ":"); username != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request to ollama: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("ollama returned error status: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Message Message `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return strings.TrimSpace(response.Message.Content), nil
+}
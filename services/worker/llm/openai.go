@@ -0,0 +1,92 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"nc-rag-worker/tracing"
+)
+
+// OpenAIClient generates answers with an OpenAI-compatible chat completions API
+type OpenAIClient struct {
+	baseURL    string
+	apiKey     atomic.Value
+	model      string
+	httpClient *http.Client
+}
+
+// NewOpenAIClient creates a new OpenAI-compatible chat client
+func NewOpenAIClient(baseURL, apiKey, model string) *OpenAIClient {
+	c := &OpenAIClient{
+		baseURL: strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v1"),
+		model:   model,
+		httpClient: &http.Client{
+			Timeout:   60 * time.Second,
+			Transport: tracing.Transport(http.DefaultTransport),
+		},
+	}
+	c.apiKey.Store(apiKey)
+	return c
+}
+
+// SetAPIKey switches to a rotated API key for all following requests
+func (c *OpenAIClient) SetAPIKey(apiKey string) {
+	c.apiKey.Store(apiKey)
+}
+
+// Model returns the chat model name
+func (c *OpenAIClient) Model() string {
+	return c.model
+}
+
+// Generate sends a /v1/chat/completions request
+func (c *OpenAIClient) Generate(ctx context.Context, messages []Message, maxTokens int) (string, error) {
+	requestBody, err := json.Marshal(map[string]interface{}{
+		"model":       c.model,
+		"messages":    messages,
+		"max_tokens":  maxTokens,
+		"temperature": 0.2,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/v1/chat/completions", bytes.NewReader(requestBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey := c.apiKey.Load().(string); apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request to chat API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("chat API returned error status: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Choices []struct {
+			Message Message `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("chat API returned no choices")
+	}
+
+	return strings.TrimSpace(response.Choices[0].Message.Content), nil
+}
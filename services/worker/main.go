@@ -2,105 +2,431 @@ package main
 
 import (
 	"context"
+	"flag"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"nc-rag-worker/admin"
+	"nc-rag-worker/archive"
+	"nc-rag-worker/broker"
+	"nc-rag-worker/completion"
 	"nc-rag-worker/config"
 	"nc-rag-worker/consumer"
+	"nc-rag-worker/embeddings"
+	"nc-rag-worker/health"
+	"nc-rag-worker/ingest"
+	"nc-rag-worker/metrics"
 	"nc-rag-worker/nextcloud"
 	"nc-rag-worker/parser"
+	"nc-rag-worker/poller"
+	"nc-rag-worker/publisher"
+	"nc-rag-worker/qdrant"
+	"nc-rag-worker/server"
 	"nc-rag-worker/storage"
+	"nc-rag-worker/tracing"
+	"nc-rag-worker/webhook"
 
 	log "github.com/sirupsen/logrus"
 )
 
 func main() {
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML config file; environment variables take precedence")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	flag.Parse()
+
 	// Initialize logging
 	log.SetFormatter(&log.JSONFormatter{})
 	log.SetLevel(log.InfoLevel)
-	
+
 	log.Info("Starting NC-RAG Worker...")
 
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := config.LoadFile(*configFile)
 	if err != nil {
 		log.WithError(err).Fatal("Failed to load configuration")
 	}
+	// Mask secrets in every log line from here on
+	redactHook := config.NewRedactHook(cfg)
+	log.AddHook(redactHook)
+	// Print before validating, so an invalid configuration can be inspected
+	if *printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.WithError(err).Fatal("Failed to print configuration")
+		}
+		return
+	}
+	if err := cfg.ValidateWorker(); err != nil {
+		log.WithError(err).Fatal("Invalid configuration")
+	}
 
 	log.WithFields(log.Fields{
-		"rabbitmq_queue": cfg.RabbitMQ.Queue,
-		"nextcloud_url":  cfg.Nextcloud.URL,
-		"parser_url":     cfg.Parser.URL,
+		"rabbitmq_queue":     cfg.RabbitMQ.Queue,
+		"nextcloud_url":      config.RedactURL(cfg.Nextcloud.URL),
+		"parser_url":         config.RedactURL(cfg.Parser.URL),
+		"parser_protocol":    cfg.Parser.Protocol,
 		"worker_concurrency": cfg.Worker.Concurrency,
+		"http_addr":          cfg.Server.Addr,
+		"job_store":          cfg.JobStore.Backend,
 	}).Info("Configuration loaded")
 
 	// Initialize components
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Initialize tracing
+	shutdownTracing, err := tracing.Init(ctx, cfg.Tracing, "nc-rag-worker")
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize tracing")
+	}
+
 	// Initialize Redis storage
-	storage, err := storage.NewRedisStorage(cfg.Redis.URL)
+	redisStorage, err := storage.NewRedisStorage(cfg.Redis.URL, cfg.Retention)
 	if err != nil {
 		log.WithError(err).Fatal("Failed to initialize Redis storage")
 	}
-	defer storage.Close()
+
+	// Initialize job store; the redis backend is the Redis storage itself
+	jobStore, err := storage.NewJobStore(ctx, cfg.JobStore, redisStorage)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize job store")
+	}
 
 	// Initialize Nextcloud client
 	ncClient := nextcloud.NewClient(cfg.Nextcloud.URL, cfg.Nextcloud.User, cfg.Nextcloud.Password)
+	ncClient.SetProcessableMimeTypes(cfg.Worker.MimeTypes)
 
 	// Initialize Parser client
-	parserClient := parser.NewClient(cfg.Parser.URL, cfg.Parser.Secret)
+	parserClient := parser.NewClient(cfg.Parser.URL, cfg.Parser.Secret, cfg.Parser.Protocol)
+
+	// Initialize Qdrant client
+	qdrantClient := qdrant.NewClient(cfg.Qdrant.URL, cfg.Qdrant.APIKey, cfg.Qdrant.Collection)
+
+	// Initialize the RabbitMQ connection shared by the consumers and the publisher;
+	// it is redialed after broker restarts and the components reopen their channels
+	amqpConn, err := broker.NewConnection(cfg.RabbitMQ.URL)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to connect to RabbitMQ")
+	}
+	go amqpConn.Start(ctx)
+
+	// Initialize ingest.ready publisher
+	ingestPublisher, err := publisher.NewRabbitMQPublisher(amqpConn, cfg.RabbitMQ.IngestQueue)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize RabbitMQ publisher")
+	}
+
+	completer := completion.NewCompleter(jobStore, redisStorage, ingestPublisher)
+
+	// Initialize HTTP server with the parser webhook receiver
+	httpServer := server.New(cfg.Server.Addr)
+	parserHandler := webhook.NewParserHandler(cfg.Parser.Secret, jobStore, completer)
+	httpServer.Handle("/webhooks/parser", tracing.Handler(parserHandler, "parser.webhook"))
+
+	// Admin lookups are only served with an admin token
+	var fileHandler *admin.FileHandler
+	if cfg.Server.AdminToken != "" {
+		fileHandler = admin.NewFileHandler(cfg.Server.AdminToken, jobStore)
+		httpServer.Handle(admin.FilesPath, tracing.Handler(fileHandler, "admin.files"))
+	}
+
+	// Readiness aggregates dependency checks; optional dependencies only degrade the worker
+	healthRegistry := health.NewRegistry(5 * time.Second)
+	healthRegistry.Register("redis", redisStorage, true)
+	if cfg.JobStore.Backend != "redis" {
+		healthRegistry.Register("job_store", jobStore, true)
+	}
+	healthRegistry.Register("rabbitmq_publisher", ingestPublisher, true)
+	healthRegistry.Register("nextcloud", ncClient, false)
+	healthRegistry.Register("parser", parserClient, false)
+	healthRegistry.Register("qdrant", qdrantClient, false)
+	httpServer.Handle("/healthz", health.LivenessHandler())
+	httpServer.Handle("/readyz", healthRegistry.ReadinessHandler())
+	httpServer.Handle("/metrics", metrics.Handler())
 
 	// Initialize RabbitMQ consumer
 	consumer, err := consumer.NewRabbitMQConsumer(
-		cfg.RabbitMQ.URL,
+		amqpConn,
 		cfg.RabbitMQ.Queue,
 		ncClient,
 		parserClient,
-		storage,
-		cfg.Worker.Concurrency,
+		redisStorage,
+		jobStore,
+		qdrantClient,
+		cfg.Worker,
 	)
 	if err != nil {
 		log.WithError(err).Fatal("Failed to initialize RabbitMQ consumer")
 	}
-	defer consumer.Close()
+	healthRegistry.Register("rabbitmq_consumer", consumer, true)
 
-	// Start consumer
+	// Start consumer; Start returns once in-flight messages are drained after ctx is cancelled
+	consumerDone := make(chan error, 1)
 	go func() {
-		if err := consumer.Start(ctx); err != nil {
-			log.WithError(err).Error("Consumer error")
+		consumerDone <- consumer.Start(ctx)
+	}()
+
+	// Start ingest consumer
+	var ingestConsumer *ingest.Consumer
+	var embedder embeddings.Embedder
+	ingestDone := make(chan error, 1)
+	if cfg.Ingest.Enabled {
+		embedder, err = embeddings.New(cfg.Embedding)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to initialize embedding provider")
+		}
+
+		ingestConsumer, err = ingest.NewConsumer(
+			amqpConn,
+			cfg.RabbitMQ.IngestQueue,
+			ncClient,
+			parserClient,
+			jobStore,
+			redisStorage,
+			qdrantClient,
+			embedder,
+			cfg.Ingest.MaxTextChars,
+			cfg.Worker.MaxRetries,
+			cfg.Worker.RetryDelays,
+		)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to initialize ingest consumer")
+		}
+		healthRegistry.Register("rabbitmq_ingest_consumer", ingestConsumer, true)
+
+		// Start returns once the message being ingested is done after ctx is cancelled
+		go func() {
+			ingestDone <- ingestConsumer.Start(ctx)
+		}()
+	} else {
+		ingestDone <- nil
+	}
+
+	// Index jobs saved before the job indexes existed
+	if cfg.JobStore.Backend == "redis" {
+		go func() {
+			indexed, err := redisStorage.RebuildJobIndexes(ctx)
+			if err != nil {
+				log.WithError(err).Warn("Failed to rebuild job indexes")
+				return
+			}
+			log.WithField("jobs", indexed).Info("Job indexes rebuilt")
+		}()
+	}
+
+	// Start parser status poller
+	var statusPoller *poller.Poller
+	if cfg.Poller.Enabled {
+		statusPoller = poller.NewPoller(cfg.Poller, parserClient, jobStore, completer)
+		go statusPoller.Start(ctx)
+	}
+
+	// Start job archival sweeper
+	if cfg.Retention.SweepInterval > 0 {
+		sweeper := archive.NewSweeper(cfg.Retention, jobStore)
+		go sweeper.Start(ctx)
+	}
+
+	// Start HTTP server
+	go func() {
+		if err := httpServer.Start(); err != nil {
+			log.WithError(err).Error("HTTP server error")
 			cancel()
 		}
 	}()
 
+	// Reload safe settings from the environment and config file on SIGHUP or when a secret file is rotated
+	targets := &reloadTargets{
+		redactHook:    redactHook,
+		amqpConn:      amqpConn,
+		consumer:      consumer,
+		ncClient:      ncClient,
+		parserClient:  parserClient,
+		parserHandler: parserHandler,
+		fileHandler:   fileHandler,
+		qdrantClient:  qdrantClient,
+		embedder:      embedder,
+		redisStorage:  redisStorage,
+		jobStore:      jobStore,
+		statusPoller:  statusPoller,
+	}
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	secretChanged := config.WatchSecretFiles(ctx, cfg.SecretFiles(), cfg.Worker.SecretPollInterval)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hupChan:
+			case <-secretChanged:
+			}
+			reloadConfig(*configFile, cfg, targets)
+		}
+	}()
+
 	log.Info("Worker started successfully")
 
 	// Wait for shutdown signal
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	exitCode := 0
 	select {
 	case sig := <-sigChan:
 		log.WithField("signal", sig).Info("Received shutdown signal")
 	case <-ctx.Done():
+		// Only a failed component cancels the context before a signal
 		log.Info("Context cancelled")
+		exitCode = 1
 	}
 
 	log.Info("Shutting down worker...")
-	
-	// Graceful shutdown with timeout
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+
+	// Stop consuming (basic.cancel) and drain in-flight messages.
+	// The parser webhook keeps being served meanwhile so completions are not lost.
+	cancel()
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), cfg.Worker.ShutdownTimeout+5*time.Second)
+	defer drainCancel()
+
+	drains := []struct {
+		name string
+		done chan error
+	}{
+		{"consumer", consumerDone},
+		{"ingest_consumer", ingestDone},
+	}
+	for _, drain := range drains {
+		select {
+		case err := <-drain.done:
+			if err != nil {
+				log.WithError(err).WithField("component", drain.name).Error("Consumer did not drain cleanly")
+				exitCode = 1
+			}
+		case <-drainCtx.Done():
+			log.WithField("component", drain.name).Error("Consumer did not stop before the drain deadline")
+			exitCode = 1
+		}
+	}
+
+	// Close in dependency order: inbound HTTP, AMQP consumers, publisher, Redis, tracing
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownCancel()
 
-	cancel() // Cancel main context
-	
-	// Wait for graceful shutdown or timeout
-	select {
-	case <-shutdownCtx.Done():
-		log.Warn("Shutdown timeout exceeded")
-	case <-time.After(5 * time.Second):
-		log.Info("Worker shutdown completed")
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.WithError(err).Warn("HTTP server shutdown failed")
+		exitCode = 1
+	}
+	consumer.Close()
+	if ingestConsumer != nil {
+		ingestConsumer.Close()
+	}
+	ingestPublisher.Close()
+	amqpConn.Close()
+	if closer, ok := jobStore.(interface{ Close() error }); ok && cfg.JobStore.Backend != "redis" {
+		closer.Close()
+	}
+	redisStorage.Close()
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.WithError(err).Warn("Tracing shutdown failed")
+	}
+
+	log.WithField("exit_code", exitCode).Info("Worker shutdown completed")
+	os.Exit(exitCode)
+}
+
+// reloadTargets are the running components that apply reloaded settings
+type reloadTargets struct {
+	redactHook    *config.RedactHook
+	amqpConn      *broker.Connection
+	consumer      *consumer.RabbitMQConsumer
+	ncClient      *nextcloud.Client
+	parserClient  *parser.Client
+	parserHandler *webhook.ParserHandler
+	fileHandler   *admin.FileHandler
+	qdrantClient  *qdrant.Client
+	embedder      embeddings.Embedder
+	redisStorage  *storage.RedisStorage
+	jobStore      storage.JobStore
+	statusPoller  *poller.Poller
+}
+
+// reloadConfig applies the reloadable settings that changed since cfg was loaded.
+// An invalid configuration is rejected as a whole and the running settings are kept.
+func reloadConfig(path string, cfg *config.Config, targets *reloadTargets) {
+	next, err := config.LoadFile(path)
+	if err == nil {
+		err = next.ValidateWorker()
+	}
+	if err != nil {
+		log.WithError(err).Error("Configuration reload failed, keeping the running configuration")
+		return
+	}
+
+	// Mask rotated secrets before anything can log them
+	targets.redactHook.Add(next)
+
+	reloaded, restart := cfg.Reload(next)
+	applied := make([]string, 0, len(reloaded))
+	resize := false
+	for _, key := range reloaded {
+		switch key {
+		case "TALK_BOT_SECRET":
+			// The Talk bot runs in the query service; the worker has no use for its secret
+			continue
+		case "WORKER_CONCURRENCY", "WORKER_PREFETCH":
+			resize = true
+		case "WORKER_MIME_TYPES":
+			targets.ncClient.SetProcessableMimeTypes(cfg.Worker.MimeTypes)
+		case "POLLER_RPS":
+			if targets.statusPoller != nil {
+				targets.statusPoller.SetRPS(cfg.Poller.RPS)
+			}
+		case "NEXTCLOUD_PASS":
+			targets.ncClient.SetPassword(cfg.Nextcloud.Password)
+		case "PARSER_SECRET":
+			targets.parserClient.SetSecret(cfg.Parser.Secret)
+			targets.parserHandler.SetSecret(cfg.Parser.Secret)
+		case "QDRANT_API_KEY":
+			targets.qdrantClient.SetAPIKey(cfg.Qdrant.APIKey)
+		case "ADMIN_TOKEN":
+			if targets.fileHandler == nil {
+				// The admin endpoints are only registered at startup
+				restart = append(restart, key)
+				continue
+			}
+			targets.fileHandler.SetToken(cfg.Server.AdminToken)
+		case "OPENAI_API_KEY":
+			if setter, ok := targets.embedder.(interface{ SetAPIKey(string) }); ok {
+				setter.SetAPIKey(cfg.Embedding.OpenAIAPIKey)
+			}
+		case "OLLAMA_BASIC_AUTH":
+			if setter, ok := targets.embedder.(interface{ SetBasicAuth(string) }); ok {
+				setter.SetBasicAuth(cfg.Embedding.OllamaBasicAuth)
+			}
+		case "RABBITMQ_URL":
+			// The consumers and the publisher share the connection, so all of them use the new credentials
+			targets.amqpConn.SetURL(cfg.RabbitMQ.URL)
+		case "REDIS_URL":
+			if err := targets.redisStorage.SetURL(cfg.Redis.URL); err != nil {
+				log.WithError(err).Error("Failed to apply rotated Redis credentials")
+			}
+		case "JOB_STORE_POSTGRES_URL":
+			if setter, ok := targets.jobStore.(interface{ SetURL(string) error }); ok && cfg.JobStore.Backend == "postgres" {
+				if err := setter.SetURL(cfg.JobStore.PostgresURL); err != nil {
+					log.WithError(err).Error("Failed to apply rotated PostgreSQL credentials")
+				}
+			}
+		}
+		applied = append(applied, key)
+	}
+	if resize {
+		targets.consumer.Reconfigure(cfg.Worker.Concurrency, cfg.Worker.Prefetch)
+	}
+
+	if len(restart) > 0 {
+		log.WithField("keys", restart).Warn("Configuration changes need a restart to take effect")
 	}
-}
\ No newline at end of file
+	log.WithField("applied", applied).Info("Configuration reloaded")
+}
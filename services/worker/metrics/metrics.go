@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "nc_rag"
+
+// Message outcomes for MessagesTotal
+const (
+	OutcomeConsumed     = "consumed"
+	OutcomeAcked        = "acked"
+	OutcomeRetried      = "retried"
+	OutcomeDeadLettered = "dead_lettered"
+	OutcomeRequeued     = "requeued"
+)
+
+var (
+	// MessagesTotal counts events.files deliveries by event type and outcome
+	MessagesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "messages_total",
+		Help:      "RabbitMQ deliveries by event type and outcome (consumed, acked, retried, dead_lettered, requeued).",
+	}, []string{"event_type", "outcome"})
+
+	// InFlight is the number of deliveries currently being processed
+	InFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "in_flight",
+		Help:      "Deliveries currently being processed by workers.",
+	})
+
+	// DebounceTotal counts file events delayed for the quiet window and those dropped for a later update
+	DebounceTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "debounce_total",
+		Help:      "File events delayed for the debounce window (delayed) or skipped for a later update of the same file (coalesced).",
+	}, []string{"outcome"})
+
+	// FetchDuration measures opening (streaming) or downloading (legacy) a file from Nextcloud
+	FetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "fetch_duration_seconds",
+		Help:      "Time to fetch a file from Nextcloud.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"tenant"})
+
+	// SubmitDuration measures submitting a file to the parser
+	SubmitDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "submit_duration_seconds",
+		Help:      "Time to submit a file to the parser.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"tenant", "protocol"})
+
+	// FileSize observes the size of files handed to the parser
+	FileSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "file_size_bytes",
+		Help:      "Size of files submitted to the parser.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 10),
+	}, []string{"tenant"})
+
+	// JobStatusChanges counts job state writes by the status written
+	JobStatusChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "jobs",
+		Name:      "status_changes_total",
+		Help:      "Job state writes by job status.",
+	}, []string{"status"})
+
+	// RedisDuration measures Redis commands by command name
+	RedisDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "redis",
+		Name:      "operation_duration_seconds",
+		Help:      "Redis command latency by command.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 12),
+	}, []string{"operation", "result"})
+
+	httpClientRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http_client",
+		Name:      "requests_total",
+		Help:      "Outgoing HTTP requests by target service, method and status code.",
+	}, []string{"service", "code", "method"})
+
+	httpClientDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http_client",
+		Name:      "request_duration_seconds",
+		Help:      "Outgoing HTTP request latency by target service.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "method"})
+)
+
+// Handler serves the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// InstrumentTransport counts requests by status code and observes latency for the given service
+func InstrumentTransport(service string, next http.RoundTripper) http.RoundTripper {
+	labels := prometheus.Labels{"service": service}
+	return promhttp.InstrumentRoundTripperCounter(
+		httpClientRequests.MustCurryWith(labels),
+		promhttp.InstrumentRoundTripperDuration(httpClientDuration.MustCurryWith(labels), next),
+	)
+}
+
+// Since observes the seconds elapsed since start
+func Since(observer prometheus.Observer, start time.Time) {
+	observer.Observe(time.Since(start).Seconds())
+}
+
+type redisStartKey struct{}
+
+// RedisHook observes the latency of every Redis command
+type RedisHook struct{}
+
+var _ redis.Hook = RedisHook{}
+
+// BeforeProcess records the command start time
+func (RedisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisStartKey{}, time.Now()), nil
+}
+
+// AfterProcess observes the command latency
+func (RedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	observeRedis(ctx, cmd.Name(), cmd.Err())
+	return nil
+}
+
+// BeforeProcessPipeline records the pipeline start time
+func (RedisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisStartKey{}, time.Now()), nil
+}
+
+// AfterProcessPipeline observes the pipeline latency as a single operation
+func (RedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmd.Err() != nil {
+			err = cmd.Err()
+			break
+		}
+	}
+	observeRedis(ctx, "pipeline", err)
+	return nil
+}
+
+func observeRedis(ctx context.Context, operation string, err error) {
+	start, ok := ctx.Value(redisStartKey{}).(time.Time)
+	if !ok {
+		return
+	}
+	result := "ok"
+	if err != nil && err != redis.Nil {
+		result = "error"
+	}
+	RedisDuration.WithLabelValues(operation, result).Observe(time.Since(start).Seconds())
+}
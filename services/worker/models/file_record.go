@@ -0,0 +1,83 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// FileRecord is the long-lived index record of a file.
+// It outlives the file's jobs, which are compacted into it when their retention expires.
+type FileRecord struct {
+	FileID   int64  `json:"file_id"`
+	Tenant   string `json:"tenant"`
+	FilePath string `json:"file_path"`
+
+	// Latest job of the file and its outcome
+	LastJobID       string    `json:"last_job_id"`
+	LastStatus      JobStatus `json:"last_status"`
+	LastError       string    `json:"last_error,omitempty"`
+	LastSubmittedAt time.Time `json:"last_submitted_at"`
+
+	// Job whose vectors are in the index
+	IndexedJobID  string    `json:"indexed_job_id,omitempty"`
+	FileVersion   string    `json:"file_version,omitempty"`
+	ParserVersion string    `json:"parser_version,omitempty"`
+	ContentHash   string    `json:"content_hash,omitempty"`
+	IndexedAt     time.Time `json:"indexed_at"`
+}
+
+// RecordJob makes job the file's latest job unless a newer job is already recorded.
+// It returns false if the record was left unchanged.
+func (r *FileRecord) RecordJob(job *JobState) bool {
+	if r.LastJobID != "" && r.LastJobID != job.JobID && job.SubmittedAt.Before(r.LastSubmittedAt) {
+		return false
+	}
+	r.FileID = job.FileID
+	r.Tenant = job.Tenant
+	r.FilePath = job.FilePath
+	r.LastJobID = job.JobID
+	r.LastStatus = job.Status
+	r.LastError = job.ErrorMessage
+	r.LastSubmittedAt = job.SubmittedAt
+	return true
+}
+
+// RecordIndexed records that job's result was written to the index
+func (r *FileRecord) RecordIndexed(job *JobState, parserVersion, contentHash string, at time.Time) {
+	r.RecordJob(job)
+	r.IndexedJobID = job.JobID
+	r.FileVersion = job.FileVersion
+	r.ParserVersion = parserVersion
+	r.ContentHash = contentHash
+	r.IndexedAt = at
+}
+
+// ContentHash returns the SHA-256 of the parsed paragraphs and Q&A, the input of the file's vectors
+func (p *ParserResult) ContentHash() string {
+	h := sha256.New()
+	json.NewEncoder(h).Encode(struct {
+		Paragraphs []string   `json:"paragraphs"`
+		QA         []QAResult `json:"qa"`
+	}{p.Paragraphs, p.QA})
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ToJSON converts the record to a JSON string
+func (r *FileRecord) ToJSON() (string, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// FileRecordFromJSON creates a FileRecord from a JSON string
+func FileRecordFromJSON(data string) (*FileRecord, error) {
+	var record FileRecord
+	if err := json.Unmarshal([]byte(data), &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
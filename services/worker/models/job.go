@@ -1,7 +1,9 @@
 package models
 
 import (
+	"crypto/rand"
 	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -23,9 +25,11 @@ type FileInfo struct {
 	Name     string `json:"name"`
 	Size     int64  `json:"size"`
 	MimeType string `json:"mimetype"`
+	MTime    int64  `json:"mtime,omitempty"`
+	ETag     string `json:"etag,omitempty"`
 }
 
-// ShareInfo contains share metadata (for future use)
+// ShareInfo contains share metadata
 type ShareInfo struct {
 	ID          int64  `json:"id,omitempty"`
 	ShareType   int    `json:"share_type,omitempty"`
@@ -33,6 +37,28 @@ type ShareInfo struct {
 	Permissions int    `json:"permissions,omitempty"`
 }
 
+// Nextcloud share types (OCP\Share\IShare::TYPE_*) that grant access to principals
+const (
+	ShareTypeUser  = 0
+	ShareTypeGroup = 1
+)
+
+// Principal returns the ACL principal the share grants access to ("u:<uid>" or
+// "g:<gid>"), or an empty string for share types that do not map to a principal
+func (s *ShareInfo) Principal() string {
+	if s.ShareWith == "" {
+		return ""
+	}
+	switch s.ShareType {
+	case ShareTypeUser:
+		return "u:" + s.ShareWith
+	case ShareTypeGroup:
+		return "g:" + s.ShareWith
+	default:
+		return ""
+	}
+}
+
 // JobState represents the state of a parsing job
 type JobState struct {
 	JobID          string                 `json:"job_id"`
@@ -46,6 +72,9 @@ type JobState struct {
 	ParserResponse map[string]interface{} `json:"parser_response,omitempty"`
 	ErrorMessage   string                 `json:"error_message,omitempty"`
 	RetryCount     int                    `json:"retry_count"`
+	FileVersion    string                 `json:"file_version,omitempty"`
+	SupersededBy   string                 `json:"superseded_by,omitempty"`
+	Transitions    []JobTransition        `json:"transitions,omitempty"`
 }
 
 // JobStatus represents the status of a parsing job
@@ -56,6 +85,8 @@ const (
 	JobStatusProcessing JobStatus = "processing"
 	JobStatusCompleted  JobStatus = "completed"
 	JobStatusFailed     JobStatus = "failed"
+	// JobStatusSuperseded marks a job replaced by a newer version of the same file
+	JobStatusSuperseded JobStatus = "superseded"
 )
 
 // ParserJobRequest represents a request to the parser API
@@ -73,12 +104,76 @@ type ParserJobResponse struct {
 	Message string `json:"message,omitempty"`
 }
 
+// ParserWebhookPayload represents a job status notification from the parser
+type ParserWebhookPayload struct {
+	TraceID string `json:"trace_id"`
+	JobID   string `json:"job_id"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+// IngestReadyMessage is published to the ingest.ready queue once a job has a result
+type IngestReadyMessage struct {
+	JobID   string `json:"job_id"`
+	TraceID string `json:"trace_id"`
+}
+
 // IsCreateOrUpdateEvent checks if the event is a file create or update
 func (e *FileEvent) IsCreateOrUpdateEvent() bool {
 	return e.Type == "OCP\\Files\\Events\\Node\\NodeCreatedEvent" ||
 		e.Type == "OCP\\Files\\Events\\Node\\NodeUpdatedEvent"
 }
 
+// IsDeleteEvent checks if the event is a node delete
+func (e *FileEvent) IsDeleteEvent() bool {
+	return e.Type == "OCP\\Files\\Events\\Node\\NodeDeletedEvent"
+}
+
+// IsShareCreatedEvent checks if the event grants a share
+func (e *FileEvent) IsShareCreatedEvent() bool {
+	return e.Type == "OCP\\Share\\Events\\ShareCreatedEvent"
+}
+
+// IsShareDeletedEvent checks if the event revokes a share
+func (e *FileEvent) IsShareDeletedEvent() bool {
+	return e.Type == "OCP\\Share\\Events\\ShareDeletedEvent"
+}
+
+// IsFolder checks if the event refers to a folder rather than a file
+func (e *FileEvent) IsFolder() bool {
+	return e.File.MimeType == "httpd/unix-directory"
+}
+
+// JobStatusFromParser maps a parser API status onto a job status
+func JobStatusFromParser(status string) JobStatus {
+	switch status {
+	case "succeeded", "completed", "finished":
+		return JobStatusCompleted
+	case "failed", "error":
+		return JobStatusFailed
+	case "processing", "running":
+		return JobStatusProcessing
+	default:
+		return JobStatusSubmitted
+	}
+}
+
+// IsFinal checks if the job has reached a terminal status
+func (j *JobState) IsFinal() bool {
+	return j.Status == JobStatusCompleted || j.Status == JobStatusFailed || j.Status == JobStatusSuperseded
+}
+
+// NewTraceID generates a random RFC 4122 version 4 UUID for requests that start a trace
+func NewTraceID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
 // ToJSON converts the struct to JSON string
 func (j *JobState) ToJSON() (string, error) {
 	data, err := json.Marshal(j)
@@ -0,0 +1,39 @@
+package models
+
+// Query modes
+const (
+	QueryModeExtractive = "extractive"
+	QueryModeGenerative = "generative"
+)
+
+// QueryRequest is the body of POST /query
+type QueryRequest struct {
+	UserID string `json:"user_id"`
+	Query  string `json:"query"`
+	Tenant string `json:"tenant,omitempty"`
+	Mode   string `json:"mode,omitempty"`
+}
+
+// QueryResponse is returned by POST /query
+type QueryResponse struct {
+	TraceID  string    `json:"trace_id"`
+	Answer   string    `json:"answer,omitempty"`
+	Found    bool      `json:"found"`
+	Snippets []Snippet `json:"snippets"`
+	Sources  []Source  `json:"sources"`
+}
+
+// Snippet is a retrieved passage the user is allowed to read
+type Snippet struct {
+	Text   string  `json:"text"`
+	Score  float64 `json:"score"`
+	FileID string  `json:"file_id"`
+	Path   string  `json:"path"`
+	Type   string  `json:"type"`
+}
+
+// Source is a file cited by a query response
+type Source struct {
+	FileID string `json:"file_id"`
+	Path   string `json:"path"`
+}
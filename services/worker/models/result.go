@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ParserResult is the decoded result of a completed parser job
+type ParserResult struct {
+	JobID         string     `json:"job_id"`
+	TraceID       string     `json:"trace_id"`
+	Status        string     `json:"status"`
+	ParserVersion string     `json:"parser_version"`
+	Filename      string     `json:"filename"`
+	Paragraphs    []string   `json:"paragraphs"`
+	QA            []QAResult `json:"qa"`
+}
+
+// QAResult is a generated question/answer pair pointing back at a paragraph
+type QAResult struct {
+	Question       string `json:"q"`
+	Answer         string `json:"a"`
+	ParagraphIndex int    `json:"paragraph_index"`
+}
+
+// ParserResultFromMap decodes the raw result returned by the parser API
+func ParserResultFromMap(raw map[string]interface{}) (*ParserResult, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize parser result: %w", err)
+	}
+
+	var result ParserResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode parser result: %w", err)
+	}
+	return &result, nil
+}
+
+// IngestReadyFromJSON decodes an ingest.ready message body
+func IngestReadyFromJSON(data []byte) (*IngestReadyMessage, error) {
+	var msg IngestReadyMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	if msg.JobID == "" {
+		return nil, fmt.Errorf("ingest.ready message without job_id")
+	}
+	return &msg, nil
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidTransition is matched by every TransitionError
+var ErrInvalidTransition = errors.New("invalid job status transition")
+
+// maxTransitions bounds the transition history kept per job
+const maxTransitions = 20
+
+// jobTransitions lists the statuses each status may move to.
+// The edges back to submitted and processing are retries at the parser.
+var jobTransitions = map[JobStatus][]JobStatus{
+	JobStatusSubmitted:  {JobStatusProcessing, JobStatusCompleted, JobStatusFailed, JobStatusSuperseded},
+	JobStatusProcessing: {JobStatusSubmitted, JobStatusCompleted, JobStatusFailed, JobStatusSuperseded},
+	JobStatusFailed:     {JobStatusSubmitted, JobStatusProcessing, JobStatusSuperseded},
+	JobStatusCompleted:  {JobStatusSuperseded},
+	JobStatusSuperseded: {},
+}
+
+// JobTransition is one entry of a job's status history
+type JobTransition struct {
+	From   JobStatus `json:"from,omitempty"`
+	To     JobStatus `json:"to"`
+	At     time.Time `json:"at"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// TransitionError is returned when a job cannot move from its current status to the requested one
+type TransitionError struct {
+	JobID string
+	From  JobStatus
+	To    JobStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("job %s cannot move from %s to %s", e.JobID, e.From, e.To)
+}
+
+// Unwrap lets callers match any transition error with errors.Is(err, ErrInvalidTransition)
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidTransition
+}
+
+// CanTransitionTo checks if the state machine allows moving from s to next
+func (s JobStatus) CanTransitionTo(next JobStatus) bool {
+	for _, allowed := range jobTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves the job to status and records it in the history.
+// It returns a *TransitionError if the state machine does not allow the move.
+func (j *JobState) Transition(status JobStatus, reason string, at time.Time) error {
+	if !j.Status.CanTransitionTo(status) {
+		return &TransitionError{JobID: j.JobID, From: j.Status, To: status}
+	}
+	j.recordTransition(j.Status, status, reason, at)
+	j.Status = status
+	return nil
+}
+
+// StartHistory records the initial status of a new job
+func (j *JobState) StartHistory(at time.Time) {
+	j.Transitions = nil
+	j.recordTransition("", j.Status, "", at)
+}
+
+func (j *JobState) recordTransition(from, to JobStatus, reason string, at time.Time) {
+	j.Transitions = append(j.Transitions, JobTransition{From: from, To: to, At: at, Reason: reason})
+	if len(j.Transitions) > maxTransitions {
+		j.Transitions = j.Transitions[len(j.Transitions)-maxTransitions:]
+	}
+}
+
+// UpdatedAt returns when the job last changed status, or its submission time
+func (j *JobState) UpdatedAt() time.Time {
+	if n := len(j.Transitions); n > 0 && j.Transitions[n-1].At.After(j.SubmittedAt) {
+		return j.Transitions[n-1].At
+	}
+	return j.SubmittedAt
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var allStatuses = []JobStatus{
+	JobStatusSubmitted,
+	JobStatusProcessing,
+	JobStatusCompleted,
+	JobStatusFailed,
+	JobStatusSuperseded,
+}
+
+func TestTransitionMatrix(t *testing.T) {
+	allowed := map[JobStatus]map[JobStatus]bool{
+		JobStatusSubmitted: {
+			JobStatusProcessing: true,
+			JobStatusCompleted:  true,
+			JobStatusFailed:     true,
+			JobStatusSuperseded: true,
+		},
+		JobStatusProcessing: {
+			JobStatusSubmitted:  true,
+			JobStatusCompleted:  true,
+			JobStatusFailed:     true,
+			JobStatusSuperseded: true,
+		},
+		JobStatusFailed: {
+			JobStatusSubmitted:  true,
+			JobStatusProcessing: true,
+			JobStatusSuperseded: true,
+		},
+		JobStatusCompleted: {
+			JobStatusSuperseded: true,
+		},
+		JobStatusSuperseded: {},
+	}
+
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, from := range allStatuses {
+		for _, to := range allStatuses {
+			want := allowed[from][to]
+			t.Run(string(from)+"->"+string(to), func(t *testing.T) {
+				if got := from.CanTransitionTo(to); got != want {
+					t.Fatalf("CanTransitionTo = %v, want %v", got, want)
+				}
+
+				job := &JobState{JobID: "job-1", Status: from}
+				err := job.Transition(to, "test", at)
+				if want {
+					if err != nil {
+						t.Fatalf("Transition: %v", err)
+					}
+					if job.Status != to || len(job.Transitions) != 1 {
+						t.Fatalf("job = %+v, want status %s with one transition", job, to)
+					}
+					return
+				}
+
+				var transitionErr *TransitionError
+				if !errors.As(err, &transitionErr) || !errors.Is(err, ErrInvalidTransition) {
+					t.Fatalf("Transition error = %v, want a *TransitionError matching ErrInvalidTransition", err)
+				}
+				if transitionErr.JobID != "job-1" || transitionErr.From != from || transitionErr.To != to {
+					t.Fatalf("TransitionError = %+v", transitionErr)
+				}
+				if job.Status != from || len(job.Transitions) != 0 {
+					t.Fatalf("rejected transition changed the job: %+v", job)
+				}
+			})
+		}
+	}
+}
+
+func TestTransitionHistory(t *testing.T) {
+	submitted := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	job := &JobState{JobID: "job-1", Status: JobStatusSubmitted, SubmittedAt: submitted}
+	job.StartHistory(submitted)
+
+	at := submitted
+	for i := 0; i < maxTransitions; i++ {
+		at = at.Add(time.Second)
+		next := JobStatusProcessing
+		if job.Status == JobStatusProcessing {
+			next = JobStatusSubmitted
+		}
+		if err := job.Transition(next, "retry", at); err != nil {
+			t.Fatalf("Transition %d: %v", i, err)
+		}
+	}
+
+	if len(job.Transitions) != maxTransitions {
+		t.Fatalf("history length = %d, want %d", len(job.Transitions), maxTransitions)
+	}
+	if first := job.Transitions[0]; first.From == "" {
+		t.Fatalf("oldest entry = %+v, want the initial entry dropped", first)
+	}
+	last := job.Transitions[len(job.Transitions)-1]
+	if last.To != job.Status || last.Reason != "retry" || !last.At.Equal(at) {
+		t.Fatalf("latest entry = %+v, want the last transition", last)
+	}
+	if got := job.UpdatedAt(); !got.Equal(at) {
+		t.Fatalf("UpdatedAt = %s, want %s", got, at)
+	}
+}
+
+func TestUpdatedAtWithoutHistory(t *testing.T) {
+	submitted := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	job := &JobState{Status: JobStatusSubmitted, SubmittedAt: submitted}
+
+	if got := job.UpdatedAt(); !got.Equal(submitted) {
+		t.Fatalf("UpdatedAt = %s, want %s", got, submitted)
+	}
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// TalkActivity is the Activity Streams 2.0 payload Nextcloud Talk posts to bots
+type TalkActivity struct {
+	Type   string     `json:"type"`
+	Actor  TalkActor  `json:"actor"`
+	Object TalkObject `json:"object"`
+	Target TalkTarget `json:"target"`
+}
+
+// TalkActor is the sender of a Talk message
+type TalkActor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// TalkObject is the message itself; Content is a JSON-encoded TalkMessage
+type TalkObject struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Content   string `json:"content"`
+	MediaType string `json:"mediaType"`
+}
+
+// TalkTarget is the conversation the message was posted in
+type TalkTarget struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// TalkMessage is the rich-object message inside TalkObject.Content
+type TalkMessage struct {
+	Message    string                          `json:"message"`
+	Parameters map[string]TalkMessageParameter `json:"parameters"`
+}
+
+// TalkMessageParameter is a placeholder such as {mention-user1}
+type TalkMessageParameter struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// TalkParticipant is an attendee of a Talk conversation
+type TalkParticipant struct {
+	// ActorType is users, guests, emails, groups, circles, federated_users or bots
+	ActorType string `json:"actorType"`
+	ActorID   string `json:"actorId"`
+}
+
+// UserID returns the Nextcloud user ID of the actor, or an empty string for guests and bots
+func (a *TalkActor) UserID() string {
+	if strings.HasPrefix(a.ID, "users/") {
+		return strings.TrimPrefix(a.ID, "users/")
+	}
+	return ""
+}
+
+// Message decodes the rich-object message of the activity
+func (a *TalkActivity) Message() (*TalkMessage, error) {
+	var message TalkMessage
+	if err := json.Unmarshal([]byte(a.Object.Content), &message); err != nil {
+		return nil, fmt.Errorf("failed to decode talk message: %w", err)
+	}
+	return &message, nil
+}
@@ -3,12 +3,21 @@ package nextcloud
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"nc-rag-worker/metrics"
 	"nc-rag-worker/models"
+	"nc-rag-worker/tracing"
 
 	"github.com/studio-b12/gowebdav"
 	log "github.com/sirupsen/logrus"
@@ -16,59 +25,112 @@ import (
 
 // Client represents a Nextcloud WebDAV client
 type Client struct {
-	webdav   *gowebdav.Client
-	baseURL  string
-	username string
+	authMu     sync.RWMutex
+	webdav     *gowebdav.Client
+	baseURL    string
+	username   string
+	password   string
+	httpClient *http.Client
+	// mimeTypes overrides defaultProcessableMimeTypes when set
+	mimeTypes atomic.Pointer[map[string]bool]
 }
 
 // NewClient creates a new Nextcloud client
 func NewClient(baseURL, username, password string) *Client {
+	return &Client{
+		webdav:   newWebDAVClient(baseURL, username, password),
+		baseURL:  baseURL,
+		username: username,
+		password: password,
+		httpClient: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: metrics.InstrumentTransport("nextcloud", tracing.Transport(http.DefaultTransport)),
+		},
+	}
+}
+
+// newWebDAVClient creates a WebDAV client for the files of username
+func newWebDAVClient(baseURL, username, password string) *gowebdav.Client {
 	// Construct WebDAV URL
 	webdavURL := strings.TrimSuffix(baseURL, "/") + "/remote.php/dav/files/" + username
 
 	// Create WebDAV client
 	client := gowebdav.NewClient(webdavURL, username, password)
+	client.SetTransport(metrics.InstrumentTransport("nextcloud", tracing.Transport(http.DefaultTransport)))
+	return client
+}
 
-	return &Client{
-		webdav:   client,
-		baseURL:  baseURL,
-		username: username,
-	}
+// SetPassword switches to a rotated password for all following requests
+func (c *Client) SetPassword(password string) {
+	client := newWebDAVClient(c.baseURL, c.username, password)
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	c.webdav = client
+	c.password = password
 }
 
-// FetchFile fetches a file from Nextcloud and returns its content as base64
-func (c *Client) FetchFile(ctx context.Context, event *models.FileEvent) (string, error) {
+// dav returns the WebDAV client with the current password
+func (c *Client) dav() *gowebdav.Client {
+	c.authMu.RLock()
+	defer c.authMu.RUnlock()
+	return c.webdav
+}
+
+// currentPassword returns the current password
+func (c *Client) currentPassword() string {
+	c.authMu.RLock()
+	defer c.authMu.RUnlock()
+	return c.password
+}
+
+var (
+	// ErrFileNotFound is returned when the file no longer exists in Nextcloud
+	ErrFileNotFound = errors.New("file not found")
+	// ErrFileTooLarge is returned when a file exceeds the size limit
+	ErrFileTooLarge = errors.New("file too large")
+)
+
+// maxFileSize is the largest file we hand to the parser (50MB)
+const maxFileSize = 50 * 1024 * 1024
+
+// OpenFile opens a streaming reader over a file's content in Nextcloud.
+// The caller must close the reader. Reads fail once the stream exceeds the size limit,
+// so the limit holds even when the event carries no or a stale size.
+func (c *Client) OpenFile(ctx context.Context, event *models.FileEvent) (io.ReadCloser, error) {
 	logger := log.WithFields(log.Fields{
-		"trace_id": event.TraceID,
-		"file_id":  event.File.ID,
+		"trace_id":  event.TraceID,
+		"file_id":   event.File.ID,
 		"file_path": event.File.Path,
 		"file_size": event.File.Size,
 	})
 
-	logger.Info("Fetching file from Nextcloud")
-
-	// Convert Nextcloud path to WebDAV path
-	// Remove /username prefix if present
-	webdavPath := event.File.Path
-	userPrefix := "/" + c.username + "/"
-	if strings.HasPrefix(webdavPath, userPrefix) {
-		webdavPath = strings.TrimPrefix(webdavPath, userPrefix)
-	}
-	// Remove leading slash if present
-	webdavPath = strings.TrimPrefix(webdavPath, "/")
+	logger.Info("Opening file stream from Nextcloud")
 
+	webdavPath := c.toWebDAVPath(event.File.Path)
 	logger.WithField("webdav_path", webdavPath).Debug("Converted file path for WebDAV")
 
-	// Check file size limit (50MB)
-	const maxFileSize = 50 * 1024 * 1024
+	// Check file size limit
 	if event.File.Size > maxFileSize {
-		return "", fmt.Errorf("file too large: %d bytes (max %d)", event.File.Size, maxFileSize)
+		return nil, fmt.Errorf("%w: %d bytes (max %d)", ErrFileTooLarge, event.File.Size, maxFileSize)
+	}
+
+	reader, err := c.dav().ReadStream(webdavPath)
+	if err != nil {
+		if gowebdav.IsErrNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrFileNotFound, webdavPath)
+		}
+		return nil, fmt.Errorf("failed to read file from WebDAV: %w", err)
 	}
 
-	// Read file content
-	reader, err := c.webdav.ReadStream(webdavPath)
+	return &limitedReadCloser{ReadCloser: reader, remaining: maxFileSize}, nil
+}
+
+// FetchFile fetches a file from Nextcloud and returns its content as base64.
+// It buffers the whole file and is only used by the legacy JSON parser protocol.
+func (c *Client) FetchFile(ctx context.Context, event *models.FileEvent) (string, error) {
+	reader, err := c.OpenFile(ctx, event)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file from WebDAV: %w", err)
+		return "", err
 	}
 	defer reader.Close()
 
@@ -78,27 +140,52 @@ func (c *Client) FetchFile(ctx context.Context, event *models.FileEvent) (string
 		return "", fmt.Errorf("failed to read file content: %w", err)
 	}
 
-	logger.WithField("content_size", len(content)).Debug("File content read successfully")
-
 	// Encode to base64
 	encoded := base64.StdEncoding.EncodeToString(content)
 
-	logger.WithField("encoded_size", len(encoded)).Info("File encoded to base64")
+	log.WithFields(log.Fields{
+		"trace_id":     event.TraceID,
+		"file_id":      event.File.ID,
+		"content_size": len(content),
+		"encoded_size": len(encoded),
+	}).Info("File encoded to base64")
 
 	return encoded, nil
 }
 
-// GetFileInfo retrieves file information from Nextcloud
-func (c *Client) GetFileInfo(ctx context.Context, filePath string) (os.FileInfo, error) {
-	// Convert Nextcloud path to WebDAV path
+// toWebDAVPath converts a Nextcloud path to a path relative to the user's WebDAV root
+func (c *Client) toWebDAVPath(filePath string) string {
+	// Remove /username prefix if present
 	webdavPath := filePath
 	userPrefix := "/" + c.username + "/"
 	if strings.HasPrefix(webdavPath, userPrefix) {
 		webdavPath = strings.TrimPrefix(webdavPath, userPrefix)
 	}
-	webdavPath = strings.TrimPrefix(webdavPath, "/")
+	// Remove leading slash if present
+	return strings.TrimPrefix(webdavPath, "/")
+}
 
-	info, err := c.webdav.Stat(webdavPath)
+// limitedReadCloser fails reads once more than remaining bytes have been read
+type limitedReadCloser struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (l *limitedReadCloser) Read(p []byte) (int, error) {
+	n, err := l.ReadCloser.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, fmt.Errorf("%w: exceeds %d bytes", ErrFileTooLarge, maxFileSize)
+	}
+	return n, err
+}
+
+// GetFileInfo retrieves file information from Nextcloud
+func (c *Client) GetFileInfo(ctx context.Context, filePath string) (os.FileInfo, error) {
+	// Convert Nextcloud path to WebDAV path
+	webdavPath := c.toWebDAVPath(filePath)
+
+	info, err := c.dav().Stat(webdavPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get file info: %w", err)
 	}
@@ -106,10 +193,179 @@ func (c *Client) GetFileInfo(ctx context.Context, filePath string) (os.FileInfo,
 	return info, nil
 }
 
+// FileVersion identifies the content version of a file: the ETag if known, otherwise
+// mtime and size from the event, otherwise the ETag from a WebDAV PROPFIND
+func (c *Client) FileVersion(ctx context.Context, event *models.FileEvent) (string, error) {
+	if event.File.ETag != "" {
+		return "etag:" + strings.Trim(event.File.ETag, `"`), nil
+	}
+	if event.File.MTime > 0 {
+		return fmt.Sprintf("mtime:%d:%d", event.File.MTime, event.File.Size), nil
+	}
+
+	webdavPath := c.toWebDAVPath(event.File.Path)
+	info, err := c.dav().Stat(webdavPath)
+	if err != nil {
+		if gowebdav.IsErrNotFound(err) {
+			return "", fmt.Errorf("%w: %s", ErrFileNotFound, webdavPath)
+		}
+		return "", fmt.Errorf("failed to get file info: %w", err)
+	}
+	if file, ok := info.(*gowebdav.File); ok && file.ETag() != "" {
+		return "etag:" + strings.Trim(file.ETag(), `"`), nil
+	}
+	return fmt.Sprintf("mtime:%d:%d", info.ModTime().Unix(), info.Size()), nil
+}
+
+// GetUserGroups resolves the groups of a user via the OCS provisioning API
+func (c *Client) GetUserGroups(ctx context.Context, userID string) ([]string, error) {
+	endpoint := strings.TrimSuffix(c.baseURL, "/") + "/ocs/v1.php/cloud/users/" + url.PathEscape(userID) + "/groups?format=json"
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCS request: %w", err)
+	}
+	req.SetBasicAuth(c.username, c.currentPassword())
+	req.Header.Set("OCS-APIRequest", "true")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send OCS request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OCS API returned error status: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		OCS struct {
+			Meta struct {
+				StatusCode int    `json:"statuscode"`
+				Message    string `json:"message"`
+			} `json:"meta"`
+			Data struct {
+				Groups []string `json:"groups"`
+			} `json:"data"`
+		} `json:"ocs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse OCS response: %w", err)
+	}
+
+	// OCS v1 reports errors in the envelope with HTTP 200 (100 means OK)
+	if response.OCS.Meta.StatusCode != 100 && response.OCS.Meta.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OCS API returned status %d: %s", response.OCS.Meta.StatusCode, response.OCS.Meta.Message)
+	}
+
+	return response.OCS.Data.Groups, nil
+}
+
+// GetRoomParticipants lists the attendees of a Talk conversation via the Talk OCS API.
+// The configured user must be a participant of the conversation.
+func (c *Client) GetRoomParticipants(ctx context.Context, token string) ([]models.TalkParticipant, error) {
+	endpoint := strings.TrimSuffix(c.baseURL, "/") + "/ocs/v2.php/apps/spreed/api/v4/room/" + url.PathEscape(token) + "/participants?format=json"
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCS request: %w", err)
+	}
+	req.SetBasicAuth(c.username, c.currentPassword())
+	req.Header.Set("OCS-APIRequest", "true")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send OCS request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// OCS v2 reports errors as HTTP status codes, e.g. 404 when we are not in the conversation
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OCS API returned error status: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		OCS struct {
+			Data []models.TalkParticipant `json:"data"`
+		} `json:"ocs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse OCS response: %w", err)
+	}
+	return response.OCS.Data, nil
+}
+
+// GetFileShares lists the shares that give access to a file via the OCS sharing API:
+// the shares of the file itself and the shares inherited from its parent folders.
+// The configured user must have access to the file.
+func (c *Client) GetFileShares(ctx context.Context, filePath string) ([]models.ShareInfo, error) {
+	query := "?format=json&reshares=true&path=" + url.QueryEscape("/"+c.toWebDAVPath(filePath))
+	base := strings.TrimSuffix(c.baseURL, "/") + "/ocs/v2.php/apps/files_sharing/api/v1/shares"
+
+	shares, err := c.getShares(ctx, base+query)
+	if err != nil {
+		return nil, err
+	}
+	inherited, err := c.getShares(ctx, base+"/inherited"+query)
+	if err != nil {
+		return nil, err
+	}
+	return append(shares, inherited...), nil
+}
+
+// getShares fetches a list of shares from an OCS sharing API endpoint
+func (c *Client) getShares(ctx context.Context, endpoint string) ([]models.ShareInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCS request: %w", err)
+	}
+	req.SetBasicAuth(c.username, c.currentPassword())
+	req.Header.Set("OCS-APIRequest", "true")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send OCS request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// OCS v2 reports errors as HTTP status codes, e.g. 404 when the path does not exist
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrFileNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OCS API returned error status: %d", resp.StatusCode)
+	}
+
+	// Share IDs are strings in OCS responses, so only the fields needed for principals are decoded
+	var response struct {
+		OCS struct {
+			Data []struct {
+				ShareType int    `json:"share_type"`
+				ShareWith string `json:"share_with"`
+			} `json:"data"`
+		} `json:"ocs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse OCS response: %w", err)
+	}
+
+	shares := make([]models.ShareInfo, 0, len(response.OCS.Data))
+	for _, share := range response.OCS.Data {
+		shares = append(shares, models.ShareInfo{ShareType: share.ShareType, ShareWith: share.ShareWith})
+	}
+	return shares, nil
+}
+
+// Username returns the Nextcloud user the client authenticates as
+func (c *Client) Username() string {
+	return c.username
+}
+
 // Health checks the connection to Nextcloud
 func (c *Client) Health(ctx context.Context) error {
 	// Try to list the root directory
-	_, err := c.webdav.ReadDir("/")
+	_, err := c.dav().ReadDir("/")
 	if err != nil {
 		return fmt.Errorf("Nextcloud health check failed: %w", err)
 	}
@@ -128,35 +384,52 @@ func (c *Client) ExtractOwnerFromPath(filePath string) string {
 	return c.username
 }
 
+// defaultProcessableMimeTypes are the file types sent to the parser unless WORKER_MIME_TYPES is set
+var defaultProcessableMimeTypes = map[string]bool{
+	// Documents
+	"application/pdf":                                                true,
+	"application/msword":                                             true,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": true,
+	"application/vnd.ms-excel":                                       true,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": true,
+	"application/vnd.ms-powerpoint":                                  true,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
+	
+	// Text files
+	"text/plain":     true,
+	"text/markdown":  true,
+	"text/csv":       true,
+	"text/html":      true,
+	"text/xml":       true,
+	"application/xml": true,
+	"application/json": true,
+	
+	// Rich text
+	"application/rtf": true,
+	
+	// OpenDocument formats
+	"application/vnd.oasis.opendocument.text":         true,
+	"application/vnd.oasis.opendocument.spreadsheet":  true,
+	"application/vnd.oasis.opendocument.presentation": true,
+}
+
+// SetProcessableMimeTypes replaces the processable file types; an empty list restores the defaults
+func (c *Client) SetProcessableMimeTypes(mimeTypes []string) {
+	if len(mimeTypes) == 0 {
+		c.mimeTypes.Store(nil)
+		return
+	}
+	allowed := make(map[string]bool, len(mimeTypes))
+	for _, mimeType := range mimeTypes {
+		allowed[mimeType] = true
+	}
+	c.mimeTypes.Store(&allowed)
+}
+
 // IsProcessableFile checks if the file type is processable by the parser
 func (c *Client) IsProcessableFile(mimeType string) bool {
-	processableMimeTypes := map[string]bool{
-		// Documents
-		"application/pdf":                                                true,
-		"application/msword":                                             true,
-		"application/vnd.openxmlformats-officedocument.wordprocessingml.document": true,
-		"application/vnd.ms-excel":                                       true,
-		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": true,
-		"application/vnd.ms-powerpoint":                                  true,
-		"application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
-		
-		// Text files
-		"text/plain":     true,
-		"text/markdown":  true,
-		"text/csv":       true,
-		"text/html":      true,
-		"text/xml":       true,
-		"application/xml": true,
-		"application/json": true,
-		
-		// Rich text
-		"application/rtf": true,
-		
-		// OpenDocument formats
-		"application/vnd.oasis.opendocument.text":         true,
-		"application/vnd.oasis.opendocument.spreadsheet":  true,
-		"application/vnd.oasis.opendocument.presentation": true,
-	}
-
-	return processableMimeTypes[mimeType]
+	if allowed := c.mimeTypes.Load(); allowed != nil {
+		return (*allowed)[mimeType]
+	}
+	return defaultProcessableMimeTypes[mimeType]
 }
\ No newline at end of file
@@ -0,0 +1,63 @@
+package nextcloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetFileShares(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "rag" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		paths = append(paths, r.URL.Query().Get("path"))
+		switch r.URL.Path {
+		case "/ocs/v2.php/apps/files_sharing/api/v1/shares":
+			fmt.Fprint(w, `{"ocs":{"data":[{"id":"7","share_type":0,"share_with":"bob"},{"id":"8","share_type":3}]}}`)
+		case "/ocs/v2.php/apps/files_sharing/api/v1/shares/inherited":
+			fmt.Fprint(w, `{"ocs":{"data":[{"id":"9","share_type":1,"share_with":"staff"}]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "rag", "secret")
+	shares, err := client.GetFileShares(context.Background(), "/rag/Projects/plan.pdf")
+	if err != nil {
+		t.Fatalf("GetFileShares: %v", err)
+	}
+
+	var principals []string
+	for _, share := range shares {
+		if principal := share.Principal(); principal != "" {
+			principals = append(principals, principal)
+		}
+	}
+	if len(principals) != 2 || principals[0] != "u:bob" || principals[1] != "g:staff" {
+		t.Fatalf("principals = %v, want [u:bob g:staff]", principals)
+	}
+	for _, path := range paths {
+		if path != "/Projects/plan.pdf" {
+			t.Fatalf("path = %q, want the path relative to the user's root", path)
+		}
+	}
+}
+
+func TestGetFileSharesNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "rag", "secret")
+	if _, err := client.GetFileShares(context.Background(), "/rag/files/gone.pdf"); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("err = %v, want ErrFileNotFound", err)
+	}
+}
@@ -5,34 +5,195 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"nc-rag-worker/metrics"
 	"nc-rag-worker/models"
+	"nc-rag-worker/tracing"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// Parser submit protocols
+const (
+	// ProtocolMultipart streams the file as multipart/form-data to /parser/jobs
+	ProtocolMultipart = "multipart"
+	// ProtocolJSON sends base64 content inside a JSON body to /jobs (legacy)
+	ProtocolJSON = "json"
+)
+
+const (
+	// requestTimeout bounds status, result and cancel calls, and the wait for a submit response
+	requestTimeout = 30 * time.Second
+	// submitTimeout bounds a whole submit, including reading the file from Nextcloud and uploading it
+	submitTimeout = 10 * time.Minute
+)
+
+// StatusError is returned when the parser API answers with an unexpected HTTP status
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("parser API returned error status: %d", e.StatusCode)
+}
+
+// Permanent reports whether the parser rejected the payload itself, so retrying cannot succeed.
+// Auth and routing errors (401, 403, 404) are usually configuration or deploy problems and are retried.
+func (e *StatusError) Permanent() bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType:
+		return true
+	}
+	return false
+}
+
 // Client represents a parser API client
 type Client struct {
 	baseURL    string
-	secret     string
+	secret     atomic.Value
+	protocol   string
 	httpClient *http.Client
+	// submitClient has no overall timeout, so large uploads on slow links are not cut off
+	submitClient *http.Client
 }
 
 // NewClient creates a new parser client
-func NewClient(baseURL, secret string) *Client {
-	return &Client{
-		baseURL: strings.TrimSuffix(baseURL, "/"),
-		secret:  secret,
+func NewClient(baseURL, secret, protocol string) *Client {
+	// Submits are bounded by submitTimeout through their context and by the wait for the response
+	submitTransport := http.DefaultTransport.(*http.Transport).Clone()
+	submitTransport.ResponseHeaderTimeout = requestTimeout
+
+	c := &Client{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		protocol: protocol,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   requestTimeout,
+			Transport: metrics.InstrumentTransport("parser", tracing.Transport(http.DefaultTransport)),
 		},
+		submitClient: &http.Client{
+			Transport: metrics.InstrumentTransport("parser", tracing.Transport(submitTransport)),
+		},
+	}
+	c.secret.Store(secret)
+	return c
+}
+
+// SetSecret switches to a rotated API secret for all following requests
+func (c *Client) SetSecret(secret string) {
+	c.secret.Store(secret)
+}
+
+// authorize adds the API secret as bearer token, if one is configured
+func (c *Client) authorize(req *http.Request) {
+	if secret := c.secret.Load().(string); secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+}
+
+// Protocol returns the submit protocol the client is configured for
+func (c *Client) Protocol() string {
+	return c.protocol
+}
+
+// SubmitJobStream streams a file to the parser as multipart/form-data and returns the job ID.
+// The body is produced through an io.Pipe, so the file is never fully held in memory.
+func (c *Client) SubmitJobStream(ctx context.Context, event *models.FileEvent, content io.Reader) (*models.ParserJobResponse, error) {
+	logger := log.WithFields(log.Fields{
+		"trace_id":   event.TraceID,
+		"file_id":    event.File.ID,
+		"file_name":  event.File.Name,
+		"file_size":  event.File.Size,
+		"parser_url": c.baseURL,
+	})
+
+	logger.Info("Streaming file to parser API")
+
+	ctx, cancel := context.WithTimeout(ctx, submitTimeout)
+	defer cancel()
+
+	pipeReader, pipeWriter := io.Pipe()
+	writer := multipart.NewWriter(pipeWriter)
+
+	// Write the form in the background; errors surface to the HTTP client through the pipe
+	go func() {
+		pipeWriter.CloseWithError(writeMultipartJob(writer, event, content))
+	}()
+
+	url := c.baseURL + "/parser/jobs"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, pipeReader)
+	if err != nil {
+		pipeReader.CloseWithError(err)
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	c.authorize(req)
+
+	logger.WithField("url", url).Debug("Sending multipart request to parser API")
+
+	resp, err := c.submitClient.Do(req)
+	if err != nil {
+		// Unblock the writer goroutine if the request failed before consuming the body
+		pipeReader.CloseWithError(err)
+		return nil, fmt.Errorf("failed to send request to parser: %w", err)
+	}
+	defer resp.Body.Close()
+
+	logger.WithField("status_code", resp.StatusCode).Debug("Received response from parser API")
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusAccepted {
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	var response models.ParserJobResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if response.JobID == "" {
+		return nil, fmt.Errorf("parser API returned no job_id")
+	}
+
+	logger.WithFields(log.Fields{
+		"job_id": response.JobID,
+		"status": response.Status,
+	}).Info("Job submitted to parser successfully")
+
+	return &response, nil
+}
+
+// writeMultipartJob writes the trace_id field and the file part, then closes the form
+func writeMultipartJob(writer *multipart.Writer, event *models.FileEvent, content io.Reader) error {
+	if err := writer.WriteField("trace_id", event.TraceID); err != nil {
+		return fmt.Errorf("failed to write trace_id field: %w", err)
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, event.File.Name))
+	mimeType := event.File.MimeType
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
 	}
+	header.Set("Content-Type", mimeType)
+
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return fmt.Errorf("failed to create file part: %w", err)
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return fmt.Errorf("failed to stream file content: %w", err)
+	}
+
+	return writer.Close()
 }
 
-// SubmitJob submits a file for parsing and returns the job ID
+// SubmitJob submits base64 file content as JSON and returns the job ID (legacy protocol)
 func (c *Client) SubmitJob(ctx context.Context, event *models.FileEvent, content string) (*models.ParserJobResponse, error) {
 	logger := log.WithFields(log.Fields{
 		"trace_id":  event.TraceID,
@@ -44,6 +205,9 @@ func (c *Client) SubmitJob(ctx context.Context, event *models.FileEvent, content
 
 	logger.Info("Submitting file to parser API")
 
+	ctx, cancel := context.WithTimeout(ctx, submitTimeout)
+	defer cancel()
+
 	// Create request payload
 	request := &models.ParserJobRequest{
 		Content:  content,
@@ -75,14 +239,12 @@ func (c *Client) SubmitJob(ctx context.Context, event *models.FileEvent, content
 
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
-	if c.secret != "" {
-		req.Header.Set("Authorization", "Bearer "+c.secret)
-	}
+	c.authorize(req)
 
 	logger.WithField("url", url).Debug("Sending request to parser API")
 
 	// Send request
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.submitClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request to parser: %w", err)
 	}
@@ -92,7 +254,7 @@ func (c *Client) SubmitJob(ctx context.Context, event *models.FileEvent, content
 
 	// Check response status
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("parser API returned error status: %d", resp.StatusCode)
+		return nil, &StatusError{StatusCode: resp.StatusCode}
 	}
 
 	// Parse response
@@ -115,16 +277,14 @@ func (c *Client) GetJobStatus(ctx context.Context, jobID string) (*models.Parser
 	logger.Debug("Getting job status from parser API")
 
 	// Create HTTP request
-	url := fmt.Sprintf("%s/jobs/%s", c.baseURL, jobID)
+	url := fmt.Sprintf("%s/jobs/%s/status", c.baseURL, jobID)
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
 	// Set headers
-	if c.secret != "" {
-		req.Header.Set("Authorization", "Bearer "+c.secret)
-	}
+	c.authorize(req)
 
 	// Send request
 	resp, err := c.httpClient.Do(req)
@@ -135,12 +295,9 @@ func (c *Client) GetJobStatus(ctx context.Context, jobID string) (*models.Parser
 
 	logger.WithField("status_code", resp.StatusCode).Debug("Received response from parser API")
 
-	// Check response status
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, fmt.Errorf("job not found: %s", jobID)
-	}
+	// Check response status; a 404 means the parser does not know the job
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("parser API returned error status: %d", resp.StatusCode)
+		return nil, &StatusError{StatusCode: resp.StatusCode}
 	}
 
 	// Parse response
@@ -167,9 +324,7 @@ func (c *Client) GetJobResult(ctx context.Context, jobID string) (map[string]int
 	}
 
 	// Set headers
-	if c.secret != "" {
-		req.Header.Set("Authorization", "Bearer "+c.secret)
-	}
+	c.authorize(req)
 
 	// Send request
 	resp, err := c.httpClient.Do(req)
@@ -185,7 +340,7 @@ func (c *Client) GetJobResult(ctx context.Context, jobID string) (map[string]int
 		return nil, fmt.Errorf("job result not found: %s", jobID)
 	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("parser API returned error status: %d", resp.StatusCode)
+		return nil, &StatusError{StatusCode: resp.StatusCode}
 	}
 
 	// Parse response
@@ -199,6 +354,34 @@ func (c *Client) GetJobResult(ctx context.Context, jobID string) (map[string]int
 	return result, nil
 }
 
+// CancelJob asks the parser to cancel a job that is no longer needed.
+// It returns false without error if the parser does not support cancellation
+// or the job is unknown or already finished.
+func (c *Client) CancelJob(ctx context.Context, jobID string) (bool, error) {
+	url := fmt.Sprintf("%s/jobs/%s", c.baseURL, jobID)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	c.authorize(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to send request to parser: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent:
+		return true, nil
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusConflict, http.StatusNotImplemented:
+		return false, nil
+	default:
+		return false, &StatusError{StatusCode: resp.StatusCode}
+	}
+}
+
 // Health checks the parser API health
 func (c *Client) Health(ctx context.Context) error {
 	// Create HTTP request
@@ -0,0 +1,30 @@
+package parser
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestStatusErrorPermanent(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{status: http.StatusBadRequest, want: true},
+		{status: http.StatusRequestEntityTooLarge, want: true},
+		{status: http.StatusUnsupportedMediaType, want: true},
+		{status: http.StatusUnauthorized, want: false},
+		{status: http.StatusForbidden, want: false},
+		{status: http.StatusNotFound, want: false},
+		{status: http.StatusTooManyRequests, want: false},
+		{status: http.StatusInternalServerError, want: false},
+		{status: http.StatusServiceUnavailable, want: false},
+	}
+
+	for _, tt := range tests {
+		err := &StatusError{StatusCode: tt.status}
+		if got := err.Permanent(); got != tt.want {
+			t.Fatalf("StatusError{%d}.Permanent() = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package poller
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TokenBucket is a global rate limiter shared by all parser status requests
+type TokenBucket struct {
+	mu       sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+// NewTokenBucket creates a token bucket refilling at rps tokens per second
+func NewTokenBucket(rps float64) *TokenBucket {
+	capacity := bucketCapacity(rps)
+	return &TokenBucket{
+		rate:     rps,
+		capacity: capacity,
+		tokens:   capacity,
+		last:     time.Now(),
+	}
+}
+
+// SetRate changes the refill rate; tokens already in the bucket are kept up to the new capacity
+func (b *TokenBucket) SetRate(rps float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(time.Now())
+	b.rate = rps
+	b.capacity = bucketCapacity(rps)
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+}
+
+// bucketCapacity allows bursts of one second worth of tokens, and at least one token
+func bucketCapacity(rps float64) float64 {
+	if rps < 1 {
+		return 1
+	}
+	return rps
+}
+
+// Wait blocks until a token is available or the context is cancelled
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		delay := b.reserve()
+		if delay == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token if available, otherwise returns how long to wait for one
+func (b *TokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// refill adds the tokens accrued since the last refill; callers hold mu
+func (b *TokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+}
@@ -0,0 +1,54 @@
+package poller
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketRefill(t *testing.T) {
+	b := NewTokenBucket(2)
+	start := b.last
+
+	// A full bucket holds one second of tokens
+	for i := 0; i < 2; i++ {
+		if delay := b.reserve(); delay != 0 {
+			t.Fatalf("reserve %d: delay = %s, want a token", i, delay)
+		}
+	}
+	if delay := b.reserve(); delay <= 0 || delay > 500*time.Millisecond {
+		t.Fatalf("empty bucket: delay = %s, want up to 500ms", delay)
+	}
+
+	b.tokens, b.last = 0, start
+	b.refill(start.Add(250 * time.Millisecond))
+	if b.tokens != 0.5 {
+		t.Fatalf("tokens after 250ms = %v, want 0.5", b.tokens)
+	}
+	b.refill(start.Add(10 * time.Second))
+	if b.tokens != 2 {
+		t.Fatalf("tokens after 10s = %v, want capacity 2", b.tokens)
+	}
+}
+
+func TestTokenBucketSetRate(t *testing.T) {
+	b := NewTokenBucket(10)
+	b.SetRate(0.5)
+	if b.capacity != 1 || b.tokens > 1 {
+		t.Fatalf("capacity = %v, tokens = %v; want both capped at 1", b.capacity, b.tokens)
+	}
+}
+
+func TestTokenBucketWaitCancelled(t *testing.T) {
+	b := NewTokenBucket(0.1)
+	if err := b.Wait(context.Background()); err != nil {
+		t.Fatalf("first Wait: %v", err)
+	}
+
+	// The next token is 10s away
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Wait = %v, want context.DeadlineExceeded", err)
+	}
+}
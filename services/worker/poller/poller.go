@@ -0,0 +1,226 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"nc-rag-worker/completion"
+	"nc-rag-worker/config"
+	"nc-rag-worker/models"
+	"nc-rag-worker/parser"
+	"nc-rag-worker/storage"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// pollState tracks backoff for a single outstanding job
+type pollState struct {
+	attempts int
+	nextPoll time.Time
+}
+
+// Poller polls the parser for jobs whose completion webhook never arrived
+type Poller struct {
+	parserClient *parser.Client
+	storage      storage.JobStore
+	completer    *completion.Completer
+	limiter      *TokenBucket
+	scanInterval time.Duration
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	states       map[string]*pollState
+}
+
+// NewPoller creates a new parser status poller
+func NewPoller(
+	cfg config.PollerConfig,
+	parserClient *parser.Client,
+	storage storage.JobStore,
+	completer *completion.Completer,
+) *Poller {
+	return &Poller{
+		parserClient: parserClient,
+		storage:      storage,
+		completer:    completer,
+		limiter:      NewTokenBucket(cfg.RPS),
+		scanInterval: cfg.ScanInterval,
+		minBackoff:   cfg.MinBackoff,
+		maxBackoff:   cfg.MaxBackoff,
+		states:       make(map[string]*pollState),
+	}
+}
+
+// SetRPS changes the global rate of parser status requests
+func (p *Poller) SetRPS(rps float64) {
+	p.limiter.SetRate(rps)
+}
+
+// Start runs the poll loop until the context is cancelled
+func (p *Poller) Start(ctx context.Context) error {
+	log.WithFields(log.Fields{
+		"scan_interval": p.scanInterval.String(),
+		"min_backoff":   p.minBackoff.String(),
+		"max_backoff":   p.maxBackoff.String(),
+	}).Info("Starting parser status poller")
+
+	ticker := time.NewTicker(p.scanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Parser status poller stopped")
+			return nil
+		case <-ticker.C:
+			p.scan(ctx)
+		}
+	}
+}
+
+// outstandingStatuses are the job statuses the poller waits on
+var outstandingStatuses = []models.JobStatus{models.JobStatusSubmitted, models.JobStatusProcessing}
+
+// scan polls every outstanding job whose backoff has elapsed
+func (p *Poller) scan(ctx context.Context) {
+	seen := make(map[string]bool)
+	now := time.Now()
+
+	for _, status := range outstandingStatuses {
+		cursor := ""
+		for {
+			page, err := p.storage.ListJobsByStatus(ctx, status, cursor, storage.DefaultPageSize)
+			if err != nil {
+				log.WithError(err).WithField("status", status).Warn("Failed to list jobs for polling")
+				return
+			}
+			for _, job := range page.Jobs {
+				if ctx.Err() != nil {
+					return
+				}
+				seen[job.JobID] = true
+				p.scanJob(ctx, job, now)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+	}
+
+	// Forget jobs that finished, expired or were deleted
+	for jobID := range p.states {
+		if !seen[jobID] {
+			delete(p.states, jobID)
+		}
+	}
+}
+
+// scanJob polls a single outstanding job if its backoff has elapsed
+func (p *Poller) scanJob(ctx context.Context, job *models.JobState, now time.Time) {
+	state, ok := p.states[job.JobID]
+	if !ok {
+		// Give the webhook a chance before the first poll
+		state = &pollState{nextPoll: now.Add(p.backoff(0))}
+		p.states[job.JobID] = state
+	}
+	if now.Before(state.nextPoll) {
+		return
+	}
+
+	// Skip jobs the webhook path has finalized since the page was read
+	latest, err := p.storage.GetJob(ctx, job.JobID)
+	if err != nil {
+		if errors.Is(err, storage.ErrJobNotFound) {
+			delete(p.states, job.JobID)
+		}
+		return
+	}
+	if latest.IsFinal() {
+		delete(p.states, job.JobID)
+		return
+	}
+
+	if p.poll(ctx, latest) {
+		delete(p.states, job.JobID)
+		return
+	}
+
+	state.attempts++
+	state.nextPoll = time.Now().Add(p.backoff(state.attempts))
+}
+
+// poll checks a single job and returns true once it reached a terminal state
+func (p *Poller) poll(ctx context.Context, job *models.JobState) bool {
+	logger := log.WithFields(log.Fields{
+		"trace_id": job.TraceID,
+		"job_id":   job.JobID,
+		"file_id":  job.FileID,
+	})
+
+	if err := p.limiter.Wait(ctx); err != nil {
+		return false
+	}
+	status, err := p.parserClient.GetJobStatus(ctx, job.JobID)
+	var statusErr *parser.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		// The parser lost the job, e.g. after a restart; it will never finish
+		logger.Warn("Parser does not know the polled job, marking it failed")
+		status = &models.ParserJobResponse{Status: "failed", Message: "job not found at parser"}
+	} else if err != nil {
+		logger.WithError(err).Warn("Failed to poll parser job status")
+		return false
+	}
+
+	switch models.JobStatusFromParser(status.Status) {
+	case models.JobStatusCompleted:
+		// The ingest consumer fetches the result itself once the job is published as ready
+		logger.Info("Parser job completed (detected by poller)")
+
+		if err := p.completer.Complete(ctx, job); err != nil {
+			if errors.Is(err, models.ErrInvalidTransition) {
+				logger.WithError(err).Warn("Polled job status conflicts with stored status")
+				return true
+			}
+			logger.WithError(err).Error("Failed to complete polled job")
+			return false
+		}
+		return true
+
+	case models.JobStatusFailed:
+		if err := p.completer.Fail(ctx, job, status.Message); err != nil {
+			if errors.Is(err, models.ErrInvalidTransition) {
+				logger.WithError(err).Warn("Polled job status conflicts with stored status")
+				return true
+			}
+			logger.WithError(err).Error("Failed to mark polled job failed")
+			return false
+		}
+		return true
+
+	case models.JobStatusProcessing:
+		if job.Status == models.JobStatusSubmitted {
+			if err := p.storage.UpdateJobStatus(ctx, job.JobID, models.JobStatusProcessing, ""); err != nil {
+				logger.WithError(err).Warn("Failed to mark polled job processing")
+			}
+		}
+	}
+
+	return false
+}
+
+// backoff returns the delay before the next poll: min*2^attempts capped at max, with ±20% jitter
+func (p *Poller) backoff(attempts int) time.Duration {
+	delay := p.minBackoff
+	for i := 0; i < attempts && delay < p.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.maxBackoff {
+		delay = p.maxBackoff
+	}
+
+	jitter := time.Duration((rand.Float64()*0.4 - 0.2) * float64(delay))
+	return delay + jitter
+}
@@ -0,0 +1,89 @@
+package poller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"nc-rag-worker/completion"
+	"nc-rag-worker/config"
+	"nc-rag-worker/models"
+	"nc-rag-worker/parser"
+	"nc-rag-worker/storage"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestBackoff(t *testing.T) {
+	p := &Poller{minBackoff: time.Second, maxBackoff: 30 * time.Second}
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 0, want: time.Second},
+		{attempts: 1, want: 2 * time.Second},
+		{attempts: 3, want: 8 * time.Second},
+		{attempts: 4, want: 16 * time.Second},
+		{attempts: 5, want: 30 * time.Second},
+		{attempts: 100, want: 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		low := time.Duration(float64(tt.want) * 0.8)
+		high := time.Duration(float64(tt.want) * 1.2)
+		for i := 0; i < 200; i++ {
+			if got := p.backoff(tt.attempts); got < low || got > high {
+				t.Fatalf("backoff(%d) = %s, want %s ±20%%", tt.attempts, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestPollLostJobFails(t *testing.T) {
+	ctx := context.Background()
+	parserServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer parserServer.Close()
+
+	redisServer := miniredis.RunT(t)
+	redisStorage, err := storage.NewRedisStorage("redis://"+redisServer.Addr(), config.RetentionConfig{})
+	if err != nil {
+		t.Fatalf("NewRedisStorage: %v", err)
+	}
+	defer redisStorage.Close()
+
+	jobs := storage.NewMemoryJobStore()
+	job := &models.JobState{
+		JobID:       "job-1",
+		FileID:      42,
+		Tenant:      "tenant",
+		Status:      models.JobStatusSubmitted,
+		SubmittedAt: time.Now(),
+	}
+	job.StartHistory(job.SubmittedAt)
+	if err := jobs.SaveJob(ctx, job); err != nil {
+		t.Fatalf("SaveJob: %v", err)
+	}
+
+	p := NewPoller(
+		config.PollerConfig{RPS: 100, MinBackoff: time.Second, MaxBackoff: time.Minute},
+		parser.NewClient(parserServer.URL, "", parser.ProtocolMultipart),
+		jobs,
+		completion.NewCompleter(jobs, redisStorage, nil),
+	)
+	if !p.poll(ctx, job) {
+		t.Fatal("poll of a job unknown to the parser did not finish it")
+	}
+
+	stored, err := jobs.GetJob(ctx, "job-1")
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if stored.Status != models.JobStatusFailed {
+		t.Fatalf("job status = %s, want failed", stored.Status)
+	}
+}
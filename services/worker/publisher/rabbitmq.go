@@ -0,0 +1,149 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"nc-rag-worker/broker"
+	"nc-rag-worker/models"
+	"nc-rag-worker/tracing"
+
+	"github.com/rabbitmq/amqp091-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// RabbitMQPublisher publishes pipeline messages to RabbitMQ with publisher confirms
+type RabbitMQPublisher struct {
+	amqp        *broker.Connection
+	channel     *amqp091.Channel
+	ingestQueue string
+	mu          sync.Mutex
+}
+
+// NewRabbitMQPublisher creates a new RabbitMQ publisher on the shared connection
+func NewRabbitMQPublisher(amqp *broker.Connection, ingestQueue string) (*RabbitMQPublisher, error) {
+	p := &RabbitMQPublisher{
+		amqp:        amqp,
+		ingestQueue: ingestQueue,
+	}
+
+	// Fail fast on startup; later the channel is reopened on the next publish
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.openChannel(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// openChannel returns the publish channel, opening a new one if the previous one was closed,
+// e.g. because the shared connection was lost and reestablished. Callers must hold mu.
+func (p *RabbitMQPublisher) openChannel() (*amqp091.Channel, error) {
+	if p.channel != nil && !p.channel.IsClosed() {
+		return p.channel, nil
+	}
+
+	// Create channel
+	channel, err := p.amqp.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	// Enable publisher confirms so we know the broker accepted each message
+	if err := channel.Confirm(false); err != nil {
+		channel.Close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	// Declare ingest queue (ensure it exists)
+	_, err = channel.QueueDeclare(
+		p.ingestQueue, // name
+		true,          // durable
+		false,         // delete when unused
+		false,         // exclusive
+		false,         // no-wait
+		nil,           // arguments
+	)
+	if err != nil {
+		channel.Close()
+		return nil, fmt.Errorf("failed to declare queue: %w", err)
+	}
+
+	p.channel = channel
+	return channel, nil
+}
+
+// PublishIngestReady publishes a job to the ingest.ready queue and waits for the broker confirm
+func (p *RabbitMQPublisher) PublishIngestReady(ctx context.Context, msg *models.IngestReadyMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to serialize message: %w", err)
+	}
+
+	// Propagate the trace to the ingest consumer
+	headers := amqp091.Table{}
+	tracing.InjectAMQP(ctx, headers)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	channel, err := p.openChannel()
+	if err != nil {
+		return err
+	}
+
+	confirm, err := channel.PublishWithDeferredConfirmWithContext(
+		ctx,
+		"",            // default exchange
+		p.ingestQueue, // routing key
+		false,         // mandatory
+		false,         // immediate
+		amqp091.Publishing{
+			Headers:       headers,
+			ContentType:   "application/json",
+			DeliveryMode:  amqp091.Persistent,
+			CorrelationId: msg.TraceID,
+			MessageId:     msg.JobID,
+			Timestamp:     time.Now(),
+			Body:          body,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to wait for publish confirm: %w", err)
+	}
+	if !acked {
+		return fmt.Errorf("broker rejected message for job: %s", msg.JobID)
+	}
+
+	log.WithFields(log.Fields{
+		"trace_id": msg.TraceID,
+		"job_id":   msg.JobID,
+		"queue":    p.ingestQueue,
+	}).Info("Published ingest.ready message")
+
+	return nil
+}
+
+// Close closes the publish channel
+func (p *RabbitMQPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.channel != nil {
+		p.channel.Close()
+	}
+	return nil
+}
+
+// Health checks the shared connection; a closed channel is reopened on the next publish
+func (p *RabbitMQPublisher) Health(ctx context.Context) error {
+	return p.amqp.Health(ctx)
+}
@@ -0,0 +1,281 @@
+package qdrant
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"nc-rag-worker/tracing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ChunkVector is the named vector holding paragraph embeddings
+	ChunkVector = "chunk_vec"
+	// QAVector is the named vector holding question/answer embeddings
+	QAVector = "qa_vec"
+)
+
+// Record is a point returned by scroll, without vectors
+type Record struct {
+	ID      interface{}            `json:"id"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+// ScoredPoint is a search hit
+type ScoredPoint struct {
+	ID      interface{}            `json:"id"`
+	Score   float64                `json:"score"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+// ErrNotFound is returned when the collection or point does not exist
+var ErrNotFound = errors.New("qdrant resource not found")
+
+// Point is a single Qdrant point with named vectors and payload
+type Point struct {
+	ID      string                 `json:"id"`
+	Vector  map[string][]float32   `json:"vector"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+// Client represents a Qdrant REST API client
+type Client struct {
+	baseURL    string
+	apiKey     atomic.Value
+	collection string
+	httpClient *http.Client
+}
+
+// NewClient creates a new Qdrant client bound to a collection
+func NewClient(baseURL, apiKey, collection string) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		collection: collection,
+		httpClient: &http.Client{
+			Timeout:   60 * time.Second,
+			Transport: tracing.Transport(http.DefaultTransport),
+		},
+	}
+	c.apiKey.Store(apiKey)
+	return c
+}
+
+// SetAPIKey switches to a rotated API key for all following requests
+func (c *Client) SetAPIKey(apiKey string) {
+	c.apiKey.Store(apiKey)
+}
+
+// Collection returns the collection name the client writes to
+func (c *Client) Collection() string {
+	return c.collection
+}
+
+// EnsureCollection creates the collection with chunk_vec and qa_vec named vectors if it does not exist
+func (c *Client) EnsureCollection(ctx context.Context, dimension int) error {
+	path := "/collections/" + c.collection
+
+	resp, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to check collection: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("qdrant returned error status: %d", resp.StatusCode)
+	}
+
+	log.WithFields(log.Fields{
+		"collection": c.collection,
+		"dimension":  dimension,
+	}).Info("Creating Qdrant collection")
+
+	vectorParams := map[string]interface{}{
+		"size":     dimension,
+		"distance": "Cosine",
+	}
+	body := map[string]interface{}{
+		"vectors": map[string]interface{}{
+			ChunkVector: vectorParams,
+			QAVector:    vectorParams,
+		},
+	}
+	return c.call(ctx, http.MethodPut, path, body, nil)
+}
+
+// UpsertPoints writes all points in a single batched call and waits until they are applied
+func (c *Client) UpsertPoints(ctx context.Context, points []Point) error {
+	if len(points) == 0 {
+		return nil
+	}
+
+	path := fmt.Sprintf("/collections/%s/points?wait=true", c.collection)
+	body := map[string]interface{}{
+		"points": points,
+	}
+	if err := c.call(ctx, http.MethodPut, path, body, nil); err != nil {
+		return fmt.Errorf("failed to upsert points: %w", err)
+	}
+	return nil
+}
+
+// DeletePoints deletes every point matching the filter and waits until the delete is applied
+func (c *Client) DeletePoints(ctx context.Context, filter Filter) error {
+	path := fmt.Sprintf("/collections/%s/points/delete?wait=true", c.collection)
+	body := map[string]interface{}{
+		"filter": filter,
+	}
+	if err := c.call(ctx, http.MethodPost, path, body, nil); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			// Nothing has been ingested yet
+			return nil
+		}
+		return fmt.Errorf("failed to delete points: %w", err)
+	}
+	return nil
+}
+
+// Search returns the limit points nearest to vector in the given named vector space
+func (c *Client) Search(ctx context.Context, vectorName string, vector []float32, filter Filter, limit int) ([]ScoredPoint, error) {
+	path := fmt.Sprintf("/collections/%s/points/search", c.collection)
+	body := map[string]interface{}{
+		"vector": map[string]interface{}{
+			"name":   vectorName,
+			"vector": vector,
+		},
+		"filter":       filter,
+		"limit":        limit,
+		"with_payload": true,
+	}
+
+	var result []ScoredPoint
+	if err := c.call(ctx, http.MethodPost, path, body, &result); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to search points: %w", err)
+	}
+	return result, nil
+}
+
+// Scroll returns up to limit points matching the filter with the requested payload fields
+func (c *Client) Scroll(ctx context.Context, filter Filter, limit int, fields []string) ([]Record, error) {
+	path := fmt.Sprintf("/collections/%s/points/scroll", c.collection)
+	body := map[string]interface{}{
+		"filter":       filter,
+		"limit":        limit,
+		"with_payload": fields,
+		"with_vector":  false,
+	}
+
+	var result struct {
+		Points []Record `json:"points"`
+	}
+	if err := c.call(ctx, http.MethodPost, path, body, &result); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to scroll points: %w", err)
+	}
+	return result.Points, nil
+}
+
+// SetPayload overwrites the given payload fields on every point matching the filter.
+// Vectors and other payload fields are left untouched.
+func (c *Client) SetPayload(ctx context.Context, filter Filter, payload map[string]interface{}) error {
+	path := fmt.Sprintf("/collections/%s/points/payload?wait=true", c.collection)
+	body := map[string]interface{}{
+		"payload": payload,
+		"filter":  filter,
+	}
+	if err := c.call(ctx, http.MethodPost, path, body, nil); err != nil {
+		return fmt.Errorf("failed to set payload: %w", err)
+	}
+	return nil
+}
+
+// Health checks the Qdrant API health
+func (c *Client) Health(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodGet, "/readyz", nil)
+	if err != nil {
+		return fmt.Errorf("qdrant health check failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("qdrant health check returned status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// call sends a JSON request and decodes the "result" field of the response into out
+func (c *Client) call(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to serialize request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	resp, err := c.do(ctx, method, path, reader)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("qdrant returned error status: %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	envelope := struct {
+		Result json.RawMessage `json:"result"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if err := json.Unmarshal(envelope.Result, out); err != nil {
+		return fmt.Errorf("failed to parse result: %w", err)
+	}
+	return nil
+}
+
+// do sends an HTTP request to the Qdrant API
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if apiKey := c.apiKey.Load().(string); apiKey != "" {
+		req.Header.Set("api-key", apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to qdrant: %w", err)
+	}
+	return resp, nil
+}
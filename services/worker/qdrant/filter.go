@@ -0,0 +1,49 @@
+package qdrant
+
+import "strconv"
+
+// Filter is a Qdrant payload filter
+type Filter struct {
+	Must    []Condition `json:"must,omitempty"`
+	Should  []Condition `json:"should,omitempty"`
+	MustNot []Condition `json:"must_not,omitempty"`
+}
+
+// Condition matches a payload field against a value or any of a set of values
+type Condition struct {
+	Key   string `json:"key"`
+	Match Match  `json:"match"`
+}
+
+// Match is the match clause of a condition
+type Match struct {
+	Value interface{} `json:"value,omitempty"`
+	Any   []string    `json:"any,omitempty"`
+}
+
+// MatchValue returns a condition requiring key to equal value
+func MatchValue(key string, value interface{}) Condition {
+	return Condition{Key: key, Match: Match{Value: value}}
+}
+
+// MatchAny returns a condition requiring key to contain any of values
+func MatchAny(key string, values []string) Condition {
+	return Condition{Key: key, Match: Match{Any: values}}
+}
+
+// StaleFileFilter selects the points of a file that were not written by jobID
+func StaleFileFilter(tenant string, fileID int64, jobID string) Filter {
+	filter := FileFilter(tenant, fileID)
+	filter.MustNot = []Condition{MatchValue("job_id", jobID)}
+	return filter
+}
+
+// FileFilter selects all points of a file within a tenant
+func FileFilter(tenant string, fileID int64) Filter {
+	return Filter{
+		Must: []Condition{
+			MatchValue("tenant", tenant),
+			MatchValue("file_id", strconv.FormatInt(fileID, 10)),
+		},
+	}
+}
@@ -0,0 +1,51 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+
+	"nc-rag-worker/qdrant"
+)
+
+// rrfK is the Reciprocal Rank Fusion damping constant from the original paper
+const rrfK = 60
+
+// fusedHit is a point ranked across all result lists
+type fusedHit struct {
+	point     qdrant.ScoredPoint
+	rrfScore  float64
+	bestScore float64
+}
+
+// fuseRRF merges ranked result lists with Reciprocal Rank Fusion.
+// Each list contributes 1/(k+rank) per point; the best raw similarity is kept
+// so callers can still apply an absolute relevance threshold.
+func fuseRRF(lists ...[]qdrant.ScoredPoint) []fusedHit {
+	byID := make(map[string]*fusedHit)
+	order := make([]string, 0)
+
+	for _, list := range lists {
+		for rank, point := range list {
+			id := fmt.Sprint(point.ID)
+			hit, ok := byID[id]
+			if !ok {
+				hit = &fusedHit{point: point}
+				byID[id] = hit
+				order = append(order, id)
+			}
+			hit.rrfScore += 1.0 / float64(rrfK+rank+1)
+			if point.Score > hit.bestScore {
+				hit.bestScore = point.Score
+			}
+		}
+	}
+
+	hits := make([]fusedHit, 0, len(order))
+	for _, id := range order {
+		hits = append(hits, *byID[id])
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].rrfScore > hits[j].rrfScore
+	})
+	return hits
+}
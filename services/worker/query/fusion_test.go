@@ -0,0 +1,91 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"nc-rag-worker/qdrant"
+)
+
+// points returns scored points with the given IDs and scores
+func points(idScores ...interface{}) []qdrant.ScoredPoint {
+	var out []qdrant.ScoredPoint
+	for i := 0; i < len(idScores); i += 2 {
+		out = append(out, qdrant.ScoredPoint{ID: idScores[i], Score: idScores[i+1].(float64)})
+	}
+	return out
+}
+
+func TestFuseRRF(t *testing.T) {
+	tests := []struct {
+		name      string
+		lists     [][]qdrant.ScoredPoint
+		wantOrder []string
+		wantBest  []float64
+	}{
+		{
+			name:      "single list keeps its order",
+			lists:     [][]qdrant.ScoredPoint{points("a", 0.9, "b", 0.8, "c", 0.7)},
+			wantOrder: []string{"a", "b", "c"},
+			wantBest:  []float64{0.9, 0.8, 0.7},
+		},
+		{
+			name: "a point in both lists outranks points in one",
+			lists: [][]qdrant.ScoredPoint{
+				points("a", 0.9, "b", 0.8),
+				points("c", 0.95, "b", 0.6),
+			},
+			wantOrder: []string{"b", "a", "c"},
+			wantBest:  []float64{0.8, 0.9, 0.95},
+		},
+		{
+			name: "equal fused scores keep first-seen order",
+			lists: [][]qdrant.ScoredPoint{
+				points("a", 0.5),
+				points("b", 0.9),
+			},
+			wantOrder: []string{"a", "b"},
+			wantBest:  []float64{0.5, 0.9},
+		},
+		{
+			name: "numeric and string IDs",
+			lists: [][]qdrant.ScoredPoint{
+				points(float64(1), 0.4, "x", 0.3),
+				points("x", 0.7),
+			},
+			wantOrder: []string{"x", "1"},
+			wantBest:  []float64{0.7, 0.4},
+		},
+		{
+			name:  "no hits",
+			lists: [][]qdrant.ScoredPoint{nil, nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits := fuseRRF(tt.lists...)
+			if len(hits) != len(tt.wantOrder) {
+				t.Fatalf("got %d hits, want %d", len(hits), len(tt.wantOrder))
+			}
+			for i, hit := range hits {
+				if id := fmt.Sprint(hit.point.ID); id != tt.wantOrder[i] {
+					t.Fatalf("hit %d = %s, want %s", i, id, tt.wantOrder[i])
+				}
+				if hit.bestScore != tt.wantBest[i] {
+					t.Fatalf("hit %d best score = %v, want %v", i, hit.bestScore, tt.wantBest[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFuseRRFScore(t *testing.T) {
+	hits := fuseRRF(points("a", 0.9), points("b", 0.1, "a", 0.2))
+	// Rank 1 in the first list, rank 2 in the second
+	want := 1.0/61 + 1.0/62
+	if math.Abs(hits[0].rrfScore-want) > 1e-12 {
+		t.Fatalf("rrf score = %v, want %v", hits[0].rrfScore, want)
+	}
+}
@@ -0,0 +1,79 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"nc-rag-worker/llm"
+	"nc-rag-worker/models"
+)
+
+const (
+	// charsPerToken is a rough token estimate that holds for most European languages
+	charsPerToken = 4
+
+	notFoundAnswer = "I could not find anything about this in the documents you have access to."
+
+	systemPrompt = `You answer questions using only the numbered context passages provided.
+Cite the passages you use inline with their number in square brackets, e.g. [1] or [2][3].
+If the context does not contain the answer, say so instead of guessing.
+Answer in the language of the question.`
+)
+
+// buildContext renders snippets as numbered passages, citing the index of their source,
+// and stops once the token budget is used up
+func buildContext(snippets []models.Snippet, sources []models.Source, maxTokens int) string {
+	sourceIndex := make(map[string]int, len(sources))
+	for i, source := range sources {
+		sourceIndex[source.FileID] = i + 1
+	}
+
+	budget := maxTokens * charsPerToken
+	var b strings.Builder
+	for _, snippet := range snippets {
+		passage := fmt.Sprintf("[%d] %s\n%s\n\n", sourceIndex[snippet.FileID], snippet.Path, snippet.Text)
+		if b.Len()+len(passage) > budget {
+			if b.Len() == 0 {
+				// Always include at least part of the best passage
+				b.WriteString(strings.ToValidUTF8(passage[:budget], ""))
+			}
+			break
+		}
+		b.WriteString(passage)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// generateAnswer asks the generator for an answer grounded in the retrieved snippets
+func (s *Service) generateAnswer(ctx context.Context, question string, response *models.QueryResponse) (string, error) {
+	if !response.Found {
+		return notFoundAnswer, nil
+	}
+
+	messages := []llm.Message{
+		{Role: "system", Content: systemPrompt},
+		{
+			Role:    "user",
+			Content: "Context:\n" + buildContext(response.Snippets, response.Sources, s.llmCfg.MaxContextTokens) + "\n\nQuestion: " + question,
+		},
+	}
+
+	answer, err := s.generator.Generate(ctx, messages, s.llmCfg.MaxAnswerTokens)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate answer: %w", err)
+	}
+	return answer, nil
+}
+
+// generationAllowed reports whether a tenant may use the configured generator,
+// and the reason if it may not
+func (s *Service) generationAllowed(tenant string) (bool, string) {
+	if s.generator == nil {
+		return false, "generation disabled"
+	}
+	if s.llmCfg.External && s.privateTenants[tenant] {
+		return false, "external LLM forbidden for tenant"
+	}
+	return true, ""
+}
@@ -0,0 +1,50 @@
+package query
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"nc-rag-worker/models"
+)
+
+func TestBuildContext(t *testing.T) {
+	sources := []models.Source{{FileID: "1", Path: "/a.pdf"}, {FileID: "2", Path: "/b.pdf"}}
+	snippets := []models.Snippet{
+		{FileID: "2", Path: "/b.pdf", Text: "first"},
+		{FileID: "1", Path: "/a.pdf", Text: "second"},
+	}
+
+	got := buildContext(snippets, sources, 1000)
+	want := "[2] /b.pdf\nfirst\n\n[1] /a.pdf\nsecond"
+	if got != want {
+		t.Fatalf("context = %q, want %q", got, want)
+	}
+}
+
+func TestBuildContextBudget(t *testing.T) {
+	sources := []models.Source{{FileID: "1", Path: "/a.pdf"}}
+	snippets := []models.Snippet{
+		{FileID: "1", Path: "/a.pdf", Text: strings.Repeat("x", 20)},
+		{FileID: "1", Path: "/a.pdf", Text: strings.Repeat("y", 20)},
+	}
+
+	// 10 tokens hold the first passage (33 chars) but not the second
+	got := buildContext(snippets, sources, 10)
+	if strings.Contains(got, "y") || !strings.Contains(got, strings.Repeat("x", 20)) {
+		t.Fatalf("context = %q, want only the first passage", got)
+	}
+}
+
+func TestBuildContextTruncatesFirstPassage(t *testing.T) {
+	sources := []models.Source{{FileID: "1", Path: "/a.pdf"}}
+	snippets := []models.Snippet{{FileID: "1", Path: "/a.pdf", Text: strings.Repeat("é", 50)}}
+
+	got := buildContext(snippets, sources, 5)
+	if got == "" || len(got) > 5*charsPerToken {
+		t.Fatalf("context = %q, want part of the passage within %d bytes", got, 5*charsPerToken)
+	}
+	if !utf8.ValidString(got) {
+		t.Fatalf("context %q is not valid UTF-8", got)
+	}
+}
@@ -0,0 +1,74 @@
+package query
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"nc-rag-worker/models"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const maxRequestSize = 64 << 10
+
+// Handler serves POST /query
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new query HTTP handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// ServeHTTP handles POST /query
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req models.QueryRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Query = strings.TrimSpace(req.Query)
+	if req.UserID == "" || req.Query == "" {
+		writeError(w, http.StatusBadRequest, "user_id and query are required")
+		return
+	}
+	if req.Mode != "" && req.Mode != models.QueryModeExtractive && req.Mode != models.QueryModeGenerative {
+		writeError(w, http.StatusBadRequest, "mode must be extractive or generative")
+		return
+	}
+
+	traceID := r.Header.Get("X-Trace-Id")
+	if traceID == "" {
+		traceID = models.NewTraceID()
+	}
+
+	response, err := h.service.Query(r.Context(), traceID, &req)
+	if err != nil {
+		log.WithError(err).WithField("trace_id", traceID).Error("Query failed")
+		writeError(w, http.StatusBadGateway, "query failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,196 @@
+package query
+
+import (
+	"context"
+	"fmt"
+
+	"nc-rag-worker/acl"
+	"nc-rag-worker/config"
+	"nc-rag-worker/embeddings"
+	"nc-rag-worker/llm"
+	"nc-rag-worker/models"
+	"nc-rag-worker/nextcloud"
+	"nc-rag-worker/qdrant"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Service answers RAG queries over the documents a user may access
+type Service struct {
+	ncClient       *nextcloud.Client
+	embedder       embeddings.Embedder
+	qdrant         *qdrant.Client
+	generator      llm.Generator
+	cfg            config.QueryConfig
+	llmCfg         config.LLMConfig
+	privateTenants map[string]bool
+}
+
+// NewService creates a new query service; generator may be nil to disable generative answers
+func NewService(
+	cfg config.QueryConfig,
+	llmCfg config.LLMConfig,
+	ncClient *nextcloud.Client,
+	embedder embeddings.Embedder,
+	qdrantClient *qdrant.Client,
+	generator llm.Generator,
+) *Service {
+	privateTenants := make(map[string]bool, len(llmCfg.PrivateTenants))
+	for _, tenant := range llmCfg.PrivateTenants {
+		privateTenants[tenant] = true
+	}
+
+	return &Service{
+		ncClient:       ncClient,
+		embedder:       embedder,
+		qdrant:         qdrantClient,
+		generator:      generator,
+		cfg:            cfg,
+		llmCfg:         llmCfg,
+		privateTenants: privateTenants,
+	}
+}
+
+// Query runs an ACL-filtered dual vector search and returns snippets,
+// plus a generated answer when generative mode is requested and allowed
+func (s *Service) Query(ctx context.Context, traceID string, req *models.QueryRequest) (*models.QueryResponse, error) {
+	return s.query(ctx, traceID, req, []string{req.UserID})
+}
+
+// QueryShared is Query restricted to the documents every one of readers may access,
+// for answers that all of them will see
+func (s *Service) QueryShared(ctx context.Context, traceID string, req *models.QueryRequest, readers []string) (*models.QueryResponse, error) {
+	if len(readers) == 0 {
+		return nil, fmt.Errorf("no readers for shared query")
+	}
+	return s.query(ctx, traceID, req, readers)
+}
+
+// query searches the documents readable by all of readers
+func (s *Service) query(ctx context.Context, traceID string, req *models.QueryRequest, readers []string) (*models.QueryResponse, error) {
+	tenant := req.Tenant
+	if tenant == "" {
+		tenant = s.cfg.DefaultTenant
+	}
+
+	logger := log.WithFields(log.Fields{
+		"trace_id": traceID,
+		"user_id":  req.UserID,
+		"tenant":   tenant,
+		"readers":  len(readers),
+	})
+
+	// Never search without the ACL filter: tenant AND principals ∩ user set, for every reader
+	filter := qdrant.Filter{
+		Must: []qdrant.Condition{qdrant.MatchValue("tenant", tenant)},
+	}
+	for _, reader := range readers {
+		principals, err := s.userPrincipals(ctx, reader)
+		if err != nil {
+			return nil, err
+		}
+		filter.Must = append(filter.Must, qdrant.MatchAny("principals", principals))
+	}
+
+	vectors, err := s.embedder.Embed(ctx, []string{req.Query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+
+	chunkHits, err := s.qdrant.Search(ctx, qdrant.ChunkVector, vectors[0], filter, s.cfg.ChunkLimit)
+	if err != nil {
+		return nil, err
+	}
+	qaHits, err := s.qdrant.Search(ctx, qdrant.QAVector, vectors[0], filter, s.cfg.QALimit)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.QueryResponse{
+		TraceID:  traceID,
+		Snippets: []models.Snippet{},
+		Sources:  []models.Source{},
+	}
+
+	seenSources := make(map[string]bool)
+	for _, hit := range fuseRRF(chunkHits, qaHits) {
+		if len(response.Snippets) >= s.cfg.MaxSnippets {
+			break
+		}
+		// Drop weak matches so "not found" is reported instead of noise
+		if hit.bestScore < s.cfg.ScoreThreshold {
+			continue
+		}
+
+		snippet := snippetFromPayload(hit.point.Payload, hit.bestScore)
+		response.Snippets = append(response.Snippets, snippet)
+
+		if !seenSources[snippet.FileID] {
+			seenSources[snippet.FileID] = true
+			response.Sources = append(response.Sources, models.Source{
+				FileID: snippet.FileID,
+				Path:   snippet.Path,
+			})
+		}
+	}
+	response.Found = len(response.Snippets) > 0
+
+	if req.Mode == models.QueryModeGenerative {
+		if allowed, reason := s.generationAllowed(tenant); !allowed {
+			logger.WithField("reason", reason).Info("Generative answer not available, returning extractive result")
+		} else {
+			// The snippets are still useful when the LLM is down or slow
+			answer, err := s.generateAnswer(ctx, req.Query, response)
+			if err != nil {
+				logger.WithError(err).Warn("Answer generation failed, returning extractive result")
+			}
+			response.Answer = answer
+		}
+	}
+
+	logger.WithFields(log.Fields{
+		"chunk_hits": len(chunkHits),
+		"qa_hits":    len(qaHits),
+		"snippets":   len(response.Snippets),
+		"found":      response.Found,
+		"generated":  response.Answer != "",
+	}).Info("Query completed")
+
+	return response, nil
+}
+
+// userPrincipals builds the set {"u:<uid>"} ∪ {"g:<gid>"...} for a user
+func (s *Service) userPrincipals(ctx context.Context, userID string) ([]string, error) {
+	groups, err := s.ncClient.GetUserGroups(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve user groups: %w", err)
+	}
+
+	principals := []string{acl.OwnerPrincipal(userID)}
+	for _, group := range groups {
+		principals = append(principals, "g:"+group)
+	}
+	return principals, nil
+}
+
+// snippetFromPayload turns a point payload into a snippet
+func snippetFromPayload(payload map[string]interface{}, score float64) models.Snippet {
+	snippet := models.Snippet{
+		Score:  score,
+		FileID: payloadString(payload, "file_id"),
+		Path:   payloadString(payload, "path"),
+		Type:   payloadString(payload, "type"),
+	}
+
+	if snippet.Type == "qa" {
+		snippet.Text = payloadString(payload, "q") + "\n" + payloadString(payload, "a")
+	} else {
+		snippet.Text = payloadString(payload, "text")
+	}
+	return snippet
+}
+
+func payloadString(payload map[string]interface{}, key string) string {
+	value, _ := payload[key].(string)
+	return value
+}
@@ -0,0 +1,249 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"nc-rag-worker/config"
+	"nc-rag-worker/llm"
+	"nc-rag-worker/models"
+	"nc-rag-worker/nextcloud"
+	"nc-rag-worker/qdrant"
+)
+
+// fakeEmbedder returns the same vector for every text
+type fakeEmbedder struct{}
+
+func (fakeEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i := range texts {
+		vectors[i] = []float32{1, 0}
+	}
+	return vectors, nil
+}
+
+func (fakeEmbedder) Dimension(ctx context.Context) (int, error) { return 2, nil }
+
+func (fakeEmbedder) Model() string { return "fake" }
+
+// fakeGenerator records whether it was asked for an answer
+type fakeGenerator struct {
+	calls int
+}
+
+func (g *fakeGenerator) Generate(ctx context.Context, messages []llm.Message, maxTokens int) (string, error) {
+	g.calls++
+	return "generated", nil
+}
+
+func (g *fakeGenerator) Model() string { return "fake" }
+
+// testBackends serves user groups like Nextcloud and search hits like Qdrant, recording the search filters
+type testBackends struct {
+	mu      sync.Mutex
+	filters []qdrant.Filter
+}
+
+func newTestService(t *testing.T, groups map[string][]string, hits map[string][]qdrant.ScoredPoint, queryCfg config.QueryConfig, llmCfg config.LLMConfig, generator llm.Generator) (*Service, *testBackends) {
+	t.Helper()
+	backends := &testBackends{}
+
+	nextcloudServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// /ocs/v1.php/cloud/users/<uid>/groups
+		parts := strings.Split(r.URL.Path, "/")
+		userID := parts[len(parts)-2]
+		fmt.Fprintf(w, `{"ocs":{"meta":{"statuscode":100},"data":{"groups":%s}}}`, mustJSON(t, groups[userID]))
+	}))
+	t.Cleanup(nextcloudServer.Close)
+
+	qdrantServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Vector struct {
+				Name string `json:"name"`
+			} `json:"vector"`
+			Filter qdrant.Filter `json:"filter"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode search: %v", err)
+		}
+		backends.mu.Lock()
+		backends.filters = append(backends.filters, body.Filter)
+		backends.mu.Unlock()
+		fmt.Fprintf(w, `{"result":%s}`, mustJSON(t, hits[body.Vector.Name]))
+	}))
+	t.Cleanup(qdrantServer.Close)
+
+	service := NewService(
+		queryCfg,
+		llmCfg,
+		nextcloud.NewClient(nextcloudServer.URL, "rag", "secret"),
+		fakeEmbedder{},
+		qdrant.NewClient(qdrantServer.URL, "", "documents"),
+		generator,
+	)
+	return service, backends
+}
+
+func mustJSON(t *testing.T, value interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return string(data)
+}
+
+func hit(id string, score float64, fileID string) qdrant.ScoredPoint {
+	return qdrant.ScoredPoint{
+		ID:    id,
+		Score: score,
+		Payload: map[string]interface{}{
+			"file_id": fileID,
+			"path":    "/" + fileID + ".pdf",
+			"type":    "chunk",
+			"text":    "text " + id,
+		},
+	}
+}
+
+var testQueryConfig = config.QueryConfig{
+	DefaultTenant:  "default",
+	ChunkLimit:     10,
+	QALimit:        10,
+	MaxSnippets:    5,
+	ScoreThreshold: 0.5,
+}
+
+func TestQueryACLFilter(t *testing.T) {
+	groups := map[string][]string{
+		"alice": {"staff", "admins"},
+		"bob":   nil,
+	}
+	service, backends := newTestService(t, groups, nil, testQueryConfig, config.LLMConfig{}, nil)
+
+	_, err := service.QueryShared(context.Background(), "trace", &models.QueryRequest{UserID: "alice", Query: "q", Tenant: "acme"}, []string{"alice", "bob"})
+	if err != nil {
+		t.Fatalf("QueryShared: %v", err)
+	}
+
+	want := qdrant.Filter{
+		Must: []qdrant.Condition{
+			qdrant.MatchValue("tenant", "acme"),
+			qdrant.MatchAny("principals", []string{"u:alice", "g:staff", "g:admins"}),
+			qdrant.MatchAny("principals", []string{"u:bob"}),
+		},
+	}
+	if len(backends.filters) != 2 {
+		t.Fatalf("got %d searches, want 2", len(backends.filters))
+	}
+	for _, filter := range backends.filters {
+		if !reflect.DeepEqual(filter, want) {
+			t.Fatalf("filter = %+v, want %+v", filter, want)
+		}
+	}
+}
+
+func TestQueryDefaultTenant(t *testing.T) {
+	service, backends := newTestService(t, nil, nil, testQueryConfig, config.LLMConfig{}, nil)
+
+	if _, err := service.Query(context.Background(), "trace", &models.QueryRequest{UserID: "alice", Query: "q"}); err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if got := backends.filters[0].Must[0]; !reflect.DeepEqual(got, qdrant.MatchValue("tenant", "default")) {
+		t.Fatalf("tenant condition = %+v, want the default tenant", got)
+	}
+}
+
+func TestQueryFusionAndThreshold(t *testing.T) {
+	hits := map[string][]qdrant.ScoredPoint{
+		qdrant.ChunkVector: {hit("a", 0.9, "1"), hit("b", 0.6, "2"), hit("weak", 0.4, "3")},
+		qdrant.QAVector:    {hit("b", 0.7, "2")},
+	}
+
+	tests := []struct {
+		name        string
+		threshold   float64
+		maxSnippets int
+		wantTexts   []string
+		wantSources []string
+	}{
+		{name: "fused order", threshold: 0.5, maxSnippets: 5, wantTexts: []string{"text b", "text a"}, wantSources: []string{"2", "1"}},
+		{name: "max snippets", threshold: 0.5, maxSnippets: 1, wantTexts: []string{"text b"}, wantSources: []string{"2"}},
+		{name: "threshold on best score", threshold: 0.8, maxSnippets: 5, wantTexts: []string{"text a"}, wantSources: []string{"1"}},
+		{name: "nothing above threshold", threshold: 0.95, maxSnippets: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testQueryConfig
+			cfg.ScoreThreshold = tt.threshold
+			cfg.MaxSnippets = tt.maxSnippets
+			service, _ := newTestService(t, nil, hits, cfg, config.LLMConfig{}, nil)
+
+			response, err := service.Query(context.Background(), "trace", &models.QueryRequest{UserID: "alice", Query: "q"})
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+
+			var texts, sources []string
+			for _, snippet := range response.Snippets {
+				texts = append(texts, snippet.Text)
+			}
+			for _, source := range response.Sources {
+				sources = append(sources, source.FileID)
+			}
+			if !reflect.DeepEqual(texts, tt.wantTexts) || !reflect.DeepEqual(sources, tt.wantSources) {
+				t.Fatalf("snippets = %v, sources = %v; want %v, %v", texts, sources, tt.wantTexts, tt.wantSources)
+			}
+			if response.Found != (len(tt.wantTexts) > 0) {
+				t.Fatalf("found = %v", response.Found)
+			}
+		})
+	}
+}
+
+func TestQueryPrivateTenantNeverReachesExternalGenerator(t *testing.T) {
+	hits := map[string][]qdrant.ScoredPoint{qdrant.ChunkVector: {hit("a", 0.9, "1")}}
+
+	tests := []struct {
+		name      string
+		external  bool
+		tenant    string
+		wantCalls int
+	}{
+		{name: "external LLM, private tenant", external: true, tenant: "private", wantCalls: 0},
+		{name: "external LLM, other tenant", external: true, tenant: "acme", wantCalls: 1},
+		{name: "internal LLM, private tenant", external: false, tenant: "private", wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator := &fakeGenerator{}
+			llmCfg := config.LLMConfig{External: tt.external, PrivateTenants: []string{"private"}, MaxContextTokens: 1000}
+			service, _ := newTestService(t, nil, hits, testQueryConfig, llmCfg, generator)
+
+			response, err := service.Query(context.Background(), "trace", &models.QueryRequest{
+				UserID: "alice",
+				Query:  "q",
+				Tenant: tt.tenant,
+				Mode:   models.QueryModeGenerative,
+			})
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			if generator.calls != tt.wantCalls {
+				t.Fatalf("generator calls = %d, want %d", generator.calls, tt.wantCalls)
+			}
+			if tt.wantCalls == 0 && (response.Answer != "" || len(response.Snippets) != 1) {
+				t.Fatalf("response = %+v, want the extractive result only", response)
+			}
+		})
+	}
+}
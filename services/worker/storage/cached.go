@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"nc-rag-worker/models"
+
+	"github.com/go-redis/redis/v8"
+	log "github.com/sirupsen/logrus"
+)
+
+// jobCacheTTL bounds how long a cached job can outlive a missed invalidation
+const jobCacheTTL = time.Hour
+
+// CachedJobStore reads jobs through a Redis cache in front of a durable store.
+// Writes go to the store first and then invalidate the cached job. Each invalidation bumps
+// the job's cache generation, and a read only fills the cache if the generation it saw
+// before loading is unchanged, so a read racing a write cannot cache the old row.
+type CachedJobStore struct {
+	store JobStore
+	cache *RedisStorage
+}
+
+// NewCachedJobStore caches jobs of store in Redis
+func NewCachedJobStore(store JobStore, cache *RedisStorage) *CachedJobStore {
+	return &CachedJobStore{store: store, cache: cache}
+}
+
+// SaveJob saves the job to the store and drops the cached copy
+func (c *CachedJobStore) SaveJob(ctx context.Context, job *models.JobState) error {
+	defer c.invalidate(ctx, job.JobID)
+	return c.store.SaveJob(ctx, job)
+}
+
+// GetJob returns the cached job or loads it from the store
+func (c *CachedJobStore) GetJob(ctx context.Context, jobID string) (*models.JobState, error) {
+	if job, err := c.cache.GetJob(ctx, jobID); err == nil {
+		return job, nil
+	}
+	// Read the generation before loading, so a write committed meanwhile prevents the fill
+	generation, err := c.cache.jobCacheGeneration(ctx, jobID)
+	if err != nil {
+		log.WithError(err).WithField("job_id", jobID).Warn("Failed to read job cache generation")
+		return c.store.GetJob(ctx, jobID)
+	}
+	job, err := c.store.GetJob(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	c.fill(ctx, job, generation)
+	return job, nil
+}
+
+// GetJobByFileID loads the latest job of a file from the store
+func (c *CachedJobStore) GetJobByFileID(ctx context.Context, fileID int64) (*models.JobState, error) {
+	return c.store.GetJobByFileID(ctx, fileID)
+}
+
+// UpdateJobStatus transitions the job in the store
+func (c *CachedJobStore) UpdateJobStatus(ctx context.Context, jobID string, status models.JobStatus, errorMessage string) error {
+	defer c.invalidate(ctx, jobID)
+	return c.store.UpdateJobStatus(ctx, jobID, status, errorMessage)
+}
+
+// SupersedeJob supersedes the job in the store
+func (c *CachedJobStore) SupersedeJob(ctx context.Context, jobID, supersededBy string) error {
+	defer c.invalidate(ctx, jobID)
+	return c.store.SupersedeJob(ctx, jobID, supersededBy)
+}
+
+// DeleteJob deletes the job from the store
+func (c *CachedJobStore) DeleteJob(ctx context.Context, jobID string) error {
+	defer c.invalidate(ctx, jobID)
+	return c.store.DeleteJob(ctx, jobID)
+}
+
+// ListJobsByStatus lists jobs from the store
+func (c *CachedJobStore) ListJobsByStatus(ctx context.Context, status models.JobStatus, cursor string, limit int) (*JobPage, error) {
+	return c.store.ListJobsByStatus(ctx, status, cursor, limit)
+}
+
+// ListJobsByTenant lists jobs from the store
+func (c *CachedJobStore) ListJobsByTenant(ctx context.Context, tenant, cursor string, limit int) (*JobPage, error) {
+	return c.store.ListJobsByTenant(ctx, tenant, cursor, limit)
+}
+
+// GetFileRecord reads the file record from the store
+func (c *CachedJobStore) GetFileRecord(ctx context.Context, fileID int64) (*models.FileRecord, error) {
+	return c.store.GetFileRecord(ctx, fileID)
+}
+
+// UpdateFileRecord updates the file record in the store
+func (c *CachedJobStore) UpdateFileRecord(ctx context.Context, fileID int64, update func(*models.FileRecord) bool) error {
+	return c.store.UpdateFileRecord(ctx, fileID, update)
+}
+
+// DeleteFileRecord deletes the file record from the store
+func (c *CachedJobStore) DeleteFileRecord(ctx context.Context, fileID int64) error {
+	return c.store.DeleteFileRecord(ctx, fileID)
+}
+
+// Health checks the store; the cache is checked as Redis
+func (c *CachedJobStore) Health(ctx context.Context) error {
+	return c.store.Health(ctx)
+}
+
+// Close closes the underlying store, if it can be closed
+func (c *CachedJobStore) Close() error {
+	if closer, ok := c.store.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// SetURL passes rotated credentials to the underlying store, if it supports them
+func (c *CachedJobStore) SetURL(url string) error {
+	if setter, ok := c.store.(interface{ SetURL(string) error }); ok {
+		return setter.SetURL(url)
+	}
+	return nil
+}
+
+func (c *CachedJobStore) fill(ctx context.Context, job *models.JobState, generation string) {
+	if err := c.cache.CacheJob(ctx, job, generation, jobCacheTTL); err != nil {
+		log.WithError(err).WithField("job_id", job.JobID).Warn("Failed to cache job")
+	}
+}
+
+func (c *CachedJobStore) invalidate(ctx context.Context, jobID string) {
+	if err := c.cache.InvalidateJob(ctx, jobID); err != nil {
+		log.WithError(err).WithField("job_id", jobID).Warn("Failed to invalidate cached job")
+	}
+}
+
+// cacheJobScript sets the cached job KEYS[1] only while its generation KEYS[2] is still ARGV[1]
+var cacheJobScript = redis.NewScript(`
+if (redis.call('GET', KEYS[2]) or '') ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// invalidateJobScript drops the cached job KEYS[1] and bumps its generation KEYS[2].
+// The generation outlives any cached copy, so it cannot reset while a fill is pending.
+var invalidateJobScript = redis.NewScript(`
+redis.call('DEL', KEYS[1])
+redis.call('INCR', KEYS[2])
+redis.call('PEXPIRE', KEYS[2], ARGV[1])
+return 1
+`)
+
+func jobCacheKeys(jobID string) []string {
+	return []string{fmt.Sprintf("job:%s", jobID), fmt.Sprintf("job_generation:%s", jobID)}
+}
+
+// jobCacheGeneration returns the cache generation of a job, empty if it was never invalidated
+func (r *RedisStorage) jobCacheGeneration(ctx context.Context, jobID string) (string, error) {
+	generation, err := r.client.Get(ctx, jobCacheKeys(jobID)[1]).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get job cache generation: %w", err)
+	}
+	return generation, nil
+}
+
+// CacheJob stores a job copy under its job key only, without file mapping or indexes.
+// The copy is skipped if the job was invalidated since generation was read.
+func (r *RedisStorage) CacheJob(ctx context.Context, job *models.JobState, generation string, ttl time.Duration) error {
+	jobJSON, err := job.ToJSON()
+	if err != nil {
+		return fmt.Errorf("failed to serialize job: %w", err)
+	}
+	if err := cacheJobScript.Run(ctx, r.client, jobCacheKeys(job.JobID), generation, jobJSON, ttl.Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("failed to cache job: %w", err)
+	}
+	return nil
+}
+
+// InvalidateJob drops a cached job copy and prevents fills from reads that started before
+func (r *RedisStorage) InvalidateJob(ctx context.Context, jobID string) error {
+	if err := invalidateJobScript.Run(ctx, r.client, jobCacheKeys(jobID), (2 * jobCacheTTL).Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("failed to invalidate job: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"nc-rag-worker/models"
+)
+
+func newTestCachedJobStore(t *testing.T) (*CachedJobStore, *MemoryJobStore, *jobFixture) {
+	t.Helper()
+	cache, _ := newTestRedisStorage(t)
+	store := NewMemoryJobStore()
+	cached := NewCachedJobStore(store, cache)
+	return cached, store, newJobFixture(t, cached)
+}
+
+func TestCachedJobStoreReadsThrough(t *testing.T) {
+	ctx := context.Background()
+	cached, store, f := newTestCachedJobStore(t)
+	job := f.save("a", 1, 0)
+
+	getJob(t, cached, job.JobID)
+	// A cached job is served even if the store changes behind the cache's back
+	if err := store.UpdateJobStatus(ctx, job.JobID, models.JobStatusProcessing, ""); err != nil {
+		t.Fatalf("UpdateJobStatus: %v", err)
+	}
+	if got := getJob(t, cached, job.JobID); got.Status != models.JobStatusSubmitted {
+		t.Fatalf("GetJob = %s, want the cached submitted job", got.Status)
+	}
+
+	// Writes through the cached store invalidate
+	if err := cached.UpdateJobStatus(ctx, job.JobID, models.JobStatusCompleted, ""); err != nil {
+		t.Fatalf("UpdateJobStatus: %v", err)
+	}
+	if got := getJob(t, cached, job.JobID); got.Status != models.JobStatusCompleted {
+		t.Fatalf("GetJob after update = %s, want completed", got.Status)
+	}
+}
+
+func TestCachedJobStoreStaleFill(t *testing.T) {
+	ctx := context.Background()
+	cached, store, f := newTestCachedJobStore(t)
+	job := f.save("a", 1, 0)
+
+	// A read misses the cache and loads the job ...
+	generation, err := cached.cache.jobCacheGeneration(ctx, job.JobID)
+	if err != nil {
+		t.Fatalf("jobCacheGeneration: %v", err)
+	}
+	stale, err := store.GetJob(ctx, job.JobID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+
+	// ... a write commits and invalidates before the read fills the cache
+	if err := cached.UpdateJobStatus(ctx, job.JobID, models.JobStatusProcessing, ""); err != nil {
+		t.Fatalf("UpdateJobStatus: %v", err)
+	}
+	cached.fill(ctx, stale, generation)
+
+	if got := getJob(t, cached, job.JobID); got.Status != models.JobStatusProcessing {
+		t.Fatalf("GetJob = %s, want processing; the stale read was cached", got.Status)
+	}
+}
+
+func TestCachedJobStoreSaveInvalidates(t *testing.T) {
+	ctx := context.Background()
+	cached, _, f := newTestCachedJobStore(t)
+	job := f.save("a", 1, 0)
+	getJob(t, cached, job.JobID)
+
+	job.FilePath = "/files/renamed.pdf"
+	job.SubmittedAt = job.SubmittedAt.Add(time.Second)
+	if err := cached.SaveJob(ctx, job); err != nil {
+		t.Fatalf("SaveJob: %v", err)
+	}
+	if got := getJob(t, cached, job.JobID); got.FilePath != job.FilePath {
+		t.Fatalf("GetJob after save = %s, want %s", got.FilePath, job.FilePath)
+	}
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"nc-rag-worker/config"
+	"nc-rag-worker/models"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrFileRecordNotFound is returned when a file has no index record
+var ErrFileRecordNotFound = errors.New("file record not found")
+
+// sweepGrace keeps Redis jobs past their retention so the sweeper compacts them before they expire
+const sweepGrace = 24 * time.Hour
+
+// retentionFor returns how long jobs in status are kept; 0 keeps them forever
+func retentionFor(cfg config.RetentionConfig, status models.JobStatus) time.Duration {
+	switch status {
+	case models.JobStatusCompleted:
+		return cfg.Completed
+	case models.JobStatusFailed:
+		return cfg.Failed
+	case models.JobStatusSuperseded:
+		return cfg.Superseded
+	default:
+		return cfg.Active
+	}
+}
+
+func fileRecordKey(fileID int64) string {
+	return fmt.Sprintf("file_index:%d", fileID)
+}
+
+// GetFileRecord retrieves the index record of a file
+func (r *RedisStorage) GetFileRecord(ctx context.Context, fileID int64) (*models.FileRecord, error) {
+	data, err := r.client.Get(ctx, fileRecordKey(fileID)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, fmt.Errorf("%w: %d", ErrFileRecordNotFound, fileID)
+		}
+		return nil, fmt.Errorf("failed to get file record: %w", err)
+	}
+	record, err := models.FileRecordFromJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize file record: %w", err)
+	}
+	return record, nil
+}
+
+// UpdateFileRecord atomically applies update to the file's record, starting from an empty
+// record if there is none. The record is saved without expiry if update returns true.
+func (r *RedisStorage) UpdateFileRecord(ctx context.Context, fileID int64, update func(*models.FileRecord) bool) error {
+	key := fileRecordKey(fileID)
+
+	txf := func(tx *redis.Tx) error {
+		record := &models.FileRecord{FileID: fileID}
+		data, err := tx.Get(ctx, key).Result()
+		switch {
+		case err == nil:
+			if record, err = models.FileRecordFromJSON(data); err != nil {
+				return fmt.Errorf("failed to deserialize file record: %w", err)
+			}
+		case err != redis.Nil:
+			return fmt.Errorf("failed to get file record: %w", err)
+		}
+
+		if !update(record) {
+			return nil
+		}
+		updated, err := record.ToJSON()
+		if err != nil {
+			return fmt.Errorf("failed to serialize file record: %w", err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, updated, 0)
+			return nil
+		})
+		return err
+	}
+
+	for attempt := 0; attempt < maxTransitionAttempts; attempt++ {
+		err := r.client.Watch(ctx, txf, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to update file record %d: too many concurrent updates", fileID)
+}
+
+// DeleteFileRecord removes the index record of a deleted file
+func (r *RedisStorage) DeleteFileRecord(ctx context.Context, fileID int64) error {
+	if err := r.client.Del(ctx, fileRecordKey(fileID)).Err(); err != nil {
+		return fmt.Errorf("failed to delete file record: %w", err)
+	}
+	return nil
+}
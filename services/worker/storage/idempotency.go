@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ClaimResult is the outcome of an idempotency claim
+type ClaimResult int
+
+const (
+	// ClaimAcquired means the caller owns the work and must complete or release the claim
+	ClaimAcquired ClaimResult = iota
+	// ClaimDuplicate means the work was already done and must be skipped
+	ClaimDuplicate
+	// ClaimBusy means another worker holds the claim; the caller should retry later
+	ClaimBusy
+)
+
+const (
+	// claimLease bounds how long a crashed worker can block an event or file
+	claimLease = 10 * time.Minute
+	// processedEventTTL is how long processed event IDs are remembered
+	processedEventTTL = 7 * 24 * time.Hour
+	// fileVersionTTL is how long the last processed version of a file is remembered
+	fileVersionTTL = 30 * 24 * time.Hour
+
+	eventDone = "done"
+)
+
+// claimEventScript claims an event ID unless it is processed (KEYS[1] = "done") or claimed by someone else
+var claimEventScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 0
+end
+if redis.call('GET', KEYS[1]) == 'done' then
+	return 1
+end
+return 2
+`)
+
+// claimFileScript locks a file for processing unless its stored version (KEYS[1]) equals ARGV[1]
+var claimFileScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return 1
+end
+if redis.call('SET', KEYS[2], ARGV[2], 'NX', 'PX', ARGV[3]) then
+	return 0
+end
+return 2
+`)
+
+// completeIfOwnerScript sets KEYS[1] to ARGV[2] with TTL ARGV[3] and deletes KEYS[2] if KEYS[2] holds token ARGV[1]
+var completeIfOwnerScript = redis.NewScript(`
+if redis.call('GET', KEYS[2]) ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+if KEYS[1] ~= KEYS[2] then
+	redis.call('DEL', KEYS[2])
+end
+return 1
+`)
+
+// releaseIfOwnerScript deletes KEYS[1] if it holds token ARGV[1]
+var releaseIfOwnerScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+func eventKey(eventID string) string {
+	return fmt.Sprintf("event:%s", eventID)
+}
+
+func fileVersionKey(tenant string, fileID int64) string {
+	return fmt.Sprintf("file_version:%s:%d", tenant, fileID)
+}
+
+func fileLockKey(tenant string, fileID int64) string {
+	return fmt.Sprintf("file_lock:%s:%d", tenant, fileID)
+}
+
+// ClaimEvent atomically claims an event ID for processing with the given token
+func (r *RedisStorage) ClaimEvent(ctx context.Context, eventID, token string) (ClaimResult, error) {
+	res, err := claimEventScript.Run(ctx, r.client, []string{eventKey(eventID)}, token, claimLease.Milliseconds()).Int()
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim event: %w", err)
+	}
+	return ClaimResult(res), nil
+}
+
+// CompleteEvent records a claimed event as processed
+func (r *RedisStorage) CompleteEvent(ctx context.Context, eventID, token string) error {
+	key := eventKey(eventID)
+	if err := completeIfOwnerScript.Run(ctx, r.client, []string{key, key}, token, eventDone, processedEventTTL.Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("failed to complete event: %w", err)
+	}
+	return nil
+}
+
+// ReleaseEvent drops a claim so a redelivery of the event can process it
+func (r *RedisStorage) ReleaseEvent(ctx context.Context, eventID, token string) error {
+	if err := releaseIfOwnerScript.Run(ctx, r.client, []string{eventKey(eventID)}, token).Err(); err != nil {
+		return fmt.Errorf("failed to release event: %w", err)
+	}
+	return nil
+}
+
+// ClaimFileVersion locks a file for processing unless version was already processed.
+// ClaimDuplicate means the content is unchanged since the last processed version.
+func (r *RedisStorage) ClaimFileVersion(ctx context.Context, tenant string, fileID int64, version, token string) (ClaimResult, error) {
+	keys := []string{fileVersionKey(tenant, fileID), fileLockKey(tenant, fileID)}
+	res, err := claimFileScript.Run(ctx, r.client, keys, version, token, claimLease.Milliseconds()).Int()
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim file version: %w", err)
+	}
+	return ClaimResult(res), nil
+}
+
+// CommitFileVersion records version as processed and unlocks the file
+func (r *RedisStorage) CommitFileVersion(ctx context.Context, tenant string, fileID int64, version, token string) error {
+	keys := []string{fileVersionKey(tenant, fileID), fileLockKey(tenant, fileID)}
+	if err := completeIfOwnerScript.Run(ctx, r.client, keys, token, version, fileVersionTTL.Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("failed to commit file version: %w", err)
+	}
+	return nil
+}
+
+// ReleaseFileVersion unlocks a file without recording a version
+func (r *RedisStorage) ReleaseFileVersion(ctx context.Context, tenant string, fileID int64, token string) error {
+	if err := releaseIfOwnerScript.Run(ctx, r.client, []string{fileLockKey(tenant, fileID)}, token).Err(); err != nil {
+		return fmt.Errorf("failed to release file lock: %w", err)
+	}
+	return nil
+}
+
+// ForgetFileVersion forgets version as processed unless a newer version was committed meanwhile,
+// so the next event for the file submits it again, e.g. after its parser job failed
+func (r *RedisStorage) ForgetFileVersion(ctx context.Context, tenant string, fileID int64, version string) error {
+	if err := releaseIfOwnerScript.Run(ctx, r.client, []string{fileVersionKey(tenant, fileID)}, version).Err(); err != nil {
+		return fmt.Errorf("failed to forget file version: %w", err)
+	}
+	return nil
+}
+
+// ClearFileVersion forgets the processed version of a deleted file, so a restored file is processed again
+func (r *RedisStorage) ClearFileVersion(ctx context.Context, tenant string, fileID int64) error {
+	if err := r.client.Del(ctx, fileVersionKey(tenant, fileID)).Err(); err != nil {
+		return fmt.Errorf("failed to clear file version: %w", err)
+	}
+	return nil
+}
+
+func debounceKey(tenant string, fileID int64) string {
+	return fmt.Sprintf("debounce:%s:%d", tenant, fileID)
+}
+
+// RegisterFileEvent records a new update of a file and returns its sequence number.
+// Only the event holding the latest sequence is processed after the quiet window.
+func (r *RedisStorage) RegisterFileEvent(ctx context.Context, tenant string, fileID int64) (int64, error) {
+	key := debounceKey(tenant, fileID)
+	var incr *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, 24*time.Hour)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to register file event: %w", err)
+	}
+	return incr.Val(), nil
+}
+
+// LatestFileEventSeq returns the sequence number of the latest registered update of a file, or 0
+func (r *RedisStorage) LatestFileEventSeq(ctx context.Context, tenant string, fileID int64) (int64, error) {
+	seq, err := r.client.Get(ctx, debounceKey(tenant, fileID)).Int64()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get latest file event: %w", err)
+	}
+	return seq, nil
+}
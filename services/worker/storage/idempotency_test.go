@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"nc-rag-worker/config"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestRedisStorage returns a RedisStorage backed by an in-process miniredis
+func newTestRedisStorage(t *testing.T) (*RedisStorage, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	r, err := NewRedisStorage("redis://"+server.Addr(), config.RetentionConfig{})
+	if err != nil {
+		t.Fatalf("NewRedisStorage: %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r, server
+}
+
+func claimFile(t *testing.T, r *RedisStorage, version, token string) ClaimResult {
+	t.Helper()
+	res, err := r.ClaimFileVersion(context.Background(), "tenant", 42, version, token)
+	if err != nil {
+		t.Fatalf("ClaimFileVersion(%s): %v", version, err)
+	}
+	return res
+}
+
+func TestClaimFileVersion(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestRedisStorage(t)
+
+	if res := claimFile(t, r, "v1", "a"); res != ClaimAcquired {
+		t.Fatalf("first claim = %d, want ClaimAcquired", res)
+	}
+	if res := claimFile(t, r, "v1", "b"); res != ClaimBusy {
+		t.Fatalf("claim while locked = %d, want ClaimBusy", res)
+	}
+
+	// Only the owner can commit
+	if err := r.CommitFileVersion(ctx, "tenant", 42, "v1", "b"); err != nil {
+		t.Fatalf("CommitFileVersion: %v", err)
+	}
+	if res := claimFile(t, r, "v1", "b"); res != ClaimBusy {
+		t.Fatalf("claim after foreign commit = %d, want ClaimBusy", res)
+	}
+
+	if err := r.CommitFileVersion(ctx, "tenant", 42, "v1", "a"); err != nil {
+		t.Fatalf("CommitFileVersion: %v", err)
+	}
+	if res := claimFile(t, r, "v1", "b"); res != ClaimDuplicate {
+		t.Fatalf("claim of committed version = %d, want ClaimDuplicate", res)
+	}
+	if res := claimFile(t, r, "v2", "b"); res != ClaimAcquired {
+		t.Fatalf("claim of new version = %d, want ClaimAcquired", res)
+	}
+
+	// Releasing unlocks the file without recording v2
+	if err := r.ReleaseFileVersion(ctx, "tenant", 42, "b"); err != nil {
+		t.Fatalf("ReleaseFileVersion: %v", err)
+	}
+	if res := claimFile(t, r, "v1", "c"); res != ClaimDuplicate {
+		t.Fatalf("claim of v1 after release = %d, want ClaimDuplicate", res)
+	}
+}
+
+func TestForgetFileVersion(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestRedisStorage(t)
+
+	claimFile(t, r, "v1", "a")
+	if err := r.CommitFileVersion(ctx, "tenant", 42, "v1", "a"); err != nil {
+		t.Fatalf("CommitFileVersion: %v", err)
+	}
+
+	// A failed older job must not forget a newer committed version
+	if err := r.ForgetFileVersion(ctx, "tenant", 42, "v0"); err != nil {
+		t.Fatalf("ForgetFileVersion: %v", err)
+	}
+	if res := claimFile(t, r, "v1", "b"); res != ClaimDuplicate {
+		t.Fatalf("claim after forgetting another version = %d, want ClaimDuplicate", res)
+	}
+
+	if err := r.ForgetFileVersion(ctx, "tenant", 42, "v1"); err != nil {
+		t.Fatalf("ForgetFileVersion: %v", err)
+	}
+	if res := claimFile(t, r, "v1", "b"); res != ClaimAcquired {
+		t.Fatalf("claim after forgetting the version = %d, want ClaimAcquired", res)
+	}
+}
+
+func TestClaimEvent(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestRedisStorage(t)
+
+	claim := func(token string) ClaimResult {
+		t.Helper()
+		res, err := r.ClaimEvent(ctx, "event-1", token)
+		if err != nil {
+			t.Fatalf("ClaimEvent: %v", err)
+		}
+		return res
+	}
+
+	if res := claim("a"); res != ClaimAcquired {
+		t.Fatalf("first claim = %d, want ClaimAcquired", res)
+	}
+	if res := claim("b"); res != ClaimBusy {
+		t.Fatalf("claim while held = %d, want ClaimBusy", res)
+	}
+	if err := r.ReleaseEvent(ctx, "event-1", "a"); err != nil {
+		t.Fatalf("ReleaseEvent: %v", err)
+	}
+	if res := claim("b"); res != ClaimAcquired {
+		t.Fatalf("claim after release = %d, want ClaimAcquired", res)
+	}
+	if err := r.CompleteEvent(ctx, "event-1", "b"); err != nil {
+		t.Fatalf("CompleteEvent: %v", err)
+	}
+	if res := claim("c"); res != ClaimDuplicate {
+		t.Fatalf("claim of processed event = %d, want ClaimDuplicate", res)
+	}
+}
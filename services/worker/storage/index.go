@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"nc-rag-worker/models"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DefaultPageSize is used when a list call passes a non-positive limit
+const DefaultPageSize = 100
+
+// indexedStatuses are the statuses with a job index; a job is in exactly one of them
+var indexedStatuses = []models.JobStatus{
+	models.JobStatusSubmitted,
+	models.JobStatusProcessing,
+	models.JobStatusCompleted,
+	models.JobStatusFailed,
+	models.JobStatusSuperseded,
+}
+
+// JobPage is one page of an indexed job query, ordered by submission time (oldest first)
+type JobPage struct {
+	Jobs []*models.JobState
+	// NextCursor continues the query; it is empty on the last page
+	NextCursor string
+}
+
+func statusIndexKey(status models.JobStatus) string {
+	return fmt.Sprintf("jobs:status:%s", status)
+}
+
+func tenantIndexKey(tenant string) string {
+	return fmt.Sprintf("jobs:tenant:%s", tenant)
+}
+
+// indexScore orders jobs by submission time in milliseconds
+func indexScore(job *models.JobState) float64 {
+	return float64(job.SubmittedAt.UnixMilli())
+}
+
+// indexJob moves a job into the index of its current status and adds it to its tenant's index
+func indexJob(ctx context.Context, pipe redis.Pipeliner, job *models.JobState) {
+	member := &redis.Z{Score: indexScore(job), Member: job.JobID}
+	for _, status := range indexedStatuses {
+		if status != job.Status {
+			pipe.ZRem(ctx, statusIndexKey(status), job.JobID)
+		}
+	}
+	pipe.ZAdd(ctx, statusIndexKey(job.Status), member)
+	pipe.ZAdd(ctx, tenantIndexKey(job.Tenant), member)
+}
+
+// unindexJob removes a job from all indexes
+func unindexJob(ctx context.Context, pipe redis.Pipeliner, job *models.JobState) {
+	for _, status := range indexedStatuses {
+		pipe.ZRem(ctx, statusIndexKey(status), job.JobID)
+	}
+	pipe.ZRem(ctx, tenantIndexKey(job.Tenant), job.JobID)
+}
+
+// ListJobsByStatus returns a page of jobs currently in status.
+// Pass an empty cursor for the first page and JobPage.NextCursor for the following ones.
+func (r *RedisStorage) ListJobsByStatus(ctx context.Context, status models.JobStatus, cursor string, limit int) (*JobPage, error) {
+	return r.listIndexedJobs(ctx, statusIndexKey(status), cursor, limit)
+}
+
+// ListJobsByTenant returns a page of jobs of a tenant.
+// Pass an empty cursor for the first page and JobPage.NextCursor for the following ones.
+func (r *RedisStorage) ListJobsByTenant(ctx context.Context, tenant, cursor string, limit int) (*JobPage, error) {
+	return r.listIndexedJobs(ctx, tenantIndexKey(tenant), cursor, limit)
+}
+
+// listIndexedJobs pages through an index after the cursor position.
+// Index entries of expired jobs are skipped and removed.
+func (r *RedisStorage) listIndexedJobs(ctx context.Context, indexKey, cursor string, limit int) (*JobPage, error) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	after, err := parseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	min := "-inf"
+	if after != nil {
+		min = strconv.FormatInt(after.score, 10)
+	}
+
+	page := &JobPage{}
+	var stale []interface{}
+	// Remove stale entries only after paging, so offsets stay valid
+	defer func() {
+		if len(stale) > 0 {
+			r.client.ZRem(ctx, indexKey, stale...)
+		}
+	}()
+
+	batch := int64(limit + 1)
+	for offset := int64(0); ; offset += batch {
+		entries, err := r.client.ZRangeByScoreWithScores(ctx, indexKey, &redis.ZRangeBy{
+			Min:    min,
+			Max:    "+inf",
+			Offset: offset,
+			Count:  batch,
+		}).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read job index: %w", err)
+		}
+
+		jobs, missing, err := r.loadIndexedJobs(ctx, entries, after)
+		if err != nil {
+			return nil, err
+		}
+		stale = append(stale, missing...)
+
+		for _, job := range jobs {
+			if len(page.Jobs) == limit {
+				page.NextCursor = formatCursor(page.Jobs[limit-1])
+				return page, nil
+			}
+			page.Jobs = append(page.Jobs, job)
+		}
+
+		if int64(len(entries)) < batch {
+			return page, nil
+		}
+	}
+}
+
+// loadIndexedJobs fetches the jobs of index entries positioned after the cursor.
+// It also returns the members whose job no longer exists.
+func (r *RedisStorage) loadIndexedJobs(ctx context.Context, entries []redis.Z, after *jobCursor) ([]*models.JobState, []interface{}, error) {
+	var ids []string
+	for _, entry := range entries {
+		id, _ := entry.Member.(string)
+		if after != nil && int64(entry.Score) == after.score && id <= after.jobID {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = fmt.Sprintf("job:%s", id)
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get indexed jobs: %w", err)
+	}
+
+	jobs := make([]*models.JobState, 0, len(ids))
+	var missing []interface{}
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			missing = append(missing, ids[i])
+			continue
+		}
+		job, err := models.JobStateFromJSON(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to deserialize job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, missing, nil
+}
+
+// RebuildJobIndexes indexes all stored jobs using SCAN, for jobs saved before indexes existed
+func (r *RedisStorage) RebuildJobIndexes(ctx context.Context) (int, error) {
+	indexed := 0
+	iter := r.client.Scan(ctx, 0, "job:*", 500).Iterator()
+	for iter.Next(ctx) {
+		job, err := r.GetJob(ctx, strings.TrimPrefix(iter.Val(), "job:"))
+		if err != nil {
+			continue
+		}
+		if _, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			indexJob(ctx, pipe, job)
+			return nil
+		}); err != nil {
+			return indexed, fmt.Errorf("failed to index job: %w", err)
+		}
+		indexed++
+	}
+	if err := iter.Err(); err != nil {
+		return indexed, fmt.Errorf("failed to scan jobs: %w", err)
+	}
+	return indexed, nil
+}
+
+// jobCursor is the position of the last job of a page: its index score and ID
+type jobCursor struct {
+	score int64
+	jobID string
+}
+
+func formatCursor(job *models.JobState) string {
+	return fmt.Sprintf("%d:%s", int64(indexScore(job)), job.JobID)
+}
+
+func parseCursor(cursor string) (*jobCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	score, jobID, ok := strings.Cut(cursor, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid cursor: %q", cursor)
+	}
+	n, err := strconv.ParseInt(score, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %q", cursor)
+	}
+	return &jobCursor{score: n, jobID: jobID}, nil
+}
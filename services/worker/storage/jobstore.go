@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"nc-rag-worker/config"
+	"nc-rag-worker/models"
+)
+
+// JobStore keeps parser job state and the long-lived index records of files.
+// Event claims, file versions and ingest markers are coordination state and stay in RedisStorage.
+type JobStore interface {
+	SaveJob(ctx context.Context, job *models.JobState) error
+	GetJob(ctx context.Context, jobID string) (*models.JobState, error)
+	GetJobByFileID(ctx context.Context, fileID int64) (*models.JobState, error)
+	UpdateJobStatus(ctx context.Context, jobID string, status models.JobStatus, errorMessage string) error
+	SupersedeJob(ctx context.Context, jobID, supersededBy string) error
+	DeleteJob(ctx context.Context, jobID string) error
+	ListJobsByStatus(ctx context.Context, status models.JobStatus, cursor string, limit int) (*JobPage, error)
+	ListJobsByTenant(ctx context.Context, tenant, cursor string, limit int) (*JobPage, error)
+	GetFileRecord(ctx context.Context, fileID int64) (*models.FileRecord, error)
+	UpdateFileRecord(ctx context.Context, fileID int64, update func(*models.FileRecord) bool) error
+	DeleteFileRecord(ctx context.Context, fileID int64) error
+	Health(ctx context.Context) error
+}
+
+var (
+	_ JobStore = (*RedisStorage)(nil)
+	_ JobStore = (*PostgresJobStore)(nil)
+	_ JobStore = (*MemoryJobStore)(nil)
+	_ JobStore = (*CachedJobStore)(nil)
+)
+
+// NewJobStore creates the job store selected by cfg.
+// The redis backend is redisStorage itself; postgres is optionally cached in redisStorage.
+func NewJobStore(ctx context.Context, cfg config.JobStoreConfig, redisStorage *RedisStorage) (JobStore, error) {
+	switch cfg.Backend {
+	case "redis":
+		return redisStorage, nil
+	case "memory":
+		return NewMemoryJobStore(), nil
+	case "postgres":
+		pg, err := NewPostgresJobStore(ctx, cfg.PostgresURL)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Cache {
+			return NewCachedJobStore(pg, redisStorage), nil
+		}
+		return pg, nil
+	default:
+		return nil, fmt.Errorf("unknown job store backend: %s", cfg.Backend)
+	}
+}
+
+// applyTransition moves job to status and applies update.
+// It returns false without error if the job already has status.
+func applyTransition(job *models.JobState, status models.JobStatus, reason string, update func(*models.JobState)) (bool, error) {
+	if job.Status == status {
+		return false, nil
+	}
+	if err := job.Transition(status, reason, time.Now()); err != nil {
+		return false, err
+	}
+	update(job)
+	return true, nil
+}
+
+// sortJobsForPaging orders jobs like the indexes and cursors: by submission millisecond, then ID
+func sortJobsForPaging(jobs []*models.JobState) {
+	sort.Slice(jobs, func(i, j int) bool {
+		si, sj := jobs[i].SubmittedAt.UnixMilli(), jobs[j].SubmittedAt.UnixMilli()
+		if si != sj {
+			return si < sj
+		}
+		return jobs[i].JobID < jobs[j].JobID
+	})
+}
+
+// afterCursor checks if job sorts after the cursor position
+func afterCursor(job *models.JobState, after *jobCursor) bool {
+	if after == nil {
+		return true
+	}
+	score := job.SubmittedAt.UnixMilli()
+	return score > after.score || (score == after.score && job.JobID > after.jobID)
+}
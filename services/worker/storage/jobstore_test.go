@@ -0,0 +1,442 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"nc-rag-worker/models"
+)
+
+// jobStoreBackends creates each JobStore implementation for the contract tests.
+// Postgres runs only when JOB_STORE_TEST_POSTGRES_URL points at a scratch database.
+var jobStoreBackends = map[string]func(t *testing.T) JobStore{
+	"memory": func(t *testing.T) JobStore {
+		return NewMemoryJobStore()
+	},
+	"redis": func(t *testing.T) JobStore {
+		r, _ := newTestRedisStorage(t)
+		return r
+	},
+	"cached": func(t *testing.T) JobStore {
+		cache, _ := newTestRedisStorage(t)
+		return NewCachedJobStore(NewMemoryJobStore(), cache)
+	},
+	"postgres": func(t *testing.T) JobStore {
+		return newTestPostgresJobStore(t)
+	},
+	"cached-postgres": func(t *testing.T) JobStore {
+		cache, _ := newTestRedisStorage(t)
+		return NewCachedJobStore(newTestPostgresJobStore(t), cache)
+	},
+}
+
+func newTestPostgresJobStore(t *testing.T) *PostgresJobStore {
+	t.Helper()
+	dsn := os.Getenv("JOB_STORE_TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("JOB_STORE_TEST_POSTGRES_URL is not set")
+	}
+	pg, err := NewPostgresJobStore(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("NewPostgresJobStore: %v", err)
+	}
+	t.Cleanup(func() { pg.Close() })
+	return pg
+}
+
+// runJobStoreContract runs test against every backend
+func runJobStoreContract(t *testing.T, test func(t *testing.T, store JobStore, fixture *jobFixture)) {
+	for name, newStore := range jobStoreBackends {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			test(t, store, newJobFixture(t, store))
+		})
+	}
+}
+
+// jobFixture creates jobs with IDs, tenants and file IDs unique to the test,
+// so backends shared between runs (Postgres) do not see each other's data.
+// The created jobs and file records are deleted when the test ends.
+type jobFixture struct {
+	t      *testing.T
+	store  JobStore
+	prefix string
+	fileID int64
+	base   time.Time
+	jobs   []string
+	files  []int64
+}
+
+func newJobFixture(t *testing.T, store JobStore) *jobFixture {
+	now := time.Now()
+	f := &jobFixture{
+		t:      t,
+		store:  store,
+		prefix: fmt.Sprintf("test-%d", now.UnixNano()),
+		fileID: now.UnixNano() % 1e12 * 1000,
+		base:   now.Truncate(time.Millisecond),
+	}
+	t.Cleanup(func() {
+		ctx := context.Background()
+		for _, jobID := range f.jobs {
+			store.DeleteJob(ctx, jobID)
+		}
+		for _, fileID := range f.files {
+			store.DeleteFileRecord(ctx, fileID)
+		}
+	})
+	return f
+}
+
+// tenant returns the test's tenant
+func (f *jobFixture) tenant() string {
+	return f.prefix + "-tenant"
+}
+
+// file returns the test's n-th file ID
+func (f *jobFixture) file(n int) int64 {
+	f.files = append(f.files, f.fileID+int64(n))
+	return f.fileID + int64(n)
+}
+
+// save saves a submitted job of file n, submitted offset after the fixture's base time
+func (f *jobFixture) save(name string, n int, offset time.Duration) *models.JobState {
+	f.t.Helper()
+	job := &models.JobState{
+		JobID:       f.prefix + "-" + name,
+		FileID:      f.file(n),
+		Tenant:      f.tenant(),
+		FilePath:    fmt.Sprintf("/files/%d.pdf", n),
+		Status:      models.JobStatusSubmitted,
+		SubmittedAt: f.base.Add(offset),
+		TraceID:     "trace-" + name,
+		FileVersion: "etag:" + name,
+	}
+	job.StartHistory(job.SubmittedAt)
+	if err := f.store.SaveJob(context.Background(), job); err != nil {
+		f.t.Fatalf("SaveJob(%s): %v", job.JobID, err)
+	}
+	f.jobs = append(f.jobs, job.JobID)
+	return job
+}
+
+func getJob(t *testing.T, store JobStore, jobID string) *models.JobState {
+	t.Helper()
+	job, err := store.GetJob(context.Background(), jobID)
+	if err != nil {
+		t.Fatalf("GetJob(%s): %v", jobID, err)
+	}
+	return job
+}
+
+func TestJobStoreSaveAndGet(t *testing.T) {
+	runJobStoreContract(t, func(t *testing.T, store JobStore, f *jobFixture) {
+		ctx := context.Background()
+		saved := f.save("a", 1, 0)
+
+		job := getJob(t, store, saved.JobID)
+		if job.FileID != saved.FileID || job.Tenant != saved.Tenant || job.FilePath != saved.FilePath ||
+			job.Status != models.JobStatusSubmitted || job.FileVersion != saved.FileVersion || job.TraceID != saved.TraceID {
+			t.Fatalf("GetJob = %+v, want %+v", job, saved)
+		}
+		if !job.SubmittedAt.Equal(saved.SubmittedAt) {
+			t.Fatalf("SubmittedAt = %s, want %s", job.SubmittedAt, saved.SubmittedAt)
+		}
+		if len(job.Transitions) != 1 || job.Transitions[0].To != models.JobStatusSubmitted {
+			t.Fatalf("Transitions = %+v, want the initial status", job.Transitions)
+		}
+
+		// The file points at its latest saved job
+		newer := f.save("b", 1, time.Second)
+		byFile, err := store.GetJobByFileID(ctx, saved.FileID)
+		if err != nil {
+			t.Fatalf("GetJobByFileID: %v", err)
+		}
+		if byFile.JobID != newer.JobID {
+			t.Fatalf("GetJobByFileID = %s, want %s", byFile.JobID, newer.JobID)
+		}
+
+		if _, err := store.GetJob(ctx, f.prefix+"-missing"); !errors.Is(err, ErrJobNotFound) {
+			t.Fatalf("GetJob(missing) error = %v, want ErrJobNotFound", err)
+		}
+		if _, err := store.GetJobByFileID(ctx, f.file(99)); !errors.Is(err, ErrJobNotFound) {
+			t.Fatalf("GetJobByFileID(missing) error = %v, want ErrJobNotFound", err)
+		}
+	})
+}
+
+func TestJobStoreTransitions(t *testing.T) {
+	runJobStoreContract(t, func(t *testing.T, store JobStore, f *jobFixture) {
+		ctx := context.Background()
+		job := f.save("a", 1, 0)
+
+		for _, status := range []models.JobStatus{models.JobStatusProcessing, models.JobStatusFailed, models.JobStatusSubmitted} {
+			if err := store.UpdateJobStatus(ctx, job.JobID, status, ""); err != nil {
+				t.Fatalf("UpdateJobStatus(%s): %v", status, err)
+			}
+		}
+		if err := store.UpdateJobStatus(ctx, job.JobID, models.JobStatusFailed, "parser crashed"); err != nil {
+			t.Fatalf("UpdateJobStatus(failed): %v", err)
+		}
+		got := getJob(t, store, job.JobID)
+		if got.Status != models.JobStatusFailed || got.ErrorMessage != "parser crashed" {
+			t.Fatalf("job = %s (%q), want failed (parser crashed)", got.Status, got.ErrorMessage)
+		}
+		if len(got.Transitions) != 5 {
+			t.Fatalf("recorded %d transitions, want 5: %+v", len(got.Transitions), got.Transitions)
+		}
+		last := got.Transitions[len(got.Transitions)-1]
+		if last.From != models.JobStatusSubmitted || last.To != models.JobStatusFailed || last.Reason != "parser crashed" {
+			t.Fatalf("last transition = %+v", last)
+		}
+
+		// Setting the current status again changes nothing
+		if err := store.UpdateJobStatus(ctx, job.JobID, models.JobStatusFailed, ""); err != nil {
+			t.Fatalf("UpdateJobStatus(failed again): %v", err)
+		}
+		if n := len(getJob(t, store, job.JobID).Transitions); n != 5 {
+			t.Fatalf("repeated status recorded a transition, have %d", n)
+		}
+
+		if err := store.UpdateJobStatus(ctx, job.JobID, models.JobStatusCompleted, ""); !errors.Is(err, models.ErrInvalidTransition) {
+			t.Fatalf("failed -> completed error = %v, want ErrInvalidTransition", err)
+		}
+
+		if err := store.SupersedeJob(ctx, job.JobID, "newer"); err != nil {
+			t.Fatalf("SupersedeJob: %v", err)
+		}
+		got = getJob(t, store, job.JobID)
+		if got.Status != models.JobStatusSuperseded || got.SupersededBy != "newer" {
+			t.Fatalf("job = %s by %q, want superseded by newer", got.Status, got.SupersededBy)
+		}
+
+		// Superseded is final
+		err := store.UpdateJobStatus(ctx, job.JobID, models.JobStatusSubmitted, "")
+		var transitionErr *models.TransitionError
+		if !errors.As(err, &transitionErr) || transitionErr.From != models.JobStatusSuperseded || transitionErr.To != models.JobStatusSubmitted {
+			t.Fatalf("superseded -> submitted error = %v, want a TransitionError from superseded", err)
+		}
+
+		if err := store.UpdateJobStatus(ctx, f.prefix+"-missing", models.JobStatusProcessing, ""); !errors.Is(err, ErrJobNotFound) {
+			t.Fatalf("UpdateJobStatus(missing) error = %v, want ErrJobNotFound", err)
+		}
+		if err := store.SupersedeJob(ctx, f.prefix+"-missing", "newer"); !errors.Is(err, ErrJobNotFound) {
+			t.Fatalf("SupersedeJob(missing) error = %v, want ErrJobNotFound", err)
+		}
+	})
+}
+
+func TestJobStoreCompletedIsOnlySuperseded(t *testing.T) {
+	runJobStoreContract(t, func(t *testing.T, store JobStore, f *jobFixture) {
+		ctx := context.Background()
+		job := f.save("a", 1, 0)
+
+		if err := store.UpdateJobStatus(ctx, job.JobID, models.JobStatusCompleted, ""); err != nil {
+			t.Fatalf("UpdateJobStatus(completed): %v", err)
+		}
+		for _, status := range []models.JobStatus{models.JobStatusSubmitted, models.JobStatusProcessing, models.JobStatusFailed} {
+			if err := store.UpdateJobStatus(ctx, job.JobID, status, ""); !errors.Is(err, models.ErrInvalidTransition) {
+				t.Fatalf("completed -> %s error = %v, want ErrInvalidTransition", status, err)
+			}
+		}
+		if got := getJob(t, store, job.JobID); got.Status != models.JobStatusCompleted {
+			t.Fatalf("rejected transitions changed the status to %s", got.Status)
+		}
+	})
+}
+
+// pageIDs lists every page of list and returns the job IDs with the fixture's prefix, page by page
+func pageIDs(t *testing.T, f *jobFixture, limit int, list func(cursor string, limit int) (*JobPage, error)) [][]string {
+	t.Helper()
+	var pages [][]string
+	cursor := ""
+	for i := 0; ; i++ {
+		if i > 100000 {
+			t.Fatalf("paging did not terminate")
+		}
+		page, err := list(cursor, limit)
+		if err != nil {
+			t.Fatalf("list page %d: %v", i, err)
+		}
+		if len(page.Jobs) > limit {
+			t.Fatalf("page %d has %d jobs, limit is %d", i, len(page.Jobs), limit)
+		}
+		var ids []string
+		for _, job := range page.Jobs {
+			if strings.HasPrefix(job.JobID, f.prefix) {
+				ids = append(ids, strings.TrimPrefix(job.JobID, f.prefix+"-"))
+			}
+		}
+		if len(ids) > 0 {
+			pages = append(pages, ids)
+		}
+		if page.NextCursor == "" {
+			return pages
+		}
+		cursor = page.NextCursor
+	}
+}
+
+func TestJobStorePaging(t *testing.T) {
+	runJobStoreContract(t, func(t *testing.T, store JobStore, f *jobFixture) {
+		ctx := context.Background()
+		// Saved out of order; c and d share a millisecond and sort by ID
+		f.save("e", 5, 4*time.Millisecond)
+		f.save("a", 1, 0)
+		f.save("d", 4, 2*time.Millisecond)
+		f.save("c", 3, 2*time.Millisecond)
+		f.save("b", 2, time.Millisecond)
+
+		byTenant := func(cursor string, limit int) (*JobPage, error) {
+			return store.ListJobsByTenant(ctx, f.tenant(), cursor, limit)
+		}
+		got := fmt.Sprint(pageIDs(t, f, 2, byTenant))
+		if want := "[[a b] [c d] [e]]"; got != want {
+			t.Fatalf("tenant pages = %s, want %s", got, want)
+		}
+
+		page, err := store.ListJobsByTenant(ctx, f.tenant(), "", 5)
+		if err != nil {
+			t.Fatalf("ListJobsByTenant: %v", err)
+		}
+		if len(page.Jobs) != 5 || page.NextCursor != "" {
+			t.Fatalf("exact page has %d jobs and cursor %q, want 5 and no cursor", len(page.Jobs), page.NextCursor)
+		}
+
+		// Status pages follow status changes; other tests' jobs may be interleaved
+		if err := store.UpdateJobStatus(ctx, f.prefix+"-b", models.JobStatusProcessing, ""); err != nil {
+			t.Fatalf("UpdateJobStatus: %v", err)
+		}
+		if err := store.DeleteJob(ctx, f.prefix+"-d"); err != nil {
+			t.Fatalf("DeleteJob: %v", err)
+		}
+		bySubmitted := func(cursor string, limit int) (*JobPage, error) {
+			return store.ListJobsByStatus(ctx, models.JobStatusSubmitted, cursor, limit)
+		}
+		var submitted []string
+		for _, ids := range pageIDs(t, f, 2, bySubmitted) {
+			submitted = append(submitted, ids...)
+		}
+		if got, want := fmt.Sprint(submitted), "[a c e]"; got != want {
+			t.Fatalf("submitted jobs = %s, want %s", got, want)
+		}
+		processing, err := store.ListJobsByStatus(ctx, models.JobStatusProcessing, "", 100)
+		if err != nil {
+			t.Fatalf("ListJobsByStatus: %v", err)
+		}
+		found := false
+		for _, job := range processing.Jobs {
+			found = found || job.JobID == f.prefix+"-b"
+		}
+		if !found {
+			t.Fatalf("processing job is not listed by its new status")
+		}
+
+		if _, err := store.ListJobsByTenant(ctx, f.tenant(), "not-a-cursor", 2); err == nil {
+			t.Fatalf("invalid cursor was accepted")
+		}
+	})
+}
+
+func TestJobStoreDelete(t *testing.T) {
+	runJobStoreContract(t, func(t *testing.T, store JobStore, f *jobFixture) {
+		ctx := context.Background()
+		older := f.save("a", 1, 0)
+		newer := f.save("b", 1, time.Second)
+
+		// Deleting an older job keeps the file pointing at the newer one
+		if err := store.DeleteJob(ctx, older.JobID); err != nil {
+			t.Fatalf("DeleteJob: %v", err)
+		}
+		if _, err := store.GetJob(ctx, older.JobID); !errors.Is(err, ErrJobNotFound) {
+			t.Fatalf("GetJob(deleted) error = %v, want ErrJobNotFound", err)
+		}
+		byFile, err := store.GetJobByFileID(ctx, newer.FileID)
+		if err != nil || byFile.JobID != newer.JobID {
+			t.Fatalf("GetJobByFileID = %v, %v; want %s", byFile, err, newer.JobID)
+		}
+
+		if err := store.DeleteJob(ctx, newer.JobID); err != nil {
+			t.Fatalf("DeleteJob: %v", err)
+		}
+		if _, err := store.GetJobByFileID(ctx, newer.FileID); !errors.Is(err, ErrJobNotFound) {
+			t.Fatalf("GetJobByFileID after deleting its job error = %v, want ErrJobNotFound", err)
+		}
+		page, err := store.ListJobsByTenant(ctx, f.tenant(), "", 10)
+		if err != nil {
+			t.Fatalf("ListJobsByTenant: %v", err)
+		}
+		if len(page.Jobs) != 0 {
+			t.Fatalf("deleted jobs are still listed: %d", len(page.Jobs))
+		}
+
+		if err := store.DeleteJob(ctx, older.JobID); !errors.Is(err, ErrJobNotFound) {
+			t.Fatalf("DeleteJob(deleted) error = %v, want ErrJobNotFound", err)
+		}
+	})
+}
+
+func TestJobStoreFileRecords(t *testing.T) {
+	runJobStoreContract(t, func(t *testing.T, store JobStore, f *jobFixture) {
+		ctx := context.Background()
+		fileID := f.file(1)
+
+		if _, err := store.GetFileRecord(ctx, fileID); !errors.Is(err, ErrFileRecordNotFound) {
+			t.Fatalf("GetFileRecord(missing) error = %v, want ErrFileRecordNotFound", err)
+		}
+
+		// An update that reports no change does not create the record
+		if err := store.UpdateFileRecord(ctx, fileID, func(*models.FileRecord) bool { return false }); err != nil {
+			t.Fatalf("UpdateFileRecord: %v", err)
+		}
+		if _, err := store.GetFileRecord(ctx, fileID); !errors.Is(err, ErrFileRecordNotFound) {
+			t.Fatalf("unchanged update created a record: %v", err)
+		}
+
+		job := f.save("a", 1, 0)
+		indexedAt := f.base.Add(time.Minute)
+		err := store.UpdateFileRecord(ctx, fileID, func(record *models.FileRecord) bool {
+			if record.FileID != fileID {
+				t.Errorf("new record has file ID %d, want %d", record.FileID, fileID)
+			}
+			record.RecordIndexed(job, "parser-1", "hash", indexedAt)
+			return true
+		})
+		if err != nil {
+			t.Fatalf("UpdateFileRecord: %v", err)
+		}
+
+		// An older job does not replace the latest one
+		older := &models.JobState{JobID: f.prefix + "-old", FileID: fileID, Status: models.JobStatusFailed, SubmittedAt: f.base.Add(-time.Hour)}
+		err = store.UpdateFileRecord(ctx, fileID, func(record *models.FileRecord) bool {
+			return record.RecordJob(older)
+		})
+		if err != nil {
+			t.Fatalf("UpdateFileRecord: %v", err)
+		}
+
+		record, err := store.GetFileRecord(ctx, fileID)
+		if err != nil {
+			t.Fatalf("GetFileRecord: %v", err)
+		}
+		if record.Tenant != f.tenant() || record.LastJobID != job.JobID || record.IndexedJobID != job.JobID ||
+			record.FileVersion != job.FileVersion || record.ParserVersion != "parser-1" || record.ContentHash != "hash" {
+			t.Fatalf("record = %+v", record)
+		}
+		if !record.IndexedAt.Equal(indexedAt) {
+			t.Fatalf("IndexedAt = %s, want %s", record.IndexedAt, indexedAt)
+		}
+
+		if err := store.DeleteFileRecord(ctx, fileID); err != nil {
+			t.Fatalf("DeleteFileRecord: %v", err)
+		}
+		if _, err := store.GetFileRecord(ctx, fileID); !errors.Is(err, ErrFileRecordNotFound) {
+			t.Fatalf("GetFileRecord(deleted) error = %v, want ErrFileRecordNotFound", err)
+		}
+	})
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"nc-rag-worker/models"
+)
+
+// MemoryJobStore keeps job state in process memory.
+// It is meant for tests and single-replica development; state is lost on restart.
+type MemoryJobStore struct {
+	mu      sync.RWMutex
+	jobs    map[string]*models.JobState
+	byFile  map[int64]string
+	records map[int64]models.FileRecord
+}
+
+// NewMemoryJobStore creates an empty in-memory job store
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{
+		jobs:    make(map[string]*models.JobState),
+		byFile:  make(map[int64]string),
+		records: make(map[int64]models.FileRecord),
+	}
+}
+
+// SaveJob stores a copy of the job and points its file at it
+func (m *MemoryJobStore) SaveJob(ctx context.Context, job *models.JobState) error {
+	stored, err := cloneJob(job)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[job.JobID] = stored
+	m.byFile[job.FileID] = job.JobID
+	return nil
+}
+
+// GetJob returns a copy of a job
+func (m *MemoryJobStore) GetJob(ctx context.Context, jobID string) (*models.JobState, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	job, ok := m.jobs[jobID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
+	}
+	return cloneJob(job)
+}
+
+// GetJobByFileID returns a copy of the latest saved job of a file
+func (m *MemoryJobStore) GetJobByFileID(ctx context.Context, fileID int64) (*models.JobState, error) {
+	m.mu.RLock()
+	jobID, ok := m.byFile[fileID]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w for file: %d", ErrJobNotFound, fileID)
+	}
+	return m.GetJob(ctx, jobID)
+}
+
+// UpdateJobStatus moves a job to status if the state machine allows it
+func (m *MemoryJobStore) UpdateJobStatus(ctx context.Context, jobID string, status models.JobStatus, errorMessage string) error {
+	return m.transitionJob(jobID, status, errorMessage, func(job *models.JobState) {
+		if errorMessage != "" {
+			job.ErrorMessage = errorMessage
+		}
+	})
+}
+
+// SupersedeJob marks a job as replaced by a newer job of the same file
+func (m *MemoryJobStore) SupersedeJob(ctx context.Context, jobID, supersededBy string) error {
+	return m.transitionJob(jobID, models.JobStatusSuperseded, "superseded by "+supersededBy, func(job *models.JobState) {
+		job.SupersededBy = supersededBy
+	})
+}
+
+func (m *MemoryJobStore) transitionJob(jobID string, status models.JobStatus, reason string, update func(*models.JobState)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
+	}
+	_, err := applyTransition(job, status, reason, update)
+	return err
+}
+
+// DeleteJob removes a job and its file mapping
+func (m *MemoryJobStore) DeleteJob(ctx context.Context, jobID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("failed to get job for deletion: %w: %s", ErrJobNotFound, jobID)
+	}
+	delete(m.jobs, jobID)
+	if m.byFile[job.FileID] == jobID {
+		delete(m.byFile, job.FileID)
+	}
+	return nil
+}
+
+// ListJobsByStatus returns a page of jobs currently in status, oldest first
+func (m *MemoryJobStore) ListJobsByStatus(ctx context.Context, status models.JobStatus, cursor string, limit int) (*JobPage, error) {
+	return m.listJobs(cursor, limit, func(job *models.JobState) bool { return job.Status == status })
+}
+
+// ListJobsByTenant returns a page of jobs of a tenant, oldest first
+func (m *MemoryJobStore) ListJobsByTenant(ctx context.Context, tenant, cursor string, limit int) (*JobPage, error) {
+	return m.listJobs(cursor, limit, func(job *models.JobState) bool { return job.Tenant == tenant })
+}
+
+func (m *MemoryJobStore) listJobs(cursor string, limit int, match func(*models.JobState) bool) (*JobPage, error) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	after, err := parseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	var matched []*models.JobState
+	for _, job := range m.jobs {
+		if match(job) && afterCursor(job, after) {
+			matched = append(matched, job)
+		}
+	}
+	m.mu.RUnlock()
+	sortJobsForPaging(matched)
+
+	page := &JobPage{}
+	if len(matched) > limit {
+		matched = matched[:limit]
+		page.NextCursor = formatCursor(matched[limit-1])
+	}
+	for _, job := range matched {
+		clone, err := cloneJob(job)
+		if err != nil {
+			return nil, err
+		}
+		page.Jobs = append(page.Jobs, clone)
+	}
+	return page, nil
+}
+
+// GetFileRecord returns a copy of the index record of a file
+func (m *MemoryJobStore) GetFileRecord(ctx context.Context, fileID int64) (*models.FileRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	record, ok := m.records[fileID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrFileRecordNotFound, fileID)
+	}
+	return &record, nil
+}
+
+// UpdateFileRecord applies update to the file's record, starting from an empty record if there is none
+func (m *MemoryJobStore) UpdateFileRecord(ctx context.Context, fileID int64, update func(*models.FileRecord) bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.records[fileID]
+	if !ok {
+		record = models.FileRecord{FileID: fileID}
+	}
+	if update(&record) {
+		m.records[fileID] = record
+	}
+	return nil
+}
+
+// DeleteFileRecord removes the index record of a file
+func (m *MemoryJobStore) DeleteFileRecord(ctx context.Context, fileID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, fileID)
+	return nil
+}
+
+// Health always succeeds
+func (m *MemoryJobStore) Health(ctx context.Context) error {
+	return nil
+}
+
+// cloneJob deep-copies a job so callers cannot mutate stored state
+func cloneJob(job *models.JobState) (*models.JobState, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize job: %w", err)
+	}
+	var clone models.JobState
+	if err := json.Unmarshal(data, &clone); err != nil {
+		return nil, fmt.Errorf("failed to deserialize job: %w", err)
+	}
+	return &clone, nil
+}
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS rag_jobs (
+    job_id          TEXT PRIMARY KEY,
+    file_id         BIGINT NOT NULL,
+    tenant          TEXT NOT NULL DEFAULT '',
+    owner_uid       TEXT NOT NULL DEFAULT '',
+    file_path       TEXT NOT NULL DEFAULT '',
+    status          TEXT NOT NULL,
+    submitted_at    TIMESTAMPTZ NOT NULL,
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    trace_id        TEXT NOT NULL DEFAULT '',
+    parser_response JSONB,
+    error_message   TEXT NOT NULL DEFAULT '',
+    retry_count     INTEGER NOT NULL DEFAULT 0,
+    file_version    TEXT NOT NULL DEFAULT '',
+    superseded_by   TEXT NOT NULL DEFAULT '',
+    transitions     JSONB NOT NULL DEFAULT '[]'
+);
+
+-- Latest job of a file
+CREATE INDEX IF NOT EXISTS rag_jobs_file_idx ON rag_jobs (file_id, submitted_at DESC);
+
+-- Cursor pagination by status and by tenant
+CREATE INDEX IF NOT EXISTS rag_jobs_status_idx ON rag_jobs (status, submitted_at, job_id);
+CREATE INDEX IF NOT EXISTS rag_jobs_tenant_idx ON rag_jobs (tenant, submitted_at, job_id);
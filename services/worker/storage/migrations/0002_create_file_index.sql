@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS rag_file_index (
+    file_id           BIGINT PRIMARY KEY,
+    tenant            TEXT NOT NULL DEFAULT '',
+    file_path         TEXT NOT NULL DEFAULT '',
+    last_job_id       TEXT NOT NULL DEFAULT '',
+    last_status       TEXT NOT NULL DEFAULT '',
+    last_error        TEXT NOT NULL DEFAULT '',
+    last_submitted_at TIMESTAMPTZ,
+    indexed_job_id    TEXT NOT NULL DEFAULT '',
+    file_version      TEXT NOT NULL DEFAULT '',
+    parser_version    TEXT NOT NULL DEFAULT '',
+    content_hash      TEXT NOT NULL DEFAULT '',
+    indexed_at        TIMESTAMPTZ,
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS rag_file_index_tenant_idx ON rag_file_index (tenant);
@@ -0,0 +1,486 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"nc-rag-worker/metrics"
+	"nc-rag-worker/models"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrationLockID serializes migrations of concurrently starting replicas (pg_advisory_lock key)
+const migrationLockID = 726100001
+
+const jobColumns = `job_id, file_id, tenant, owner_uid, file_path, status, submitted_at, trace_id,
+	parser_response, error_message, retry_count, file_version, superseded_by, transitions`
+
+// PostgresJobStore keeps job state durably in PostgreSQL
+type PostgresJobStore struct {
+	db        *sql.DB
+	connector *dsnConnector
+}
+
+// NewPostgresJobStore connects to PostgreSQL and applies pending migrations
+func NewPostgresJobStore(ctx context.Context, dsn string) (*PostgresJobStore, error) {
+	connector := &dsnConnector{}
+	if err := connector.SetDSN(dsn); err != nil {
+		return nil, fmt.Errorf("failed to open PostgreSQL: %w", err)
+	}
+	db := sql.OpenDB(connector)
+	db.SetMaxOpenConns(10)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+
+	s := &PostgresJobStore{db: db, connector: connector}
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// SetURL switches new connections to the rotated credentials of dsn; open connections are kept
+func (s *PostgresJobStore) SetURL(dsn string) error {
+	return s.connector.SetDSN(dsn)
+}
+
+// dsnConnector opens every connection with the current DSN
+type dsnConnector struct {
+	connector atomic.Pointer[pq.Connector]
+}
+
+// SetDSN parses dsn and uses it for new connections
+func (c *dsnConnector) SetDSN(dsn string) error {
+	connector, err := pq.NewConnector(dsn)
+	if err != nil {
+		return err
+	}
+	c.connector.Store(connector)
+	return nil
+}
+
+// Connect opens a connection with the current DSN
+func (c *dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.connector.Load().Connect(ctx)
+}
+
+// Driver returns the PostgreSQL driver
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.connector.Load().Driver()
+}
+
+// migrate applies embedded migrations that are not yet recorded in rag_schema_migrations
+func (s *PostgresJobStore) migrate(ctx context.Context) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection for migrations: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS rag_schema_migrations (
+		version    TEXT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return fmt.Errorf("failed to list migrations: %w", err)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version := strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".sql")
+
+		var applied bool
+		if err := conn.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM rag_schema_migrations WHERE version = $1)`, version,
+		).Scan(&applied); err != nil {
+			return fmt.Errorf("failed to check migration %s: %w", version, err)
+		}
+		if applied {
+			continue
+		}
+
+		script, err := migrations.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s: %w", version, err)
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %s: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %s: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO rag_schema_migrations (version) VALUES ($1)`, version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %s: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %s: %w", version, err)
+		}
+		log.WithField("version", version).Info("Applied job store migration")
+	}
+	return nil
+}
+
+// SaveJob inserts or replaces a job
+func (s *PostgresJobStore) SaveJob(ctx context.Context, job *models.JobState) error {
+	if err := s.upsertJob(ctx, s.db, job); err != nil {
+		return err
+	}
+	metrics.JobStatusChanges.WithLabelValues(string(job.Status)).Inc()
+	return nil
+}
+
+// GetJob retrieves a job by ID
+func (s *PostgresJobStore) GetJob(ctx context.Context, jobID string) (*models.JobState, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM rag_jobs WHERE job_id = $1`, jobID)
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	return job, nil
+}
+
+// GetJobByFileID retrieves the latest job of a file
+func (s *PostgresJobStore) GetJobByFileID(ctx context.Context, fileID int64) (*models.JobState, error) {
+	row := s.db.QueryRowContext(ctx,
+		`SELECT `+jobColumns+` FROM rag_jobs WHERE file_id = $1 ORDER BY submitted_at DESC LIMIT 1`, fileID)
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w for file: %d", ErrJobNotFound, fileID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job for file: %w", err)
+	}
+	return job, nil
+}
+
+// UpdateJobStatus atomically moves a job to status if the state machine allows it.
+// Setting the current status again is a no-op; an illegal move returns a *models.TransitionError.
+func (s *PostgresJobStore) UpdateJobStatus(ctx context.Context, jobID string, status models.JobStatus, errorMessage string) error {
+	return s.transitionJob(ctx, jobID, status, errorMessage, func(job *models.JobState) {
+		if errorMessage != "" {
+			job.ErrorMessage = errorMessage
+		}
+	})
+}
+
+// SupersedeJob atomically marks a job as replaced by a newer job of the same file
+func (s *PostgresJobStore) SupersedeJob(ctx context.Context, jobID, supersededBy string) error {
+	return s.transitionJob(ctx, jobID, models.JobStatusSuperseded, "superseded by "+supersededBy, func(job *models.JobState) {
+		job.SupersededBy = supersededBy
+	})
+}
+
+// transitionJob applies a status transition with the job row locked
+func (s *PostgresJobStore) transitionJob(ctx context.Context, jobID string, status models.JobStatus, reason string, update func(*models.JobState)) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin job update: %w", err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM rag_jobs WHERE job_id = $1 FOR UPDATE`, jobID)
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get job for update: %w", err)
+	}
+
+	changed, err := applyTransition(job, status, reason, update)
+	if err != nil || !changed {
+		return err
+	}
+	if err := s.upsertJob(ctx, tx, job); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit job update: %w", err)
+	}
+
+	metrics.JobStatusChanges.WithLabelValues(string(status)).Inc()
+	return nil
+}
+
+// DeleteJob removes a job
+func (s *PostgresJobStore) DeleteJob(ctx context.Context, jobID string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM rag_jobs WHERE job_id = $1`, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to delete job: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("failed to get job for deletion: %w: %s", ErrJobNotFound, jobID)
+	}
+	return nil
+}
+
+// ListJobsByStatus returns a page of jobs currently in status, oldest first
+func (s *PostgresJobStore) ListJobsByStatus(ctx context.Context, status models.JobStatus, cursor string, limit int) (*JobPage, error) {
+	return s.listJobs(ctx, "status", string(status), cursor, limit)
+}
+
+// ListJobsByTenant returns a page of jobs of a tenant, oldest first
+func (s *PostgresJobStore) ListJobsByTenant(ctx context.Context, tenant, cursor string, limit int) (*JobPage, error) {
+	return s.listJobs(ctx, "tenant", tenant, cursor, limit)
+}
+
+// listJobs pages by (submitted_at, job_id); the cursor holds the last row's microsecond timestamp and ID
+func (s *PostgresJobStore) listJobs(ctx context.Context, column, value, cursor string, limit int) (*JobPage, error) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	after, err := parseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + jobColumns + ` FROM rag_jobs WHERE ` + column + ` = $1`
+	args := []interface{}{value}
+	if after != nil {
+		query += ` AND (submitted_at, job_id) > ($2, $3)`
+		args = append(args, time.UnixMicro(after.score).UTC(), after.jobID)
+	}
+	query += fmt.Sprintf(` ORDER BY submitted_at, job_id LIMIT %d`, limit+1)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	page := &JobPage{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read job: %w", err)
+		}
+		if len(page.Jobs) == limit {
+			last := page.Jobs[limit-1]
+			page.NextCursor = fmt.Sprintf("%d:%s", last.SubmittedAt.UnixMicro(), last.JobID)
+			break
+		}
+		page.Jobs = append(page.Jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	return page, nil
+}
+
+// Close closes the database connections
+func (s *PostgresJobStore) Close() error {
+	return s.db.Close()
+}
+
+// Health checks the PostgreSQL connection
+func (s *PostgresJobStore) Health(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func (s *PostgresJobStore) upsertJob(ctx context.Context, db execer, job *models.JobState) error {
+	parserResponse, err := json.Marshal(job.ParserResponse)
+	if err != nil {
+		return fmt.Errorf("failed to serialize parser response: %w", err)
+	}
+	transitions, err := json.Marshal(job.Transitions)
+	if err != nil {
+		return fmt.Errorf("failed to serialize transitions: %w", err)
+	}
+	if job.Transitions == nil {
+		transitions = []byte("[]")
+	}
+
+	_, err = db.ExecContext(ctx, `INSERT INTO rag_jobs (`+jobColumns+`, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, now())
+		ON CONFLICT (job_id) DO UPDATE SET
+			file_id = EXCLUDED.file_id,
+			tenant = EXCLUDED.tenant,
+			owner_uid = EXCLUDED.owner_uid,
+			file_path = EXCLUDED.file_path,
+			status = EXCLUDED.status,
+			submitted_at = EXCLUDED.submitted_at,
+			trace_id = EXCLUDED.trace_id,
+			parser_response = EXCLUDED.parser_response,
+			error_message = EXCLUDED.error_message,
+			retry_count = EXCLUDED.retry_count,
+			file_version = EXCLUDED.file_version,
+			superseded_by = EXCLUDED.superseded_by,
+			transitions = EXCLUDED.transitions,
+			updated_at = now()`,
+		job.JobID, job.FileID, job.Tenant, job.OwnerUID, job.FilePath, string(job.Status), job.SubmittedAt,
+		job.TraceID, parserResponse, job.ErrorMessage, job.RetryCount, job.FileVersion, job.SupersededBy, transitions,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save job state: %w", err)
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row rowScanner) (*models.JobState, error) {
+	var job models.JobState
+	var status string
+	var parserResponse, transitions []byte
+	if err := row.Scan(
+		&job.JobID, &job.FileID, &job.Tenant, &job.OwnerUID, &job.FilePath, &status, &job.SubmittedAt,
+		&job.TraceID, &parserResponse, &job.ErrorMessage, &job.RetryCount, &job.FileVersion, &job.SupersededBy, &transitions,
+	); err != nil {
+		return nil, err
+	}
+	job.Status = models.JobStatus(status)
+
+	if len(parserResponse) > 0 {
+		if err := json.Unmarshal(parserResponse, &job.ParserResponse); err != nil {
+			return nil, fmt.Errorf("failed to deserialize parser response: %w", err)
+		}
+	}
+	if err := json.Unmarshal(transitions, &job.Transitions); err != nil {
+		return nil, fmt.Errorf("failed to deserialize transitions: %w", err)
+	}
+	return &job, nil
+}
+
+const fileRecordColumns = `file_id, tenant, file_path, last_job_id, last_status, last_error, last_submitted_at,
+	indexed_job_id, file_version, parser_version, content_hash, indexed_at`
+
+// GetFileRecord retrieves the index record of a file
+func (s *PostgresJobStore) GetFileRecord(ctx context.Context, fileID int64) (*models.FileRecord, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+fileRecordColumns+` FROM rag_file_index WHERE file_id = $1`, fileID)
+	record, err := scanFileRecord(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrFileRecordNotFound, fileID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file record: %w", err)
+	}
+	return record, nil
+}
+
+// UpdateFileRecord atomically applies update to the file's record, starting from an empty
+// record if there is none. A transaction-scoped advisory lock on the file ID serializes writers.
+func (s *PostgresJobStore) UpdateFileRecord(ctx context.Context, fileID int64, update func(*models.FileRecord) bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin file record update: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, fileID); err != nil {
+		return fmt.Errorf("failed to lock file record: %w", err)
+	}
+
+	row := tx.QueryRowContext(ctx, `SELECT `+fileRecordColumns+` FROM rag_file_index WHERE file_id = $1`, fileID)
+	record, err := scanFileRecord(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		record, err = &models.FileRecord{FileID: fileID}, nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get file record: %w", err)
+	}
+
+	if !update(record) {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO rag_file_index (`+fileRecordColumns+`, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, now())
+		ON CONFLICT (file_id) DO UPDATE SET
+			tenant = EXCLUDED.tenant,
+			file_path = EXCLUDED.file_path,
+			last_job_id = EXCLUDED.last_job_id,
+			last_status = EXCLUDED.last_status,
+			last_error = EXCLUDED.last_error,
+			last_submitted_at = EXCLUDED.last_submitted_at,
+			indexed_job_id = EXCLUDED.indexed_job_id,
+			file_version = EXCLUDED.file_version,
+			parser_version = EXCLUDED.parser_version,
+			content_hash = EXCLUDED.content_hash,
+			indexed_at = EXCLUDED.indexed_at,
+			updated_at = now()`,
+		record.FileID, record.Tenant, record.FilePath, record.LastJobID, string(record.LastStatus), record.LastError,
+		nullTime(record.LastSubmittedAt), record.IndexedJobID, record.FileVersion, record.ParserVersion,
+		record.ContentHash, nullTime(record.IndexedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save file record: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit file record: %w", err)
+	}
+	return nil
+}
+
+// DeleteFileRecord removes the index record of a deleted file
+func (s *PostgresJobStore) DeleteFileRecord(ctx context.Context, fileID int64) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM rag_file_index WHERE file_id = $1`, fileID); err != nil {
+		return fmt.Errorf("failed to delete file record: %w", err)
+	}
+	return nil
+}
+
+func scanFileRecord(row rowScanner) (*models.FileRecord, error) {
+	var record models.FileRecord
+	var lastStatus string
+	var lastSubmittedAt, indexedAt sql.NullTime
+	if err := row.Scan(
+		&record.FileID, &record.Tenant, &record.FilePath, &record.LastJobID, &lastStatus, &record.LastError, &lastSubmittedAt,
+		&record.IndexedJobID, &record.FileVersion, &record.ParserVersion, &record.ContentHash, &indexedAt,
+	); err != nil {
+		return nil, err
+	}
+	record.LastStatus = models.JobStatus(lastStatus)
+	record.LastSubmittedAt = lastSubmittedAt.Time
+	record.IndexedAt = indexedAt.Time
+	return &record, nil
+}
+
+// nullTime stores the zero time as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
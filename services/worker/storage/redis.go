@@ -2,27 +2,53 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
+	"nc-rag-worker/config"
+	"nc-rag-worker/metrics"
 	"nc-rag-worker/models"
+	"nc-rag-worker/tracing"
 
 	"github.com/go-redis/redis/v8"
 )
 
+// ErrJobNotFound is returned when a job or file mapping does not exist
+var ErrJobNotFound = errors.New("job not found")
+
+// maxTransitionAttempts bounds optimistic retries of a status update racing other writers
+const maxTransitionAttempts = 10
+
 // RedisStorage implements job state storage using Redis
 type RedisStorage struct {
-	client *redis.Client
+	client      *redis.Client
+	credentials atomic.Pointer[redisCredentials]
+	retention   config.RetentionConfig
 }
 
 // NewRedisStorage creates a new Redis storage instance
-func NewRedisStorage(redisURL string) (*RedisStorage, error) {
+func NewRedisStorage(redisURL string, retention config.RetentionConfig) (*RedisStorage, error) {
 	opt, err := redis.ParseURL(redisURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
 	}
 
+	r := &RedisStorage{retention: retention}
+	r.credentials.Store(&redisCredentials{username: opt.Username, password: opt.Password})
+
+	// Authenticate and select the database per connection, so rotated credentials apply to new connections.
+	// go-redis would select the database before OnConnect, which fails before authentication.
+	db := opt.DB
+	opt.Username, opt.Password, opt.DB = "", "", 0
+	opt.OnConnect = func(ctx context.Context, cn *redis.Conn) error {
+		return r.initConn(ctx, cn, db)
+	}
+
 	client := redis.NewClient(opt)
+	client.AddHook(metrics.RedisHook{})
+	client.AddHook(tracing.RedisHook{})
 
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -32,9 +58,45 @@ func NewRedisStorage(redisURL string) (*RedisStorage, error) {
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
-	return &RedisStorage{
-		client: client,
-	}, nil
+	r.client = client
+	return r, nil
+}
+
+// redisCredentials are the credentials new connections authenticate with
+type redisCredentials struct {
+	username string
+	password string
+}
+
+// initConn authenticates a new connection with the current credentials and selects db
+func (r *RedisStorage) initConn(ctx context.Context, cn *redis.Conn, db int) error {
+	creds := r.credentials.Load()
+	if creds.password != "" {
+		var err error
+		if creds.username != "" {
+			err = cn.AuthACL(ctx, creds.username, creds.password).Err()
+		} else {
+			err = cn.Auth(ctx, creds.password).Err()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if db > 0 {
+		return cn.Select(ctx, db).Err()
+	}
+	return nil
+}
+
+// SetURL switches to the rotated credentials of redisURL; open connections stay authenticated.
+// The address and database must not change.
+func (r *RedisStorage) SetURL(redisURL string) error {
+	opt, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse Redis URL: %w", err)
+	}
+	r.credentials.Store(&redisCredentials{username: opt.Username, password: opt.Password})
+	return nil
 }
 
 // SaveJob saves a job state to Redis
@@ -44,18 +106,21 @@ func (r *RedisStorage) SaveJob(ctx context.Context, job *models.JobState) error
 		return fmt.Errorf("failed to serialize job: %w", err)
 	}
 
-	// Save job state with TTL (24 hours)
+	// Save job state and file-to-job mapping with the status' retention and update the job indexes
 	jobKey := fmt.Sprintf("job:%s", job.JobID)
-	if err := r.client.Set(ctx, jobKey, jobJSON, 24*time.Hour).Err(); err != nil {
-		return fmt.Errorf("failed to save job state: %w", err)
-	}
-
-	// Create file-to-job mapping with TTL (24 hours)
 	fileKey := fmt.Sprintf("file:%d", job.FileID)
-	if err := r.client.Set(ctx, fileKey, job.JobID, 24*time.Hour).Err(); err != nil {
-		return fmt.Errorf("failed to save file mapping: %w", err)
+	ttl := r.jobTTL(job.Status)
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, jobKey, jobJSON, ttl)
+		pipe.Set(ctx, fileKey, job.JobID, ttl)
+		indexJob(ctx, pipe, job)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save job state: %w", err)
 	}
 
+	metrics.JobStatusChanges.WithLabelValues(string(job.Status)).Inc()
 	return nil
 }
 
@@ -65,7 +130,7 @@ func (r *RedisStorage) GetJob(ctx context.Context, jobID string) (*models.JobSta
 	jobJSON, err := r.client.Get(ctx, jobKey).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return nil, fmt.Errorf("job not found: %s", jobID)
+			return nil, fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
 		}
 		return nil, fmt.Errorf("failed to get job: %w", err)
 	}
@@ -84,7 +149,7 @@ func (r *RedisStorage) GetJobByFileID(ctx context.Context, fileID int64) (*model
 	jobID, err := r.client.Get(ctx, fileKey).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return nil, fmt.Errorf("no job found for file: %d", fileID)
+			return nil, fmt.Errorf("%w for file: %d", ErrJobNotFound, fileID)
 		}
 		return nil, fmt.Errorf("failed to get file mapping: %w", err)
 	}
@@ -92,19 +157,81 @@ func (r *RedisStorage) GetJobByFileID(ctx context.Context, fileID int64) (*model
 	return r.GetJob(ctx, jobID)
 }
 
-// UpdateJobStatus updates the status of a job
+// UpdateJobStatus atomically moves a job to status if the state machine allows it.
+// Setting the current status again is a no-op; an illegal move returns a *models.TransitionError.
 func (r *RedisStorage) UpdateJobStatus(ctx context.Context, jobID string, status models.JobStatus, errorMessage string) error {
-	job, err := r.GetJob(ctx, jobID)
-	if err != nil {
-		return fmt.Errorf("failed to get job for update: %w", err)
-	}
+	return r.transitionJob(ctx, jobID, status, errorMessage, func(job *models.JobState) {
+		if errorMessage != "" {
+			job.ErrorMessage = errorMessage
+		}
+	})
+}
+
+// SupersedeJob atomically marks a job as replaced by a newer job of the same file
+func (r *RedisStorage) SupersedeJob(ctx context.Context, jobID, supersededBy string) error {
+	return r.transitionJob(ctx, jobID, models.JobStatusSuperseded, "superseded by "+supersededBy, func(job *models.JobState) {
+		job.SupersededBy = supersededBy
+	})
+}
+
+// transitionJob applies a status transition under WATCH, retrying when another writer changed the job meanwhile
+func (r *RedisStorage) transitionJob(ctx context.Context, jobID string, status models.JobStatus, reason string, update func(*models.JobState)) error {
+	jobKey := fmt.Sprintf("job:%s", jobID)
 
-	job.Status = status
-	if errorMessage != "" {
-		job.ErrorMessage = errorMessage
+	txf := func(tx *redis.Tx) error {
+		jobJSON, err := tx.Get(ctx, jobKey).Result()
+		if err != nil {
+			if err == redis.Nil {
+				return fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
+			}
+			return fmt.Errorf("failed to get job for update: %w", err)
+		}
+		job, err := models.JobStateFromJSON(jobJSON)
+		if err != nil {
+			return fmt.Errorf("failed to deserialize job: %w", err)
+		}
+		changed, err := applyTransition(job, status, reason, update)
+		if err != nil || !changed {
+			return err
+		}
+
+		updated, err := job.ToJSON()
+		if err != nil {
+			return fmt.Errorf("failed to serialize job: %w", err)
+		}
+
+		// Refresh the file mapping only while it still points at this job
+		fileKey := fmt.Sprintf("file:%d", job.FileID)
+		current, err := tx.Get(ctx, fileKey).Result()
+		if err != nil && err != redis.Nil {
+			return fmt.Errorf("failed to get file mapping: %w", err)
+		}
+
+		ttl := r.jobTTL(status)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, jobKey, updated, ttl)
+			if current == job.JobID && ttl > 0 {
+				pipe.Expire(ctx, fileKey, ttl)
+			} else if current == job.JobID {
+				pipe.Persist(ctx, fileKey)
+			}
+			indexJob(ctx, pipe, job)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		metrics.JobStatusChanges.WithLabelValues(string(status)).Inc()
+		return nil
 	}
 
-	return r.SaveJob(ctx, job)
+	for attempt := 0; attempt < maxTransitionAttempts; attempt++ {
+		err := r.client.Watch(ctx, txf, jobKey)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to update job %s: too many concurrent updates", jobID)
 }
 
 // DeleteJob removes a job and its file mapping from Redis
@@ -115,37 +242,44 @@ func (r *RedisStorage) DeleteJob(ctx context.Context, jobID string) error {
 		return fmt.Errorf("failed to get job for deletion: %w", err)
 	}
 
-	// Delete job state
+	// Delete job state and remove it from the job indexes
 	jobKey := fmt.Sprintf("job:%s", jobID)
-	if err := r.client.Del(ctx, jobKey).Err(); err != nil {
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, jobKey)
+		unindexJob(ctx, pipe, job)
+		return nil
+	})
+	if err != nil {
 		return fmt.Errorf("failed to delete job: %w", err)
 	}
 
-	// Delete file mapping
+	// Delete the file mapping unless it already points at a newer job
 	fileKey := fmt.Sprintf("file:%d", job.FileID)
-	if err := r.client.Del(ctx, fileKey).Err(); err != nil {
+	if err := releaseIfOwnerScript.Run(ctx, r.client, []string{fileKey}, jobID).Err(); err != nil {
 		return fmt.Errorf("failed to delete file mapping: %w", err)
 	}
 
 	return nil
 }
 
-// ListJobs returns all job IDs (for monitoring/debugging)
-func (r *RedisStorage) ListJobs(ctx context.Context) ([]string, error) {
-	keys, err := r.client.Keys(ctx, "job:*").Result()
+// MarkIngestPublished records that ingest.ready was published for a job.
+// It returns false if the job was already marked, so callers publish at most once.
+func (r *RedisStorage) MarkIngestPublished(ctx context.Context, jobID string) (bool, error) {
+	ingestKey := fmt.Sprintf("ingest:%s", jobID)
+	ok, err := r.client.SetNX(ctx, ingestKey, time.Now().Unix(), 24*time.Hour).Result()
 	if err != nil {
-		return nil, fmt.Errorf("failed to list jobs: %w", err)
+		return false, fmt.Errorf("failed to mark ingest published: %w", err)
 	}
+	return ok, nil
+}
 
-	jobIDs := make([]string, 0, len(keys))
-	for _, key := range keys {
-		// Extract job ID from key (remove "job:" prefix)
-		if len(key) > 4 {
-			jobIDs = append(jobIDs, key[4:])
-		}
+// ClearIngestPublished removes the ingest marker so a failed publish can be retried
+func (r *RedisStorage) ClearIngestPublished(ctx context.Context, jobID string) error {
+	ingestKey := fmt.Sprintf("ingest:%s", jobID)
+	if err := r.client.Del(ctx, ingestKey).Err(); err != nil {
+		return fmt.Errorf("failed to clear ingest marker: %w", err)
 	}
-
-	return jobIDs, nil
+	return nil
 }
 
 // Close closes the Redis connection
@@ -156,4 +290,14 @@ func (r *RedisStorage) Close() error {
 // Health checks Redis connection health
 func (r *RedisStorage) Health(ctx context.Context) error {
 	return r.client.Ping(ctx).Err()
-}
\ No newline at end of file
+}
+
+// jobTTL is the Redis expiry of a job in status: its retention plus a grace period for the
+// sweeper to compact it first. 0 keeps the job until the sweeper or a delete removes it.
+func (r *RedisStorage) jobTTL(status models.JobStatus) time.Duration {
+	retention := retentionFor(r.retention, status)
+	if retention <= 0 {
+		return 0
+	}
+	return retention + sweepGrace
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// fileACLLockLease bounds how long a crashed worker can block ACL updates of a file
+	fileACLLockLease = 30 * time.Second
+
+	shareGranted = "1"
+	shareRevoked = "0"
+)
+
+func fileSharesKey(tenant string, fileID int64) string {
+	return fmt.Sprintf("file_shares:%s:%d", tenant, fileID)
+}
+
+func fileACLLockKey(tenant string, fileID int64) string {
+	return fmt.Sprintf("file_acl_lock:%s:%d", tenant, fileID)
+}
+
+// RecordShare stores the latest share event of a principal on a file, so it is applied
+// at ingest even if the file has no indexed points yet
+func (r *RedisStorage) RecordShare(ctx context.Context, tenant string, fileID int64, principal string, granted bool) error {
+	value := shareRevoked
+	if granted {
+		value = shareGranted
+	}
+	if err := r.client.HSet(ctx, fileSharesKey(tenant, fileID), principal, value).Err(); err != nil {
+		return fmt.Errorf("failed to record share: %w", err)
+	}
+	return nil
+}
+
+// FileShares returns the stored share events of a file by principal; true means granted
+func (r *RedisStorage) FileShares(ctx context.Context, tenant string, fileID int64) (map[string]bool, error) {
+	values, err := r.client.HGetAll(ctx, fileSharesKey(tenant, fileID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file shares: %w", err)
+	}
+	shares := make(map[string]bool, len(values))
+	for principal, value := range values {
+		shares[principal] = value == shareGranted
+	}
+	return shares, nil
+}
+
+// ClearFileShares forgets the stored share events of a deleted file
+func (r *RedisStorage) ClearFileShares(ctx context.Context, tenant string, fileID int64) error {
+	if err := r.client.Del(ctx, fileSharesKey(tenant, fileID)).Err(); err != nil {
+		return fmt.Errorf("failed to clear file shares: %w", err)
+	}
+	return nil
+}
+
+// LockFileACL locks the principals of a file for a read-modify-write with the given token.
+// It reports false if another worker holds the lock.
+func (r *RedisStorage) LockFileACL(ctx context.Context, tenant string, fileID int64, token string) (bool, error) {
+	ok, err := r.client.SetNX(ctx, fileACLLockKey(tenant, fileID), token, fileACLLockLease).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to lock file ACL: %w", err)
+	}
+	return ok, nil
+}
+
+// UnlockFileACL releases the ACL lock of a file if it is still held with token
+func (r *RedisStorage) UnlockFileACL(ctx context.Context, tenant string, fileID int64, token string) error {
+	if err := releaseIfOwnerScript.Run(ctx, r.client, []string{fileACLLockKey(tenant, fileID)}, token).Err(); err != nil {
+		return fmt.Errorf("failed to unlock file ACL: %w", err)
+	}
+	return nil
+}
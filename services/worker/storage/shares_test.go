@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFileShares(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestRedisStorage(t)
+
+	if err := r.RecordShare(ctx, "tenant", 42, "u:bob", true); err != nil {
+		t.Fatalf("RecordShare: %v", err)
+	}
+	if err := r.RecordShare(ctx, "tenant", 42, "g:staff", true); err != nil {
+		t.Fatalf("RecordShare: %v", err)
+	}
+	// The latest event of a principal wins
+	if err := r.RecordShare(ctx, "tenant", 42, "g:staff", false); err != nil {
+		t.Fatalf("RecordShare: %v", err)
+	}
+
+	shares, err := r.FileShares(ctx, "tenant", 42)
+	if err != nil {
+		t.Fatalf("FileShares: %v", err)
+	}
+	if len(shares) != 2 || !shares["u:bob"] || shares["g:staff"] {
+		t.Fatalf("shares = %v, want u:bob granted and g:staff revoked", shares)
+	}
+
+	if err := r.ClearFileShares(ctx, "tenant", 42); err != nil {
+		t.Fatalf("ClearFileShares: %v", err)
+	}
+	if shares, _ := r.FileShares(ctx, "tenant", 42); len(shares) != 0 {
+		t.Fatalf("shares after clear = %v, want none", shares)
+	}
+}
+
+func TestLockFileACL(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestRedisStorage(t)
+
+	if ok, err := r.LockFileACL(ctx, "tenant", 42, "a"); err != nil || !ok {
+		t.Fatalf("first lock = %v, %v; want acquired", ok, err)
+	}
+	if ok, _ := r.LockFileACL(ctx, "tenant", 42, "b"); ok {
+		t.Fatal("second lock acquired while held")
+	}
+
+	// Only the holder can unlock
+	if err := r.UnlockFileACL(ctx, "tenant", 42, "b"); err != nil {
+		t.Fatalf("UnlockFileACL: %v", err)
+	}
+	if ok, _ := r.LockFileACL(ctx, "tenant", 42, "b"); ok {
+		t.Fatal("lock acquired after unlock by non-holder")
+	}
+	if err := r.UnlockFileACL(ctx, "tenant", 42, "a"); err != nil {
+		t.Fatalf("UnlockFileACL: %v", err)
+	}
+	if ok, _ := r.LockFileACL(ctx, "tenant", 42, "b"); !ok {
+		t.Fatal("lock not acquired after release")
+	}
+}
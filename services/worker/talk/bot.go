@@ -0,0 +1,344 @@
+package talk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"nc-rag-worker/config"
+	"nc-rag-worker/models"
+	"nc-rag-worker/nextcloud"
+	"nc-rag-worker/query"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	maxBodySize = 1 << 20
+	// answerTimeout bounds retrieval plus generation for a single chat question
+	answerTimeout = 3 * time.Minute
+	// queueSize bounds the questions waiting for a free worker; further webhooks get 503
+	queueSize = 64
+	// dedupeTTL is how long a message ID is remembered to ignore redelivered webhooks
+	dedupeTTL = 10 * time.Minute
+)
+
+// errUnknownReader is returned for conversations with participants that have no ACL identity
+var errUnknownReader = errors.New("conversation has participants without a user account")
+
+// Bot answers questions addressed to it in Nextcloud Talk conversations
+type Bot struct {
+	cfg          config.TalkConfig
+	nextcloudURL string
+	client       *Client
+	ncClient     *nextcloud.Client
+	service      *query.Service
+	questions    chan *question
+
+	seenMu sync.Mutex
+	seen   map[string]time.Time
+}
+
+// question is a chat message addressed to the bot, waiting to be answered
+type question struct {
+	activity *models.TalkActivity
+	text     string
+}
+
+// NewBot creates a new Talk bot; ncClient must be a participant of the conversations
+// the bot is added to, so it can check who will read an answer
+func NewBot(cfg config.TalkConfig, nextcloudURL string, ncClient *nextcloud.Client, service *query.Service) *Bot {
+	return &Bot{
+		cfg:          cfg,
+		nextcloudURL: strings.TrimSuffix(nextcloudURL, "/"),
+		client:       NewClient(nextcloudURL, cfg.Secret),
+		ncClient:     ncClient,
+		service:      service,
+		questions:    make(chan *question, queueSize),
+		seen:         make(map[string]time.Time),
+	}
+}
+
+// SetSecret switches to a rotated bot secret for webhook signatures and replies
+func (b *Bot) SetSecret(secret string) {
+	b.client.SetSecret(secret)
+}
+
+// Start answers queued questions with cfg.Concurrency workers until ctx is cancelled,
+// then waits for the workers; answers in progress are cancelled with ctx
+func (b *Bot) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < b.cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case q := <-b.questions:
+					b.answer(ctx, q)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	log.Info("Talk bot stopped")
+}
+
+// ServeHTTP handles the Talk bot webhook
+func (b *Bot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	random := r.Header.Get("X-Nextcloud-Talk-Random")
+	signature := r.Header.Get("X-Nextcloud-Talk-Signature")
+	// An empty secret would accept webhooks signed with an empty key
+	secret := b.client.currentSecret()
+	if random == "" || secret == "" || !verify(secret, random, string(body), signature) {
+		log.WithField("remote_addr", r.RemoteAddr).Warn("Rejected Talk webhook with invalid signature")
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var activity models.TalkActivity
+	if err := json.Unmarshal(body, &activity); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	q := b.questionFrom(&activity)
+	if q == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	key := activity.Target.ID + "/" + activity.Object.ID
+	if !b.markSeen(key) {
+		log.WithField("message_id", activity.Object.ID).Debug("Ignoring redelivered Talk message")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Talk expects a quick acknowledgement; answering can take much longer
+	select {
+	case b.questions <- q:
+		w.WriteHeader(http.StatusOK)
+	default:
+		b.forget(key)
+		log.WithField("conversation", activity.Target.ID).Warn("Talk question queue is full, rejecting message")
+		http.Error(w, "too many questions", http.StatusServiceUnavailable)
+	}
+}
+
+// questionFrom returns the question of a chat message addressed to the bot, or nil
+func (b *Bot) questionFrom(activity *models.TalkActivity) *question {
+	if activity.Type != "Create" || activity.Object.Type != "Note" {
+		return nil
+	}
+
+	message, err := activity.Message()
+	if err != nil {
+		log.WithError(err).WithField("message_id", activity.Object.ID).Warn("Failed to decode Talk message")
+		return nil
+	}
+
+	text, addressed := b.extractQuestion(message)
+	if !addressed || text == "" {
+		return nil
+	}
+	return &question{activity: activity, text: text}
+}
+
+// markSeen records a message key and reports whether it was new
+func (b *Bot) markSeen(key string) bool {
+	b.seenMu.Lock()
+	defer b.seenMu.Unlock()
+
+	now := time.Now()
+	for seenKey, at := range b.seen {
+		if now.Sub(at) > dedupeTTL {
+			delete(b.seen, seenKey)
+		}
+	}
+	if _, ok := b.seen[key]; ok {
+		return false
+	}
+	b.seen[key] = now
+	return true
+}
+
+// forget drops a message key so a redelivery of a rejected message is answered
+func (b *Bot) forget(key string) {
+	b.seenMu.Lock()
+	defer b.seenMu.Unlock()
+	delete(b.seen, key)
+}
+
+// answer runs a question and posts the answer to its conversation
+func (b *Bot) answer(ctx context.Context, q *question) {
+	activity := q.activity
+	traceID := models.NewTraceID()
+	logger := log.WithFields(log.Fields{
+		"trace_id":     traceID,
+		"conversation": activity.Target.ID,
+		"actor":        activity.Actor.ID,
+		"message_id":   activity.Object.ID,
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, answerTimeout)
+	defer cancel()
+
+	replyTo, _ := strconv.ParseInt(activity.Object.ID, 10, 64)
+
+	// Only real users have an ACL identity; guests and bots cannot see any documents
+	userID := activity.Actor.UserID()
+	if userID == "" {
+		logger.Info("Ignoring Talk question from non-user actor")
+		b.reply(ctx, logger, activity.Target.ID, "Sorry, I can only answer questions from signed-in users.", replyTo)
+		return
+	}
+
+	// The answer is posted to the whole conversation, so it may only use documents every participant can read
+	readers, err := b.readers(ctx, activity.Target.ID, userID)
+	if errors.Is(err, errUnknownReader) {
+		logger.WithError(err).Info("Refusing Talk question in conversation with guests")
+		b.reply(ctx, logger, activity.Target.ID, "Sorry, I cannot answer in conversations with guests or external participants.", replyTo)
+		return
+	}
+	if err != nil {
+		logger.WithError(err).Error("Failed to check Talk conversation participants")
+		b.reply(ctx, logger, activity.Target.ID, "Sorry, I could not check who can read my answer in this conversation.", replyTo)
+		return
+	}
+
+	logger.WithFields(log.Fields{
+		"user_id": userID,
+		"readers": len(readers),
+	}).Info("Answering Talk question")
+
+	response, err := b.service.QueryShared(ctx, traceID, &models.QueryRequest{
+		UserID: userID,
+		Query:  q.text,
+		Tenant: b.cfg.Tenant,
+		Mode:   b.cfg.Mode,
+	}, readers)
+	if err != nil {
+		logger.WithError(err).Error("Talk query failed")
+		b.reply(ctx, logger, activity.Target.ID, "Sorry, something went wrong while searching the documents.", replyTo)
+		return
+	}
+
+	b.reply(ctx, logger, activity.Target.ID, b.formatAnswer(response), replyTo)
+}
+
+// readers returns the users who will read an answer in a conversation: the asker and
+// every other user participant. Bots and the service account itself are skipped, and so are
+// group and team attendees, because Talk also adds their members as user attendees.
+// Guests, email and federated participants have no local account and fail with errUnknownReader.
+func (b *Bot) readers(ctx context.Context, conversationToken, asker string) ([]string, error) {
+	participants, err := b.ncClient.GetRoomParticipants(ctx, conversationToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversation participants: %w", err)
+	}
+
+	readers := []string{asker}
+	for _, participant := range participants {
+		switch participant.ActorType {
+		case "bots", "groups", "circles":
+			continue
+		case "users":
+			if participant.ActorID != asker && participant.ActorID != b.ncClient.Username() {
+				readers = append(readers, participant.ActorID)
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s", errUnknownReader, participant.ActorType)
+		}
+	}
+	return readers, nil
+}
+
+// reply posts a message and logs failures
+func (b *Bot) reply(ctx context.Context, logger *log.Entry, conversationToken, message string, replyTo int64) {
+	if err := b.client.SendMessage(ctx, conversationToken, message, replyTo); err != nil {
+		logger.WithError(err).Error("Failed to post Talk reply")
+	}
+}
+
+// extractQuestion strips bot mentions from the message and reports whether the bot was addressed
+func (b *Bot) extractQuestion(message *models.TalkMessage) (string, bool) {
+	text := message.Message
+	addressed := false
+
+	for key, parameter := range message.Parameters {
+		placeholder := "{" + key + "}"
+		if b.isBotMention(parameter) {
+			addressed = true
+			text = strings.ReplaceAll(text, placeholder, "")
+			continue
+		}
+		text = strings.ReplaceAll(text, placeholder, parameter.Name)
+	}
+
+	// Also accept a plain "@<bot name>" prefix typed without autocompletion
+	prefix := "@" + b.cfg.BotName
+	trimmed := strings.TrimSpace(text)
+	if len(trimmed) >= len(prefix) && strings.EqualFold(trimmed[:len(prefix)], prefix) {
+		addressed = true
+		trimmed = trimmed[len(prefix):]
+	}
+
+	return strings.TrimSpace(strings.TrimLeft(trimmed, ":, ")), addressed
+}
+
+// isBotMention checks if a message parameter mentions this bot
+func (b *Bot) isBotMention(parameter models.TalkMessageParameter) bool {
+	if !strings.HasPrefix(parameter.Type, "user") && parameter.Type != "bot" {
+		return false
+	}
+	name := strings.ToLower(b.cfg.BotName)
+	return strings.ToLower(parameter.Name) == name ||
+		strings.ToLower(parameter.ID) == name ||
+		strings.ToLower(parameter.ID) == "bot-"+name
+}
+
+// formatAnswer renders a query response as a Talk markdown message with file links
+func (b *Bot) formatAnswer(response *models.QueryResponse) string {
+	if !response.Found {
+		return "I could not find anything about this in the documents you have access to."
+	}
+
+	var sb strings.Builder
+	if response.Answer != "" {
+		sb.WriteString(response.Answer)
+	} else {
+		for i, snippet := range response.Snippets {
+			if i >= 3 {
+				break
+			}
+			fmt.Fprintf(&sb, "> %s\n\n", strings.ReplaceAll(strings.TrimSpace(snippet.Text), "\n", "\n> "))
+		}
+	}
+
+	sb.WriteString("\n\n**Sources:**\n")
+	for i, source := range response.Sources {
+		fmt.Fprintf(&sb, "%d. [%s](%s/f/%s)\n", i+1, source.Path, b.nextcloudURL, source.FileID)
+	}
+	return strings.TrimSpace(sb.String())
+}
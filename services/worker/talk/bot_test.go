@@ -0,0 +1,100 @@
+package talk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"nc-rag-worker/config"
+	"nc-rag-worker/models"
+	"nc-rag-worker/nextcloud"
+)
+
+// newTestBot returns a bot whose conversation has the given participants
+func newTestBot(t *testing.T, participants []models.TalkParticipant) *Bot {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ocs": map[string]interface{}{"data": participants},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	ncClient := nextcloud.NewClient(server.URL, "rag", "secret")
+	return NewBot(config.TalkConfig{}, server.URL, ncClient, nil)
+}
+
+func TestReaders(t *testing.T) {
+	tests := []struct {
+		name         string
+		participants []models.TalkParticipant
+		want         []string
+		wantErr      error
+	}{
+		{
+			name: "users",
+			participants: []models.TalkParticipant{
+				{ActorType: "users", ActorID: "alice"},
+				{ActorType: "users", ActorID: "bob"},
+				{ActorType: "users", ActorID: "rag"},
+				{ActorType: "bots", ActorID: "bot-1"},
+			},
+			want: []string{"alice", "bob"},
+		},
+		{
+			name: "group and team attendees are listed with their members",
+			participants: []models.TalkParticipant{
+				{ActorType: "users", ActorID: "alice"},
+				{ActorType: "groups", ActorID: "staff"},
+				{ActorType: "circles", ActorID: "team-1"},
+				{ActorType: "users", ActorID: "carol"},
+			},
+			want: []string{"alice", "carol"},
+		},
+		{
+			name: "guest",
+			participants: []models.TalkParticipant{
+				{ActorType: "users", ActorID: "alice"},
+				{ActorType: "guests", ActorID: "abc"},
+			},
+			wantErr: errUnknownReader,
+		},
+		{
+			name: "email",
+			participants: []models.TalkParticipant{
+				{ActorType: "emails", ActorID: "x@example.com"},
+			},
+			wantErr: errUnknownReader,
+		},
+		{
+			name: "federated user",
+			participants: []models.TalkParticipant{
+				{ActorType: "federated_users", ActorID: "dave@remote.example"},
+			},
+			wantErr: errUnknownReader,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := newTestBot(t, tt.participants)
+			readers, err := bot.readers(context.Background(), "room", "alice")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readers: %v", err)
+			}
+			if !reflect.DeepEqual(readers, tt.want) {
+				t.Fatalf("readers = %v, want %v", readers, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package talk
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"nc-rag-worker/tracing"
+)
+
+// maxMessageLength is the Talk limit for a single chat message
+const maxMessageLength = 32000
+
+// Client posts bot replies to Nextcloud Talk conversations
+type Client struct {
+	baseURL    string
+	secret     atomic.Value
+	httpClient *http.Client
+}
+
+// NewClient creates a new Talk bot client
+func NewClient(baseURL, secret string) *Client {
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{
+			Timeout:   15 * time.Second,
+			Transport: tracing.Transport(http.DefaultTransport),
+		},
+	}
+	c.secret.Store(secret)
+	return c
+}
+
+// SetSecret switches to a rotated bot secret for all following messages
+func (c *Client) SetSecret(secret string) {
+	c.secret.Store(secret)
+}
+
+// currentSecret returns the bot secret shared with Talk
+func (c *Client) currentSecret() string {
+	return c.secret.Load().(string)
+}
+
+// SendMessage posts a message to the conversation, optionally as a reply to replyTo
+func (c *Client) SendMessage(ctx context.Context, conversationToken, message string, replyTo int64) error {
+	if len(message) > maxMessageLength {
+		message = strings.ToValidUTF8(message[:maxMessageLength], "")
+	}
+
+	body := map[string]interface{}{
+		"message": message,
+	}
+	if replyTo > 0 {
+		body["replyTo"] = replyTo
+	}
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to serialize request: %w", err)
+	}
+
+	random, err := randomHex(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate signature random: %w", err)
+	}
+
+	endpoint := c.baseURL + "/ocs/v2.php/apps/spreed/api/v1/bot/" + url.PathEscape(conversationToken) + "/message"
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(requestBody))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("OCS-APIRequest", "true")
+	// Talk signs outgoing bot messages over random + message text, not the full body
+	req.Header.Set("X-Nextcloud-Talk-Bot-Random", random)
+	req.Header.Set("X-Nextcloud-Talk-Bot-Signature", sign(c.currentSecret(), random, message))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send message to talk: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("talk returned error status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sign returns the hex HMAC-SHA256 of random + payload
+func sign(secret, random, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(random))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks a Talk signature in constant time
+func verify(secret, random, payload, signature string) bool {
+	expected := sign(secret, random, payload)
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(signature)))
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
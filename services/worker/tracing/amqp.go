@@ -0,0 +1,50 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// amqpCarrier adapts AMQP message headers to the propagation.TextMapCarrier interface
+type amqpCarrier amqp091.Table
+
+func (c amqpCarrier) Get(key string) string {
+	value, ok := c[key]
+	if !ok {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(value)
+}
+
+func (c amqpCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c amqpCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// InjectAMQP writes the span context of ctx as traceparent/tracestate into headers
+func InjectAMQP(ctx context.Context, headers amqp091.Table) {
+	otel.GetTextMapPropagator().Inject(ctx, amqpCarrier(headers))
+}
+
+// StartMessageSpan starts a consumer span for a delivery, continuing the trace from its
+// traceparent header or, without one, from the pipeline trace_id
+func StartMessageSpan(ctx context.Context, name string, headers amqp091.Table, traceID string) (context.Context, trace.Span) {
+	if headers != nil {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, amqpCarrier(headers))
+	}
+	return Start(ctx, name, traceID, trace.WithSpanKind(trace.SpanKindConsumer))
+}
@@ -0,0 +1,151 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"nc-rag-worker/completion"
+	"nc-rag-worker/models"
+	"nc-rag-worker/storage"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// signatureHeader carries the HMAC of the raw request body
+	signatureHeader = "X-Signature"
+	signaturePrefix = "hmac-sha256="
+	maxBodySize     = 1 << 20
+)
+
+// ParserHandler receives job status notifications from the parser
+type ParserHandler struct {
+	secret    atomic.Value
+	storage   storage.JobStore
+	completer *completion.Completer
+}
+
+// NewParserHandler creates a new parser webhook handler
+func NewParserHandler(secret string, storage storage.JobStore, completer *completion.Completer) *ParserHandler {
+	if secret == "" {
+		log.Warn("PARSER_SECRET is empty, all parser webhooks will be rejected")
+	}
+	h := &ParserHandler{
+		storage:   storage,
+		completer: completer,
+	}
+	h.secret.Store(secret)
+	return h
+}
+
+// SetSecret switches to a rotated signing secret for all following notifications
+func (h *ParserHandler) SetSecret(secret string) {
+	h.secret.Store(secret)
+}
+
+// ServeHTTP handles POST /webhooks/parser
+func (h *ParserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	if !h.verifySignature(r.Header.Get(signatureHeader), body) {
+		log.WithField("remote_addr", r.RemoteAddr).Warn("Rejected parser webhook with invalid signature")
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var payload models.ParserWebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.JobID == "" {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	logger := log.WithFields(log.Fields{
+		"trace_id":      payload.TraceID,
+		"job_id":        payload.JobID,
+		"parser_status": payload.Status,
+	})
+	logger.Info("Received parser webhook")
+
+	ctx := r.Context()
+	job, err := h.storage.GetJob(ctx, payload.JobID)
+	if err != nil {
+		if errors.Is(err, storage.ErrJobNotFound) {
+			logger.Warn("Parser webhook for unknown job")
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		logger.WithError(err).Error("Failed to load job for parser webhook")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	switch models.JobStatusFromParser(payload.Status) {
+	case models.JobStatusCompleted:
+		err = h.completer.Complete(ctx, job)
+	case models.JobStatusFailed:
+		if job.Status == models.JobStatusFailed {
+			break
+		}
+		err = h.completer.Fail(ctx, job, payload.Error)
+	case models.JobStatusProcessing:
+		if job.Status == models.JobStatusSubmitted {
+			err = h.storage.UpdateJobStatus(ctx, job.JobID, models.JobStatusProcessing, "")
+		}
+	default:
+		logger.Debug("Ignoring intermediate parser status")
+	}
+	if errors.Is(err, models.ErrInvalidTransition) {
+		// Redelivering would not help; the job already moved past this status
+		logger.WithError(err).Warn("Parser webhook conflicts with job status")
+		http.Error(w, "job status conflict", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		// A 5xx makes the parser redeliver, which is safe because completion is idempotent
+		logger.WithError(err).Error("Failed to apply parser webhook")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// verifySignature checks the X-Signature header against the configured secret.
+// Without a secret nothing can be verified, so every request is rejected.
+func (h *ParserHandler) verifySignature(header string, body []byte) bool {
+	secret := h.secret.Load().(string)
+	if secret == "" {
+		return false
+	}
+	if !strings.HasPrefix(header, signaturePrefix) {
+		return false
+	}
+
+	signature, err := hex.DecodeString(strings.TrimPrefix(header, signaturePrefix))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(signature, mac.Sum(nil))
+}
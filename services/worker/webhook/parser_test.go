@@ -0,0 +1,189 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nc-rag-worker/completion"
+	"nc-rag-worker/config"
+	"nc-rag-worker/models"
+	"nc-rag-worker/storage"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestHandler returns a handler with an in-memory job store holding a submitted job-1
+func newTestHandler(t *testing.T, secret string) (*ParserHandler, storage.JobStore, *storage.RedisStorage) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	redisStorage, err := storage.NewRedisStorage("redis://"+server.Addr(), config.RetentionConfig{})
+	if err != nil {
+		t.Fatalf("NewRedisStorage: %v", err)
+	}
+	t.Cleanup(func() { redisStorage.Close() })
+
+	jobs := storage.NewMemoryJobStore()
+	job := &models.JobState{
+		JobID:       "job-1",
+		FileID:      42,
+		Tenant:      "tenant",
+		Status:      models.JobStatusSubmitted,
+		SubmittedAt: time.Now(),
+	}
+	job.StartHistory(job.SubmittedAt)
+	if err := jobs.SaveJob(context.Background(), job); err != nil {
+		t.Fatalf("SaveJob: %v", err)
+	}
+
+	completer := completion.NewCompleter(jobs, redisStorage, nil)
+	return NewParserHandler(secret, jobs, completer), jobs, redisStorage
+}
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func post(h http.Handler, body, signature string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/parser", strings.NewReader(body))
+	if signature != "" {
+		req.Header.Set(signatureHeader, signature)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func jobStatus(t *testing.T, jobs storage.JobStore) models.JobStatus {
+	t.Helper()
+	job, err := jobs.GetJob(context.Background(), "job-1")
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	return job.Status
+}
+
+func TestParserWebhookSignature(t *testing.T) {
+	body := `{"job_id":"job-1","status":"processing"}`
+
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		want      int
+	}{
+		{name: "valid", secret: "s3cret", signature: sign("s3cret", body), want: http.StatusOK},
+		{name: "wrong secret", secret: "s3cret", signature: sign("other", body), want: http.StatusUnauthorized},
+		{name: "tampered body", secret: "s3cret", signature: sign("s3cret", body+" "), want: http.StatusUnauthorized},
+		{name: "missing", secret: "s3cret", want: http.StatusUnauthorized},
+		{name: "no prefix", secret: "s3cret", signature: strings.TrimPrefix(sign("s3cret", body), signaturePrefix), want: http.StatusUnauthorized},
+		{name: "not hex", secret: "s3cret", signature: signaturePrefix + "zz", want: http.StatusUnauthorized},
+		{name: "empty secret", secret: "", signature: sign("", body), want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, jobs, _ := newTestHandler(t, tt.secret)
+			rec := post(h, body, tt.signature)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want != http.StatusOK && jobStatus(t, jobs) != models.JobStatusSubmitted {
+				t.Fatal("rejected webhook changed the job")
+			}
+		})
+	}
+}
+
+func TestParserWebhookSecretRotation(t *testing.T) {
+	body := `{"job_id":"job-1","status":"processing"}`
+	h, _, _ := newTestHandler(t, "old")
+
+	h.SetSecret("new")
+	if rec := post(h, body, sign("old", body)); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("old secret: status = %d, want 401", rec.Code)
+	}
+	if rec := post(h, body, sign("new", body)); rec.Code != http.StatusOK {
+		t.Fatalf("new secret: status = %d, want 200", rec.Code)
+	}
+}
+
+func TestParserWebhookStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+		want   models.JobStatus
+	}{
+		{name: "processing", status: "running", want: models.JobStatusProcessing},
+		{name: "completed", status: "succeeded", want: models.JobStatusCompleted},
+		{name: "failed", status: "error", want: models.JobStatusFailed},
+		{name: "intermediate", status: "queued", want: models.JobStatusSubmitted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, jobs, redisStorage := newTestHandler(t, "s3cret")
+			// Mark ingest.ready as published so completion does not need a broker
+			if _, err := redisStorage.MarkIngestPublished(context.Background(), "job-1"); err != nil {
+				t.Fatalf("MarkIngestPublished: %v", err)
+			}
+
+			body := `{"job_id":"job-1","status":"` + tt.status + `"}`
+			if rec := post(h, body, sign("s3cret", body)); rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", rec.Code)
+			}
+			if got := jobStatus(t, jobs); got != tt.want {
+				t.Fatalf("job status = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParserWebhookConflict(t *testing.T) {
+	h, jobs, redisStorage := newTestHandler(t, "s3cret")
+	if _, err := redisStorage.MarkIngestPublished(context.Background(), "job-1"); err != nil {
+		t.Fatalf("MarkIngestPublished: %v", err)
+	}
+
+	completed := `{"job_id":"job-1","status":"completed"}`
+	if rec := post(h, completed, sign("s3cret", completed)); rec.Code != http.StatusOK {
+		t.Fatalf("completed: status = %d, want 200", rec.Code)
+	}
+
+	// A completed job cannot fail anymore
+	failed := `{"job_id":"job-1","status":"failed","error":"late"}`
+	if rec := post(h, failed, sign("s3cret", failed)); rec.Code != http.StatusConflict {
+		t.Fatalf("failed after completed: status = %d, want 409", rec.Code)
+	}
+	if got := jobStatus(t, jobs); got != models.JobStatusCompleted {
+		t.Fatalf("job status = %s, want completed", got)
+	}
+}
+
+func TestParserWebhookBadRequests(t *testing.T) {
+	h, _, _ := newTestHandler(t, "s3cret")
+
+	unknown := `{"job_id":"job-2","status":"completed"}`
+	if rec := post(h, unknown, sign("s3cret", unknown)); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown job: status = %d, want 404", rec.Code)
+	}
+	invalid := `{"status":"completed"}`
+	if rec := post(h, invalid, sign("s3cret", invalid)); rec.Code != http.StatusBadRequest {
+		t.Fatalf("missing job ID: status = %d, want 400", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/webhooks/parser", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET: status = %d, want 405", rec.Code)
+	}
+}